@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	amconfig "github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/common/model"
+	yaml "gopkg.in/yaml.v2"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	configV1beta1 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+// renderAlertmanagerKey is the render workqueue key of the alertmanager
+// config.
+const renderAlertmanagerKey = "alertmanager"
+
+// alertRouteNamespaceLabel is the alert label that the route of an alert
+// route is matched on.
+const alertRouteNamespaceLabel = "namespace"
+
+// unconfirmedAlertmanagerLoad is the Loaded condition of alert routes, the
+// controller does not confirm that alertmanager has loaded its config.
+var unconfirmedAlertmanagerLoad = loadStatus{metav1.ConditionUnknown, ReasonUnconfirmed, "alertmanager loads are not confirmed"}
+
+// amRoute is the alertmanager form of a route.
+type amRoute struct {
+	Receiver       string            `yaml:"receiver,omitempty"`
+	GroupBy        []string          `yaml:"group_by,omitempty"`
+	Match          map[string]string `yaml:"match,omitempty"`
+	MatchRE        map[string]string `yaml:"match_re,omitempty"`
+	Continue       bool              `yaml:"continue,omitempty"`
+	GroupWait      string            `yaml:"group_wait,omitempty"`
+	GroupInterval  string            `yaml:"group_interval,omitempty"`
+	RepeatInterval string            `yaml:"repeat_interval,omitempty"`
+	Routes         []*amRoute        `yaml:"routes,omitempty"`
+}
+
+// alertRouteModel holds the converted form of each alert route between
+// syncs.
+type alertRouteModel struct {
+	sync.Mutex
+	routes    map[string]*amRoute
+	receivers map[string][]yaml.MapSlice
+}
+
+func newAlertRouteModel() *alertRouteModel {
+	return &alertRouteModel{
+		routes:    map[string]*amRoute{},
+		receivers: map[string][]yaml.MapSlice{},
+	}
+}
+
+func (m *alertRouteModel) keys() []string {
+	m.Lock()
+	defer m.Unlock()
+	var keys []string
+	for k := range m.routes {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// alerting reports whether the controller renders an alertmanager config.
+func (c *Controller) alerting() bool {
+	return c.AlertmanagerTemplate != nil
+}
+
+// alertReceiverName returns the name a receiver of an alert route is
+// rendered with. Receiver names are global in alertmanager, so they are
+// prefixed with the namespace and name of the alert route.
+func alertReceiverName(ns, name, receiver string) string {
+	return fmt.Sprintf("%s/%s/%s", ns, name, receiver)
+}
+
+// convertAlertRoute converts an alert route to its alertmanager route and
+// receivers. The route is matched on the namespace of the alert route, and
+// may only use the receivers defined alongside it. Nothing is returned if
+// there are any errors.
+func convertAlertRoute(ar *configV1beta1.AlertRoute) (*amRoute, []yaml.MapSlice, []error) {
+	var errs []error
+	var receivers []yaml.MapSlice
+	names := map[string]bool{}
+	for i, r := range ar.Spec.Receivers {
+		rerr := func(err error) {
+			errs = append(errs, errors.Wrapf(err, "receivers[%d]", i))
+		}
+		if r.Name == "" {
+			rerr(errors.New("name is required"))
+			continue
+		}
+		if names[r.Name] {
+			rerr(fmt.Errorf("duplicate receiver name %q", r.Name))
+			continue
+		}
+		names[r.Name] = true
+
+		rcv, err := convertReceiver(r)
+		if err != nil {
+			rerr(err)
+			continue
+		}
+		receivers = append(receivers, append(yaml.MapSlice{
+			{Key: "name", Value: alertReceiverName(ar.Namespace, ar.Name, r.Name)},
+		}, rcv...))
+	}
+
+	route, rerrs := convertSubRoute("route", ar, ar.Spec.Route.SubRoute, names)
+	errs = append(errs, rerrs...)
+	if route != nil && route.Receiver == "" {
+		errs = append(errs, errors.New("route: receiver is required"))
+	}
+	for i, sr := range ar.Spec.Route.Routes {
+		child, rerrs := convertSubRoute(fmt.Sprintf("route.routes[%d]", i), ar, sr, names)
+		errs = append(errs, rerrs...)
+		if route != nil && child != nil {
+			route.Routes = append(route.Routes, child)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	// The match of the spec is copied, so the namespace can be added without
+	// modifying the cached object.
+	match := map[string]string{alertRouteNamespaceLabel: ar.Namespace}
+	for k, v := range route.Match {
+		match[k] = v
+	}
+	route.Match = match
+	return route, receivers, nil
+}
+
+// convertReceiver parses the config of a receiver, and checks it with the
+// alertmanager config loader.
+func convertReceiver(r configV1beta1.Receiver) (yaml.MapSlice, error) {
+	cfg := yaml.MapSlice{}
+	if err := yaml.Unmarshal([]byte(r.Config), &cfg); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+	for _, item := range cfg {
+		k, _ := item.Key.(string)
+		if !strings.HasSuffix(k, "_configs") {
+			return nil, fmt.Errorf("invalid config, unknown field %v", item.Key)
+		}
+		if _, ok := item.Value.([]interface{}); !ok {
+			return nil, fmt.Errorf("invalid config, %s must be a list", k)
+		}
+	}
+
+	bs, err := yaml.Marshal(append(yaml.MapSlice{{Key: "name", Value: r.Name}}, cfg...))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+	if err := yaml.UnmarshalStrict(bs, &amconfig.Receiver{}); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+	return cfg, nil
+}
+
+// convertSubRoute converts a route, without its children.
+func convertSubRoute(field string, ar *configV1beta1.AlertRoute, r configV1beta1.SubRoute, receivers map[string]bool) (*amRoute, []error) {
+	var errs []error
+	ferr := func(err error) {
+		errs = append(errs, errors.Wrap(err, field))
+	}
+
+	res := &amRoute{
+		GroupBy:        r.GroupBy,
+		Match:          r.Match,
+		MatchRE:        r.MatchRE,
+		Continue:       r.Continue,
+		GroupWait:      r.GroupWait,
+		GroupInterval:  r.GroupInterval,
+		RepeatInterval: r.RepeatInterval,
+	}
+
+	if r.Receiver != "" {
+		if !receivers[r.Receiver] {
+			ferr(fmt.Errorf("unknown receiver %q", r.Receiver))
+		}
+		res.Receiver = alertReceiverName(ar.Namespace, ar.Name, r.Receiver)
+	}
+
+	for _, d := range []struct{ name, val string }{
+		{"groupWait", r.GroupWait},
+		{"groupInterval", r.GroupInterval},
+		{"repeatInterval", r.RepeatInterval},
+	} {
+		if d.val == "" {
+			continue
+		}
+		if _, err := model.ParseDuration(d.val); err != nil {
+			ferr(errors.Wrapf(err, "invalid %s", d.name))
+		}
+	}
+
+	for _, l := range r.GroupBy {
+		if l != "..." && !model.LabelName(l).IsValid() {
+			ferr(fmt.Errorf("invalid groupBy label %q", l))
+		}
+	}
+
+	for _, err := range checkMatch(ar.Namespace, "match", r.Match, "matchRE", r.MatchRE) {
+		ferr(err)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return res, nil
+}
+
+// checkMatch checks the label matchers of a route or inhibit rule. The
+// namespace label may only be matched on the given namespace, which is always
+// added to the matchers when rendered.
+func checkMatch(ns, matchField string, match map[string]string, reField string, matchRE map[string]string) []error {
+	var errs []error
+	for _, l := range sortedKeys(match) {
+		if !model.LabelName(l).IsValid() {
+			errs = append(errs, fmt.Errorf("invalid %s label %q", matchField, l))
+		}
+		if l == alertRouteNamespaceLabel && match[l] != ns {
+			errs = append(errs, fmt.Errorf("%s can only match alerts from namespace %q", matchField, ns))
+		}
+	}
+	for _, l := range sortedKeys(matchRE) {
+		if !model.LabelName(l).IsValid() {
+			errs = append(errs, fmt.Errorf("invalid %s label %q", reField, l))
+		}
+		if l == alertRouteNamespaceLabel {
+			errs = append(errs, fmt.Errorf("%s can only match alerts from namespace %q", reField, ns))
+		}
+		if _, err := regexp.Compile("^(?:" + matchRE[l] + ")$"); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid %s for %q", reField, l))
+		}
+	}
+	return errs
+}
+
+// syncAlertmanagerHandler reconciles every alert route and inhibit rule, and
+// renders the alertmanager config.
+func (c *Controller) syncAlertmanagerHandler() (bool, error) {
+	if !c.alerting() {
+		return false, nil
+	}
+
+	ars, err := c.alertRoutesLister.AlertRoutes(c.Namespace).List(c.Selector)
+	if err != nil {
+		return false, errors.Wrap(err, "listing alert routes")
+	}
+
+	seen := map[string]bool{}
+	for _, ar := range ars {
+		var key string
+		if key, err = cache.MetaNamespaceKeyFunc(ar); err != nil {
+			runtime.HandleError(err)
+			continue
+		}
+		seen[key] = true
+		c.reconcileAlertRoute(key, ar)
+	}
+
+	for _, key := range c.alertRoutes.keys() {
+		if !seen[key] {
+			c.forgetAlertRoute(key)
+		}
+	}
+
+	if err := c.syncInhibitRules(); err != nil {
+		return false, err
+	}
+
+	return c.renderAlertmanager()
+}
+
+// syncAlertRoute reconciles the alert route with the given key, and
+// schedules the alertmanager config to be rendered.
+func (c *Controller) syncAlertRoute(key string) error {
+	ns, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+
+	ar, err := c.alertRoutesLister.AlertRoutes(ns).Get(name)
+	switch {
+	case kerrors.IsNotFound(err):
+		c.forgetAlertRoute(key)
+	case err != nil:
+		return err
+	case !c.selects(ar):
+		c.forgetAlertRoute(key)
+	default:
+		c.reconcileAlertRoute(key, ar)
+	}
+
+	c.queueRender(renderAlertmanagerKey)
+	return nil
+}
+
+// reconcileAlertRoute converts ar, updates its status, and stores the result
+// in the alert route model.
+func (c *Controller) reconcileAlertRoute(key string, ar *configV1beta1.AlertRoute) {
+	route, receivers, errs := convertAlertRoute(ar)
+
+	state := renderedCurrent
+	if route == nil {
+		state = notRendered
+	}
+	if err := c.updatearstatus(ar, state, errs); err != nil {
+		glog.Infof("updating status of %s failed, %v", key, err)
+	}
+	c.recordSyncEvent(ar, state, errs)
+	for _, err := range errs {
+		glog.Infof("alert route error in %v: %v", key, err)
+	}
+
+	c.alertRoutes.Lock()
+	defer c.alertRoutes.Unlock()
+	c.alertRoutes.routes[key] = route
+	c.alertRoutes.receivers[key] = receivers
+}
+
+// forgetAlertRoute removes a deleted alert route from the alert route model.
+func (c *Controller) forgetAlertRoute(key string) {
+	c.events.forget(eventKind(&configV1beta1.AlertRoute{}) + "/" + key)
+
+	c.alertRoutes.Lock()
+	defer c.alertRoutes.Unlock()
+	delete(c.alertRoutes.routes, key)
+	delete(c.alertRoutes.receivers, key)
+}
+
+// renderAlertmanager renders the alertmanager config, and writes it if it is
+// valid. An invalid config is not written, so alertmanager keeps the last
+// valid config.
+func (c *Controller) renderAlertmanager() (bool, error) {
+	if !c.alerting() {
+		return false, nil
+	}
+
+	bs, err := c.alertmanagerConfig("", nil, nil)
+	if err != nil {
+		return false, err
+	}
+
+	secUpdated, err := c.updateSecret(c.AlertmanagerSecret, c.AlertmanagerSecretKey, c.AlertmanagerSecretNS, bs)
+	if err != nil {
+		return false, errors.Wrap(err, "udpate alertmanager config secret")
+	}
+
+	fileChanged, err := updateFile(c.AlertmanagerFile, bs, c.Files)
+	if err != nil {
+		return secUpdated, errors.Wrap(err, "update alertmanager config file")
+	}
+
+	return secUpdated || fileChanged, nil
+}
+
+// alertmanagerConfig renders the alertmanager config template, with the
+// route of every alert route added ahead of the child routes of its root
+// route, their receivers added to its receivers, and every inhibit rule added
+// to its inhibit rules. If key is set, route and receivers are used in place
+// of those of the alert route with that key. The result is checked with the
+// alertmanager config loader.
+func (c *Controller) alertmanagerConfig(key string, route *amRoute, rcvs []yaml.MapSlice) ([]byte, error) {
+	baseCfg := &bytes.Buffer{}
+	if err := c.AlertmanagerTemplate.Execute(baseCfg, nil); err != nil {
+		return nil, errors.Wrap(err, "rendering alertmanager config template")
+	}
+
+	cfg := yaml.MapSlice{}
+	if err := yaml.Unmarshal(baseCfg.Bytes(), &cfg); err != nil {
+		return nil, errors.Wrap(err, "checking alertmanager config template result")
+	}
+	root, ok := mapSliceValue(cfg, "route").(yaml.MapSlice)
+	if !ok {
+		return nil, errors.New("alertmanager config template has no route")
+	}
+
+	c.alertRoutes.Lock()
+	allRoutes := map[string]*amRoute{}
+	allReceivers := map[string][]yaml.MapSlice{}
+	for k, r := range c.alertRoutes.routes {
+		allRoutes[k] = r
+		allReceivers[k] = c.alertRoutes.receivers[k]
+	}
+	c.alertRoutes.Unlock()
+	if key != "" {
+		allRoutes[key] = route
+		allReceivers[key] = rcvs
+	}
+
+	var routes []interface{}
+	var receivers []interface{}
+	for _, k := range sortedAlertRouteKeys(allRoutes) {
+		if allRoutes[k] == nil {
+			continue
+		}
+		routes = append(routes, allRoutes[k])
+		for _, r := range allReceivers[k] {
+			receivers = append(receivers, r)
+		}
+	}
+
+	if len(routes) > 0 {
+		baseRoutes, _ := mapSliceValue(root, "routes").([]interface{})
+		root = setMapSliceValue(root, "routes", append(routes, baseRoutes...))
+		cfg = setMapSliceValue(cfg, "route", root)
+
+		baseReceivers, _ := mapSliceValue(cfg, "receivers").([]interface{})
+		cfg = setMapSliceValue(cfg, "receivers", append(baseReceivers, receivers...))
+	}
+
+	if inhibits := c.inhibitRules.sorted(); len(inhibits) > 0 {
+		baseInhibits, _ := mapSliceValue(cfg, "inhibit_rules").([]interface{})
+		cfg = setMapSliceValue(cfg, "inhibit_rules", append(baseInhibits, inhibits...))
+	}
+
+	bs, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "convert alertmanager config")
+	}
+	if _, err := amconfig.Load(string(bs)); err != nil {
+		return nil, errors.Wrap(err, "checking rendered alertmanager config")
+	}
+	return bs, nil
+}
+
+func (c *Controller) updatearstatus(org *configV1beta1.AlertRoute, state renderState, errs []error) error {
+	ctx := context.Background()
+	var err error
+	ar := org.DeepCopy()
+
+	ar.Status.Errors = nil
+	for _, err := range errs {
+		ar.Status.Errors = append(ar.Status.Errors, err.Error())
+	}
+	ar.Status.ErrorCount = len(ar.Status.Errors)
+	ar.Status.ObservedGeneration = ar.Generation
+	c.setConditions(&ar.Status.Conditions, ar.Generation, state, unconfirmedAlertmanagerLoad, errs)
+
+	if !reflect.DeepEqual(org.Status, ar.Status) {
+		_, err = c.confclientset.ConfigV1beta1().AlertRoutes(ar.Namespace).UpdateStatus(ctx, ar, metav1.UpdateOptions{})
+	}
+
+	return err
+}
+
+func (c *Controller) enqueuealertroute(obj interface{}) {
+	var key string
+	var err error
+	if key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	c.alertRoutesWorkqueue.AddRateLimited(key)
+}
+
+func (c *Controller) runAlertRoutesWorker() {
+	processAlertRoute := makeProcessNextWorkItem(c.alertRoutesWorkqueue, c.syncAlertRoute)
+	for processAlertRoute() {
+	}
+
+	glog.Info("alert routes worker stopped")
+}
+
+// mapSliceValue returns the value of key in ms, or nil if it is not set.
+func mapSliceValue(ms yaml.MapSlice, key string) interface{} {
+	for _, item := range ms {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+// setMapSliceValue sets the value of key in ms, adding it to the end if it
+// is not set.
+func setMapSliceValue(ms yaml.MapSlice, key string, v interface{}) yaml.MapSlice {
+	for i, item := range ms {
+		if item.Key == key {
+			ms[i].Value = v
+			return ms
+		}
+	}
+	return append(ms, yaml.MapItem{Key: key, Value: v})
+}
+
+func sortedAlertRouteKeys(m map[string]*amRoute) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"text/template"
+
+	v1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+
+	conf "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+var testAlertRoute = `
+route:
+  receiver: team
+  groupBy: [alertname]
+  repeatInterval: 4h
+  routes:
+  - receiver: pager
+    match:
+      severity: critical
+receivers:
+- name: team
+  config: |
+    slack_configs:
+    - api_url: https://hooks.slack.com/services/team
+      channel: '#team'
+- name: pager
+  config: |
+    pagerduty_configs:
+    - routing_key: abc
+`
+
+var testAlertmanagerTemplate = `
+route:
+  receiver: default
+  routes:
+  - receiver: default
+    match:
+      severity: none
+receivers:
+- name: default
+`
+
+// newAlertRoute decodes s as the API server would, using the JSON field
+// names of the spec.
+func newAlertRoute(name string, s string) *conf.AlertRoute {
+	spec := conf.AlertRouteSpec{}
+	if err := yaml.Unmarshal([]byte(s), &spec); err != nil {
+		panic(err)
+	}
+
+	return &conf.AlertRoute{
+		TypeMeta: metav1.TypeMeta{APIVersion: conf.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: metav1.NamespaceDefault,
+		},
+		Spec: spec,
+	}
+}
+
+func TestConvertAlertRoute(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		errs []string
+	}{
+		{
+			name: "valid",
+			spec: testAlertRoute,
+		},
+		{
+			name: "unknown receiver",
+			spec: `
+route:
+  receiver: team
+  routes:
+  - receiver: other
+receivers:
+- name: team
+`,
+			errs: []string{`route.routes[0]: unknown receiver "other"`},
+		},
+		{
+			name: "other namespace",
+			spec: `
+route:
+  receiver: team
+  match:
+    namespace: other
+  matchRE:
+    namespace: .*
+receivers:
+- name: team
+`,
+			errs: []string{
+				`route: match can only match alerts from namespace "default"`,
+				`route: matchRE can only match alerts from namespace "default"`,
+			},
+		},
+		{
+			name: "invalid fields",
+			spec: `
+route:
+  receiver: team
+  groupWait: soon
+  matchRE:
+    job: "("
+receivers:
+- name: team
+  config: |
+    name: other
+- name: team
+`,
+			errs: []string{
+				`receivers[0]: invalid config, unknown field name`,
+				`receivers[1]: duplicate receiver name "team"`,
+				`route: invalid groupWait: not a valid duration string: "soon"`,
+				"route: invalid matchRE for \"job\": error parsing regexp: missing closing ): `^(?:()$`",
+			},
+		},
+		{
+			name: "invalid receiver configs",
+			spec: `
+route:
+  receiver: hook
+receivers:
+- name: hook
+  config: |
+    webhook_configs:
+    - url: "://nowhere"
+- name: unknown
+  config: |
+    webhook_configs:
+    - url: http://example.com/
+      colour: red
+- name: missing
+  config: |
+    pagerduty_configs:
+    - severity: critical
+`,
+			errs: []string{
+				`receivers[0]: invalid config: parse "://nowhere": missing protocol scheme`,
+				`receivers[1]: invalid config: yaml: unmarshal errors:
+  line 4: field colour not found in type config.plain`,
+				`receivers[2]: invalid config: missing service or routing key in PagerDuty config`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route, _, errs := convertAlertRoute(newAlertRoute("test", tt.spec))
+			var got []string
+			for _, err := range errs {
+				got = append(got, err.Error())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.errs, "\n") {
+				t.Fatalf("expected errors:\n%s\ngot:\n%s", strings.Join(tt.errs, "\n"), strings.Join(got, "\n"))
+			}
+			if len(tt.errs) == 0 && route.Match[alertRouteNamespaceLabel] != metav1.NamespaceDefault {
+				t.Errorf("expected route to match its namespace, got %v", route.Match)
+			}
+		})
+	}
+}
+
+func TestConvertInhibitRule(t *testing.T) {
+	ir := &conf.InhibitRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+		Spec: conf.InhibitRuleSpec{
+			TargetMatch:   map[string]string{"namespace": "other"},
+			TargetMatchRE: map[string]string{"severity": "("},
+			Equal:         []string{"not-a-label"},
+		},
+	}
+	_, errs := convertInhibitRule(ir)
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	exp := []string{
+		"sourceMatch or sourceMatchRE is required",
+		`targetMatch can only match alerts from namespace "default"`,
+		"invalid targetMatchRE for \"severity\": error parsing regexp: missing closing ): `^(?:()$`",
+		`invalid equal label "not-a-label"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(exp, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestRenderAlertmanager(t *testing.T) {
+	f := newFixture(t)
+	valid := newAlertRoute("valid", testAlertRoute)
+	invalid := newAlertRoute("invalid", "route: {receiver: missing}")
+	inhibit := &conf.InhibitRule{
+		TypeMeta:   metav1.TypeMeta{APIVersion: conf.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Name: "ooh", Namespace: metav1.NamespaceDefault},
+		Spec: conf.InhibitRuleSpec{
+			SourceMatch: map[string]string{"alertname": "MuteOutOfHours"},
+			TargetMatch: map[string]string{"severity": "warning"},
+		},
+	}
+	f.objects = append(f.objects, valid, invalid, inhibit)
+
+	c, i, _ := f.newController()
+	c.AlertmanagerTemplate = template.Must(template.New("am").Parse(testAlertmanagerTemplate))
+	c.AlertmanagerSecretNS = "default"
+	c.AlertmanagerSecret = "alertmanager"
+	c.AlertmanagerSecretKey = "alertmanager.yaml"
+	c.alertRoutesLister = i.Config().V1beta1().AlertRoutes().Lister()
+	indexer := i.Config().V1beta1().AlertRoutes().Informer().GetIndexer()
+	indexer.Add(valid)
+	indexer.Add(invalid)
+	c.inhibitRulesLister = i.Config().V1beta1().InhibitRules().Lister()
+	i.Config().V1beta1().InhibitRules().Informer().GetIndexer().Add(inhibit)
+
+	changed, err := c.syncAlertmanagerHandler()
+	if err != nil || !changed {
+		t.Fatalf("expected alertmanager config to be rendered, got %v, %v", changed, err)
+	}
+
+	ctx := context.Background()
+	sec, err := f.kubeclient.CoreV1().Secrets("default").Get(ctx, "alertmanager", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting secret failed, %v", err)
+	}
+	exp := `route:
+  receiver: default
+  routes:
+  - receiver: default/valid/team
+    group_by:
+    - alertname
+    match:
+      namespace: default
+    repeat_interval: 4h
+    routes:
+    - receiver: default/valid/pager
+      match:
+        severity: critical
+  - receiver: default
+    match:
+      severity: none
+receivers:
+- name: default
+- name: default/valid/team
+  slack_configs:
+  - api_url: https://hooks.slack.com/services/team
+    channel: '#team'
+- name: default/valid/pager
+  pagerduty_configs:
+  - routing_key: abc
+inhibit_rules:
+- source_match:
+    alertname: MuteOutOfHours
+  target_match:
+    namespace: default
+    severity: warning
+`
+	if got := string(sec.Data["alertmanager.yaml"]); got != exp {
+		t.Errorf("expected config:\n%s\ngot:\n%s", exp, got)
+	}
+
+	ar, err := f.client.ConfigV1beta1().AlertRoutes("default").Get(ctx, "invalid", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting alert route failed, %v", err)
+	}
+	if ar.Status.ErrorCount != 1 {
+		t.Errorf("expected the invalid alert route to report an error, got %v", ar.Status.Errors)
+	}
+
+	// Deleted alert routes are removed from the config.
+	indexer.Delete(valid)
+	if err := c.syncAlertRoute("default/valid"); err != nil {
+		t.Fatalf("sync failed, %v", err)
+	}
+	if changed, err = c.renderAlertmanager(); err != nil || !changed {
+		t.Fatalf("expected alertmanager config to be rendered, got %v, %v", changed, err)
+	}
+	sec, _ = f.kubeclient.CoreV1().Secrets("default").Get(ctx, "alertmanager", metav1.GetOptions{})
+	last := string(sec.Data["alertmanager.yaml"])
+	if strings.Contains(last, "default/valid") {
+		t.Errorf("expected deleted alert route to be removed, got:\n%s", last)
+	}
+
+	// An alert route that makes the whole config invalid is denied at
+	// admission, and the last valid config is kept if it gets through.
+	broken := newAlertRoute("broken", `
+route:
+  receiver: team
+receivers:
+- name: team
+  config: |
+    slack_configs:
+    - channel: '#team'
+`)
+	raw, _ := json.Marshal(broken)
+	res := c.admit(v1.AdmissionReview{Request: &v1.AdmissionRequest{
+		Operation: v1.Create,
+		Resource:  metav1.GroupVersionResource(conf.SchemeGroupVersion.WithResource("alertroutes")),
+		Object:    runtime.RawExtension{Raw: raw},
+	}})
+	if res.Allowed || !strings.Contains(res.Result.Message, "no global Slack API URL set") {
+		t.Errorf("expected alert route to be denied, got %v", res.Result)
+	}
+
+	indexer.Add(broken)
+	if err := c.syncAlertRoute("default/broken"); err != nil {
+		t.Fatalf("sync failed, %v", err)
+	}
+	if changed, err = c.renderAlertmanager(); err == nil || changed {
+		t.Fatalf("expected invalid alertmanager config not to be rendered, got %v, %v", changed, err)
+	}
+	sec, _ = f.kubeclient.CoreV1().Secrets("default").Get(ctx, "alertmanager", metav1.GetOptions{})
+	if got := string(sec.Data["alertmanager.yaml"]); got != last {
+		t.Errorf("expected last valid config to be kept, got:\n%s", got)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configV1beta1 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+// Reasons used in status conditions.
+const (
+	ReasonValid       = "Valid"
+	ReasonInvalid     = "Invalid"
+	ReasonRendered    = "Rendered"
+	ReasonStale       = "Stale"
+	ReasonNotRendered = "NotRendered"
+	ReasonUnconfirmed = "Unconfirmed"
+)
+
+// maxConditionMessage is the maximum length of a condition message accepted
+// by the API server.
+const maxConditionMessage = 32768
+
+// renderState describes how an object was included in the rendered config.
+type renderState int
+
+const (
+	// notRendered objects are left out of the rendered config.
+	notRendered renderState = iota
+	// renderedStale objects have their last valid config rendered in place
+	// of their current spec.
+	renderedStale
+	// renderedCurrent objects have their current spec rendered.
+	renderedCurrent
+)
+
+// loadStatus is the state of the Loaded condition of an object.
+type loadStatus struct {
+	Status  metav1.ConditionStatus
+	Reason  string
+	Message string
+}
+
+// unconfirmedLoad is the Loaded condition of objects whose rendered config
+// has not yet been confirmed as loaded by prometheus.
+var unconfirmedLoad = loadStatus{metav1.ConditionUnknown, ReasonUnconfirmed, "prometheus has not been confirmed to have loaded the rendered configuration"}
+
+// setConditions recomputes the Valid, Rendered and Loaded conditions from
+// the result of the latest sync.
+func (c *Controller) setConditions(conds *[]metav1.Condition, generation int64, state renderState, load loadStatus, errs []error) {
+	set := func(typ string, status metav1.ConditionStatus, reason, msg string) {
+		if len(msg) > maxConditionMessage {
+			msg = msg[:maxConditionMessage]
+		}
+		meta.SetStatusCondition(conds, metav1.Condition{
+			Type:               typ,
+			Status:             status,
+			ObservedGeneration: generation,
+			LastTransitionTime: metav1.NewTime(c.now()),
+			Reason:             reason,
+			Message:            msg,
+		})
+	}
+
+	if len(errs) == 0 {
+		set(configV1beta1.ConditionValid, metav1.ConditionTrue, ReasonValid, "")
+	} else {
+		var msgs []string
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		set(configV1beta1.ConditionValid, metav1.ConditionFalse, ReasonInvalid, strings.Join(msgs, "; "))
+	}
+
+	switch state {
+	case renderedCurrent:
+		set(configV1beta1.ConditionRendered, metav1.ConditionTrue, ReasonRendered, "")
+		set(configV1beta1.ConditionLoaded, load.Status, load.Reason, load.Message)
+	case renderedStale:
+		set(configV1beta1.ConditionRendered, metav1.ConditionFalse, ReasonStale, "the spec is invalid, the last valid configuration is rendered in its place")
+		set(configV1beta1.ConditionLoaded, load.Status, load.Reason, load.Message)
+	default:
+		set(configV1beta1.ConditionRendered, metav1.ConditionFalse, ReasonNotRendered, "the spec is invalid and there is no valid configuration to render in its place")
+		set(configV1beta1.ConditionLoaded, metav1.ConditionFalse, ReasonNotRendered, "")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	conf "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+func TestSetConditions(t *testing.T) {
+	now := testNow
+	c := &Controller{now: func() time.Time { return now }}
+
+	var conds []metav1.Condition
+	c.setConditions(&conds, 1, renderedCurrent, unconfirmedLoad, nil)
+
+	now = now.Add(time.Minute)
+	c.setConditions(&conds, 2, renderedStale, unconfirmedLoad, []error{errors.New("bad spec")})
+
+	valid := meta.FindStatusCondition(conds, conf.ConditionValid)
+	if valid.Status != metav1.ConditionFalse || valid.Message != "bad spec" || valid.ObservedGeneration != 2 {
+		t.Errorf("unexpected valid condition, %#v", valid)
+	}
+	if !valid.LastTransitionTime.Time.Equal(now) {
+		t.Errorf("expected valid condition to transition at %v, got %v", now, valid.LastTransitionTime)
+	}
+
+	rendered := meta.FindStatusCondition(conds, conf.ConditionRendered)
+	if rendered.Status != metav1.ConditionFalse || rendered.Reason != ReasonStale {
+		t.Errorf("unexpected rendered condition, %#v", rendered)
+	}
+
+	loaded := meta.FindStatusCondition(conds, conf.ConditionLoaded)
+	if !loaded.LastTransitionTime.Time.Equal(testNow) {
+		t.Errorf("expected unchanged loaded condition to keep its transition time, got %v", loaded.LastTransitionTime)
+	}
+
+	now = now.Add(time.Minute)
+	c.setConditions(&conds, 3, notRendered, unconfirmedLoad, []error{errors.New("other error")})
+	if len(conds) != 3 {
+		t.Fatalf("expected 3 conditions, got %d", len(conds))
+	}
+	if valid := meta.FindStatusCondition(conds, conf.ConditionValid); valid.Message != "other error" {
+		t.Errorf("expected valid condition to reflect only the current errors, got %q", valid.Message)
+	}
+	if loaded := meta.FindStatusCondition(conds, conf.ConditionLoaded); loaded.Status != metav1.ConditionFalse {
+		t.Errorf("expected loaded condition to be false, got %#v", loaded)
+	}
+}
@@ -19,11 +19,7 @@ package main
 import (
 	"bytes"
 	"context"
-	"crypto/sha1"
-	"encoding/base64"
 	"fmt"
-	"io/ioutil"
-	"os"
 	"reflect"
 	"sort"
 	"text/template"
@@ -37,6 +33,7 @@ import (
 	yaml "gopkg.in/yaml.v2"
 
 	corev1 "k8s.io/api/core/v1"
+	apiextclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
@@ -50,6 +47,7 @@ import (
 	"k8s.io/client-go/util/workqueue"
 
 	configV1beta1 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+	configV1beta2 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta2"
 	clientset "github.com/QubitProducts/prom-config-controller/pkg/client/clientset/versioned"
 	configScheme "github.com/QubitProducts/prom-config-controller/pkg/client/clientset/versioned/scheme"
 	informers "github.com/QubitProducts/prom-config-controller/pkg/client/informers/externalversions"
@@ -69,12 +67,25 @@ const (
 	// to sync due to a Deployment of the same name already existing.
 	ErrResourceInvalid = "ErrResourceInvalid"
 
+	// ErrResourceConflict is used as part of the Event 'reason' when a conf
+	// is left out of the rendered config because it conflicts with another.
+	ErrResourceConflict = "ErrResourceConflict"
+
 	// MessageResourceExists is the message used for Events when a resource
 	// fails to sync due to a Deployment already existing
 	MessageResourceExists = "Resource %q already exists and is not managed by conf"
 	// MessageResourceSynced is the message used for an Event fired when a conf
 	// is synced successfully
 	MessageResourceSynced = "conf synced successfully"
+	// MessagePartiallySynced is the message used for an Event fired when
+	// part of a conf is invalid, and the rest is synced
+	MessagePartiallySynced = "conf synced with invalid parts left out, %s"
+	// MessageResourceStale is the message used for an Event fired when a
+	// conf is invalid and its last valid config is synced in its place
+	MessageResourceStale = "conf is invalid, its last valid config is synced in its place, %s"
+	// MessageResourceDropped is the message used for an Event fired when a
+	// conf is left out of the rendered config
+	MessageResourceDropped = "conf is not synced, %s"
 )
 
 // ControllerConfig describes the controller config
@@ -96,6 +107,84 @@ type ControllerConfig struct {
 	ConfigSecretKey string
 	ConfigFile      string
 	ConfigTemplate  *template.Template
+
+	JobNamePolicy   string
+	JobNameTemplate *template.Template
+
+	// NamespaceIsolation restricts scrapes to targets in their own
+	// namespace.
+	NamespaceIsolation bool
+
+	// ScrapeFiles are the files, and directories ending in /, that exist
+	// in the prometheus pods. If set, scrapes can only refer to these
+	// files, or files within these directories.
+	ScrapeFiles []string
+
+	// RuleNamespaceIsolation restricts the expressions of rules to series
+	// from their own namespace, except for rule groups in the exempt
+	// namespaces, or labelled or annotated with RuleIsolationExemptKey set
+	// to "true".
+	RuleNamespaceIsolation        bool
+	RuleIsolationExemptNamespaces []string
+	RuleIsolationExemptKey        string
+
+	// RuleLintDeny promotes the lints, applied to rule groups at
+	// admission, from warnings to denials, by namespace. The namespace and
+	// lint may be * for all namespaces or lints.
+	RuleLintDeny map[string][]string
+	// RuleLintMaxLookback is the furthest back that rule expressions can
+	// look without a warning, or zero for no limit.
+	RuleLintMaxLookback time.Duration
+
+	// LoadChecker, if set, is used to confirm that prometheus has loaded
+	// the rendered configuration, failing it if it is not loaded within
+	// LoadTimeout.
+	LoadChecker LoadChecker
+	LoadTimeout time.Duration
+
+	// MetricChecker, if set, is used to warn about rules that select
+	// metrics with no series, at admission and in the MetricsFound
+	// condition of rule groups.
+	MetricChecker MetricChecker
+
+	// RuleShardBy is the policy used to split the rendered rules across
+	// several ConfigMaps, each kept within RuleShardSize bytes. When rules
+	// are sharded, a rule_files glob matching the shards mounted in
+	// RuleShardDir is added to the rendered config.
+	RuleShardBy   string
+	RuleShardSize int
+	RuleShardDir  string
+
+	// RuleDir, if set, is a directory each rule group is written to as
+	// <namespace>/<name>.yaml, instead of RuleConfigMap and RuleFile. A
+	// rule_files glob matching them is added to the rendered config.
+	RuleDir string
+
+	// Files control how the rules and config files are written.
+	Files FileOptions
+
+	// RulesSinks are also sent the rendered rules, failures are retried
+	// without affecting the rules ConfigMap and files.
+	RulesSinks []RulesSink
+
+	// RenderDelay is how long changes are collected for before they are
+	// rendered together.
+	RenderDelay time.Duration
+
+	// AlertmanagerTemplate, if set, is the base alertmanager config that
+	// the routes and receivers of alert routes are added to. The result is
+	// written to the alertmanager secret and file, and AlertmanagerReloader
+	// is used to reload alertmanager when it changes.
+	AlertmanagerTemplate  *template.Template
+	AlertmanagerSecretNS  string
+	AlertmanagerSecret    string
+	AlertmanagerSecretKey string
+	AlertmanagerFile      string
+	AlertmanagerReloader  Reloader
+
+	// Silencer, if set, is used to put the silences of Silence resources
+	// in place in alertmanager.
+	Silencer Silencer
 }
 
 // Controller describes the controller implementation for conf resources
@@ -105,6 +194,7 @@ type Controller struct {
 
 	kubeclientset kubernetes.Interface
 	confclientset clientset.Interface
+	crdclientset  apiextclientset.Interface
 
 	rulesLister listers.RuleGroupLister
 	rulesSynced cache.InformerSynced
@@ -112,11 +202,39 @@ type Controller struct {
 	scrapesLister listers.ScrapeLister
 	scrapesSynced cache.InformerSynced
 
-	rulesWorkqueue   workqueue.RateLimitingInterface
-	scrapesWorkqueue workqueue.RateLimitingInterface
-	recorder         record.EventRecorder
+	alertRoutesLister listers.AlertRouteLister
+	alertRoutesSynced cache.InformerSynced
+
+	inhibitRulesLister listers.InhibitRuleLister
+	inhibitRulesSynced cache.InformerSynced
+
+	silencesLister listers.SilenceLister
+	silencesSynced cache.InformerSynced
+
+	rulesWorkqueue        workqueue.RateLimitingInterface
+	scrapesWorkqueue      workqueue.RateLimitingInterface
+	alertRoutesWorkqueue  workqueue.RateLimitingInterface
+	inhibitRulesWorkqueue workqueue.RateLimitingInterface
+	silencesWorkqueue     workqueue.RateLimitingInterface
+	renderWorkqueue       workqueue.RateLimitingInterface
+	recorder              record.EventRecorder
+	events                *eventDedup
 
 	clusterLister clusterLister
+
+	rules        *ruleModel
+	scrapes      *scrapeModel
+	alertRoutes  *alertRouteModel
+	inhibitRules *inhibitRuleModel
+
+	configLoads *loadTracker
+	rulesLoads  *loadTracker
+
+	// base is the last rendered base config, that scrapes are validated
+	// against.
+	base baseConfig
+
+	now func() time.Time
 }
 
 // NewController returns a new sample controller
@@ -124,6 +242,7 @@ func NewController(
 	cfg ControllerConfig,
 	kubeclientset kubernetes.Interface,
 	confclientset clientset.Interface,
+	crdclientset apiextclientset.Interface,
 	confInformerFactory informers.SharedInformerFactory,
 	reloader Reloader,
 	clusterLister clusterLister,
@@ -143,16 +262,29 @@ func NewController(
 		Reloader:         reloader,
 		ControllerConfig: cfg,
 
-		kubeclientset:    kubeclientset,
-		confclientset:    confclientset,
-		rulesLister:      rulesInformer.Lister(),
-		rulesSynced:      rulesInformer.Informer().HasSynced,
-		scrapesLister:    scrapesInformer.Lister(),
-		scrapesSynced:    scrapesInformer.Informer().HasSynced,
-		rulesWorkqueue:   workqueue.NewNamedRateLimitingQueue(workqueue.DefaultItemBasedRateLimiter(), "rules"),
-		scrapesWorkqueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultItemBasedRateLimiter(), "scrapes"),
-		recorder:         recorder,
-		clusterLister:    clusterLister,
+		kubeclientset:         kubeclientset,
+		confclientset:         confclientset,
+		crdclientset:          crdclientset,
+		rulesLister:           rulesInformer.Lister(),
+		rulesSynced:           rulesInformer.Informer().HasSynced,
+		scrapesLister:         scrapesInformer.Lister(),
+		scrapesSynced:         scrapesInformer.Informer().HasSynced,
+		rulesWorkqueue:        workqueue.NewNamedRateLimitingQueue(workqueue.DefaultItemBasedRateLimiter(), "rules"),
+		scrapesWorkqueue:      workqueue.NewNamedRateLimitingQueue(workqueue.DefaultItemBasedRateLimiter(), "scrapes"),
+		alertRoutesWorkqueue:  workqueue.NewNamedRateLimitingQueue(workqueue.DefaultItemBasedRateLimiter(), "alertroutes"),
+		inhibitRulesWorkqueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultItemBasedRateLimiter(), "inhibitrules"),
+		silencesWorkqueue:     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultItemBasedRateLimiter(), "silences"),
+		renderWorkqueue:       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultItemBasedRateLimiter(), "render"),
+		recorder:              recorder,
+		events:                newEventDedup(),
+		clusterLister:         clusterLister,
+		rules:                 newRuleModel(),
+		scrapes:               newScrapeModel(),
+		alertRoutes:           newAlertRouteModel(),
+		inhibitRules:          newInhibitRuleModel(),
+		configLoads:           newLoadTracker(),
+		rulesLoads:            newLoadTracker(),
+		now:                   time.Now,
 	}
 
 	glog.Info("Setting up event handlers")
@@ -172,6 +304,46 @@ func NewController(
 		},
 	})
 
+	// Alert routes and inhibit rules are only watched when an alertmanager
+	// config is rendered, and silences when they are put in place, so their
+	// CRDs are not required otherwise.
+	if controller.alerting() {
+		alertRoutesInformer := confInformerFactory.Config().V1beta1().AlertRoutes()
+		controller.alertRoutesLister = alertRoutesInformer.Lister()
+		controller.alertRoutesSynced = alertRoutesInformer.Informer().HasSynced
+		alertRoutesInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    controller.enqueuealertroute,
+			DeleteFunc: controller.enqueuealertroute,
+			UpdateFunc: func(old, new interface{}) {
+				controller.enqueuealertroute(new)
+			},
+		})
+
+		inhibitRulesInformer := confInformerFactory.Config().V1beta1().InhibitRules()
+		controller.inhibitRulesLister = inhibitRulesInformer.Lister()
+		controller.inhibitRulesSynced = inhibitRulesInformer.Informer().HasSynced
+		inhibitRulesInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    controller.enqueueinhibitrule,
+			DeleteFunc: controller.enqueueinhibitrule,
+			UpdateFunc: func(old, new interface{}) {
+				controller.enqueueinhibitrule(new)
+			},
+		})
+	}
+
+	if controller.Silencer != nil {
+		silencesInformer := confInformerFactory.Config().V1beta1().Silences()
+		controller.silencesLister = silencesInformer.Lister()
+		controller.silencesSynced = silencesInformer.Informer().HasSynced
+		silencesInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    controller.enqueuesilence,
+			DeleteFunc: controller.enqueuesilence,
+			UpdateFunc: func(old, new interface{}) {
+				controller.enqueuesilence(new)
+			},
+		})
+	}
+
 	return controller
 }
 
@@ -182,14 +354,28 @@ func (c *Controller) Run(stopCh <-chan struct{}) error {
 	defer runtime.HandleCrash()
 	defer c.rulesWorkqueue.ShutDown()
 	defer c.scrapesWorkqueue.ShutDown()
+	defer c.alertRoutesWorkqueue.ShutDown()
+	defer c.inhibitRulesWorkqueue.ShutDown()
+	defer c.silencesWorkqueue.ShutDown()
+	defer c.renderWorkqueue.ShutDown()
 
 	glog.Info("self registering validation webhook")
 	if err := c.selfRegistration(); err != nil {
 		glog.Errorf("registering webhook failed, %v", err)
 	}
+	if err := c.registerConversion(); err != nil {
+		glog.Errorf("registering conversion webhook failed, %v", err)
+	}
 
 	glog.Info("Waiting for informer caches to sync")
-	if ok := cache.WaitForCacheSync(stopCh, c.rulesSynced, c.scrapesSynced); !ok {
+	synced := []cache.InformerSynced{c.rulesSynced, c.scrapesSynced}
+	if c.alerting() {
+		synced = append(synced, c.alertRoutesSynced, c.inhibitRulesSynced)
+	}
+	if c.Silencer != nil {
+		synced = append(synced, c.silencesSynced)
+	}
+	if ok := cache.WaitForCacheSync(stopCh, synced...); !ok {
 		glog.Errorf("failed waiting for cache sync")
 		return fmt.Errorf("caches did not sync")
 	}
@@ -209,8 +395,26 @@ func (c *Controller) Run(stopCh <-chan struct{}) error {
 		c.Reloader.Reload()
 	}
 
+	alertsChanged, err := c.syncAlertmanagerHandler()
+	if err != nil {
+		glog.Errorf("intial alertmanager config sync failed, %v", err)
+	}
+	if alertsChanged && c.AlertmanagerReloader != nil {
+		glog.Infof("the alertmanager configuration has changed, issuing reload")
+		c.AlertmanagerReloader.Reload()
+	}
+
+	if err := c.syncSilenceHandler(); err != nil {
+		glog.Errorf("intial silences sync failed, %v", err)
+	}
+
 	go wait.Until(c.runRulesWorker, time.Second, stopCh)
 	go wait.Until(c.runConfigWorker, time.Second, stopCh)
+	go wait.Until(c.runAlertRoutesWorker, time.Second, stopCh)
+	go wait.Until(c.runInhibitRulesWorker, time.Second, stopCh)
+	go wait.Until(c.runSilencesWorker, time.Second, stopCh)
+	go wait.Until(c.runRenderWorker, time.Second, stopCh)
+	go wait.Until(c.runLoadChecker, 5*time.Second, stopCh)
 
 	glog.Info("Started workers")
 	<-stopCh
@@ -220,7 +424,7 @@ func (c *Controller) Run(stopCh <-chan struct{}) error {
 }
 
 func (c *Controller) runRulesWorker() {
-	processRule := makeProcessNextWorkItem(c.rulesWorkqueue, c.syncRuleHandler, c.Reloader)
+	processRule := makeProcessNextWorkItem(c.rulesWorkqueue, c.syncRuleGroup)
 	for processRule() {
 	}
 
@@ -228,17 +432,24 @@ func (c *Controller) runRulesWorker() {
 }
 
 func (c *Controller) runConfigWorker() {
-	processScrape := makeProcessNextWorkItem(c.scrapesWorkqueue, c.syncConfigHandler, c.Reloader)
+	processScrape := makeProcessNextWorkItem(c.scrapesWorkqueue, c.syncScrape)
 	for processScrape() {
 	}
 
 	glog.Info("scrapes worker stopped")
 }
 
+func (c *Controller) runRenderWorker() {
+	processRender := makeProcessNextWorkItem(c.renderWorkqueue, c.render)
+	for processRender() {
+	}
+
+	glog.Info("render worker stopped")
+}
+
 func makeProcessNextWorkItem(
 	workqueue workqueue.RateLimitingInterface,
-	sync func() (bool, error),
-	reloader Reloader) func() bool {
+	sync func(key string) error) func() bool {
 	return func() bool {
 		obj, shutdown := workqueue.Get()
 
@@ -256,16 +467,12 @@ func makeProcessNextWorkItem(
 				runtime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
 				return nil
 			}
-			reload, err := sync()
-			if err != nil {
-				glog.Infof("error syncing config, %v", err)
+			if err := sync(key); err != nil {
+				glog.Infof("error syncing %s, %v", key, err)
+				workqueue.AddRateLimited(key)
 				return fmt.Errorf("error syncing %s, %v", key, err.Error())
 			}
 			workqueue.Forget(obj)
-			if reload && reloader != nil {
-				glog.Infof("the configuration has changed, issuing reload")
-				reloader.Reload()
-			}
 			glog.V(2).Infof("Successfully synced '%s'", key)
 			return nil
 		}(obj)
@@ -279,38 +486,60 @@ func makeProcessNextWorkItem(
 	}
 }
 
+// syncRuleHandler reconciles every rule group, and renders the rules.
 func (c *Controller) syncRuleHandler() (bool, error) {
-	groupKeys := []string{}
-	groups := map[string]*rulefmt.RuleGroup{}
 	rr, err := c.rulesLister.RuleGroups(c.Namespace).List(c.Selector)
 	if err != nil {
 		return false, errors.Wrap(err, "listing rules")
 	}
 
+	seen := map[string]bool{}
 	for _, r := range rr {
-		var rerrs []error
 		var key string
 		if key, err = cache.MetaNamespaceKeyFunc(r); err != nil {
 			runtime.HandleError(err)
 			continue
 		}
+		seen[key] = true
+		c.reconcileRuleGroup(key, r)
+	}
 
-		var res *rulefmt.RuleGroup
-		res, rerrs = convertRuleGroup(r.GetName(), r)
-
-		c.updatergstatus(r, rerrs)
-		for _, err := range rerrs {
-			glog.Infof("rule error in %v: %v", key, err)
+	for _, key := range c.rules.keys() {
+		if !seen[key] {
+			c.forgetRuleGroup(key)
 		}
-
-		groups[key] = res
-		groupKeys = append(groupKeys, key)
 	}
 
+	return c.renderRules()
+}
+
+// renderRules renders the rule groups in the rules model.
+func (c *Controller) renderRules() (bool, error) {
 	final := &rulefmt.RuleGroups{}
-	sort.Strings(groupKeys)
-	for _, k := range groupKeys {
-		final.Groups = append(final.Groups, *groups[k])
+	pieces := map[string]string{}
+	var keys []string
+
+	c.rules.Lock()
+	for k, v := range c.rules.pieces {
+		pieces[k] = v
+	}
+	recorded := map[string]bool{}
+	for _, k := range sortedKeys(pieces) {
+		if g, ok := c.rules.groups[k]; ok {
+			final.Groups = append(final.Groups, *g)
+			keys = append(keys, k)
+			for _, r := range g.Rules {
+				if r.Record != "" {
+					recorded[r.Record] = true
+				}
+			}
+		}
+	}
+	c.rules.recorded = recorded
+	c.rules.Unlock()
+
+	if len(c.RulesSinks) > 0 {
+		c.queueRender(renderSinksKey)
 	}
 
 	bs, err := yaml.Marshal(final)
@@ -318,20 +547,46 @@ func (c *Controller) syncRuleHandler() (bool, error) {
 		return false, errors.Wrap(err, "rendering rules yaml")
 	}
 
-	cmUpdated, err := c.updateConfigMap(c.RuleConfigMap, c.RuleConfigMapKey, c.RuleConfigMapNS, bs)
+	if c.LoadChecker != nil {
+		c.rulesLoads.rendered(configHash(bs), pieces, c.now(), func(ctx context.Context, since time.Time) error {
+			return c.LoadChecker.RulesLoaded(ctx, since, final)
+		})
+	}
+
+	// Rule groups written to RuleDir are not also written to the rules
+	// ConfigMap or file, prometheus would load them twice.
+	var cmUpdated bool
+	switch {
+	case c.RuleDir != "":
+		cmUpdated, err = c.deleteRuleConfigMaps(nil)
+	case c.sharding():
+		cmUpdated, err = c.updateRuleShards(keys, final.Groups)
+	default:
+		cmUpdated, err = c.updateConfigMap(c.RuleConfigMap, c.RuleConfigMapKey, c.RuleConfigMapNS, nil, bs)
+	}
 	if err != nil {
 		return false, errors.Wrap(err, "udpate rules configmap")
 	}
 
-	fileChanged, err := updateFile(c.RuleFile, bs)
+	var fileChanged bool
+	if c.RuleDir != "" || c.sharding() {
+		fileChanged, err = c.removeRuleFile()
+	} else {
+		fileChanged, err = updateFile(c.RuleFile, bs, c.Files)
+	}
 	if err != nil {
 		return cmUpdated, errors.Wrap(err, "update rules file")
 	}
 
-	return cmUpdated || fileChanged, nil
+	dirChanged, err := c.updateRuleDir(keys, final.Groups)
+	if err != nil {
+		return cmUpdated || fileChanged, errors.Wrap(err, "update rules directory")
+	}
+
+	return cmUpdated || fileChanged || dirChanged, nil
 }
 
-func (c *Controller) updateConfigMap(name, key, namespace string, bs []byte) (bool, error) {
+func (c *Controller) updateConfigMap(name, key, namespace string, lbls map[string]string, bs []byte) (bool, error) {
 	ctx := context.Background()
 	if name == "" || key == "" {
 		return false, nil
@@ -343,6 +598,7 @@ func (c *Controller) updateConfigMap(name, key, namespace string, bs []byte) (bo
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      name,
 				Namespace: namespace,
+				Labels:    lbls,
 			},
 			Data: map[string]string{},
 		}
@@ -356,7 +612,14 @@ func (c *Controller) updateConfigMap(name, key, namespace string, bs []byte) (bo
 		return false, err
 	}
 
-	if bytes.Compare([]byte(oldcm.Data[key]), bs) == 0 {
+	labelled := true
+	for k, v := range lbls {
+		if oldcm.Labels[k] != v {
+			labelled = false
+		}
+	}
+
+	if bytes.Compare([]byte(oldcm.Data[key]), bs) == 0 && labelled {
 		return false, nil
 	}
 
@@ -366,6 +629,12 @@ func (c *Controller) updateConfigMap(name, key, namespace string, bs []byte) (bo
 	if newcm.Data == nil {
 		newcm.Data = make(map[string]string)
 	}
+	if !labelled && newcm.Labels == nil {
+		newcm.Labels = make(map[string]string)
+	}
+	for k, v := range lbls {
+		newcm.Labels[k] = v
+	}
 
 	newcm.Data[key] = string(bs)
 	_, err = c.kubeclientset.CoreV1().ConfigMaps(namespace).Update(ctx, newcm, metav1.UpdateOptions{})
@@ -375,7 +644,37 @@ func (c *Controller) updateConfigMap(name, key, namespace string, bs []byte) (bo
 	return true, nil
 }
 
+// syncConfigHandler reconciles every scrape, and renders the scrape config.
 func (c *Controller) syncConfigHandler() (bool, error) {
+	ss, err := c.scrapesLister.Scrapes(c.Namespace).List(c.Selector)
+	if err != nil {
+		return false, err
+	}
+
+	seen := map[string]bool{}
+	for _, s := range ss {
+		var key string
+		if key, err = cache.MetaNamespaceKeyFunc(s); err != nil {
+			runtime.HandleError(err)
+			continue
+		}
+		seen[key] = true
+		c.reconcileScrape(key, s)
+	}
+
+	for _, key := range c.scrapes.keys() {
+		if !seen[key] {
+			c.forgetScrape(key)
+		}
+	}
+
+	return c.renderScrapes()
+}
+
+// renderScrapes renders the base config and the scrapes in the scrape model.
+// The status of scrapes that have changed, or whose rendering has changed, is
+// updated.
+func (c *Controller) renderScrapes() (bool, error) {
 	var configStr string
 	if c.ConfigTemplate != nil {
 		templateData := struct {
@@ -402,37 +701,108 @@ func (c *Controller) syncConfigHandler() (bool, error) {
 	if err != nil {
 		return false, errors.Wrap(err, "checking config template result")
 	}
+	c.setBaseConfig(basePromCfg)
+
+	for _, glob := range []string{c.ruleShardGlob(), c.ruleDirGlob()} {
+		if glob == "" {
+			continue
+		}
+		found := false
+		for _, rf := range basePromCfg.RuleFiles {
+			found = found || rf == glob
+		}
+		if !found {
+			basePromCfg.RuleFiles = append(basePromCfg.RuleFiles, glob)
+		}
+	}
+
+	// Job names used by the base config can not be claimed by a scrape.
+	jobOwners := map[string]string{}
+	for _, sc := range basePromCfg.ScrapeConfigs {
+		jobOwners[sc.JobName] = "the base configuration"
+	}
 
 	scrapeKeys := []string{}
 	scrapes := map[string]*promconfig.ScrapeConfig{}
-	ss, err := c.scrapesLister.Scrapes(c.Namespace).List(c.Selector)
-	if err != nil {
-		return false, err
+	pieces := map[string]string{}
+
+	// Status updates are made once the model is unlocked, so that
+	// reconciling scrapes does not wait on the API server.
+	type statusUpdate struct {
+		key     string
+		e       *scrapeEntry
+		obj     *configV1beta1.Scrape
+		ps      *promconfig.ScrapeConfig
+		state   renderState
+		piece   string
+		errs    []error
+		outcome string
 	}
+	var updates []statusUpdate
 
-	for _, s := range ss {
-		var key string
-		if key, err = cache.MetaNamespaceKeyFunc(s); err != nil {
-			runtime.HandleError(err)
-			continue
-		}
-
-		var serr error
-		ps, serr := convertScrape(s.GetName(), s)
+	c.scrapes.Lock()
+	keys, entries := c.scrapes.sorted()
+	for i, e := range entries {
+		key, s := keys[i], e.obj
 
-		var errs []error
-		if serr != nil {
-			errs = []error{serr}
+		ps, errs := e.ps, e.errs
+		if len(errs) == 0 {
+			if owner, ok := jobOwners[ps.JobName]; ok {
+				errs = []error{&conflictError{JobName: ps.JobName, Owner: owner}}
+			}
 		}
 
-		c.updatescrapestatus(s, errs)
+		rendered := ps
+		state := renderedCurrent
 		if len(errs) > 0 {
+			rendered = nil
+			state = notRendered
+			if last := lastValidScrape(key, s); last != nil {
+				if _, ok := jobOwners[last.JobName]; !ok {
+					glog.V(2).Infof("rendering last valid config of %v", key)
+					rendered = last
+					state = renderedStale
+				}
+			}
+		}
+		if state == renderedStale {
+			staleScrapes.WithLabelValues(s.Namespace, s.Name).Set(1)
+		} else {
+			staleScrapes.DeleteLabelValues(s.Namespace, s.Name)
+		}
+
+		piece := pieceHash(rendered)
+		pieces[key] = piece
+
+		outcome := fmt.Sprintf("%d %s %v", state, piece, errs)
+		if e.dirty || outcome != e.outcome {
+			updates = append(updates, statusUpdate{key, e, s, ps, state, piece, errs, outcome})
+		}
+		if rendered == nil {
 			continue
 		}
 
-		scrapes[key] = ps
+		jobOwners[rendered.JobName] = key
+		scrapes[key] = rendered
 		scrapeKeys = append(scrapeKeys, key)
 	}
+	c.scrapes.Unlock()
+
+	for _, u := range updates {
+		if err := c.updatescrapestatus(u.obj, u.ps, u.state, c.configLoads.status(u.key, u.piece), u.errs); err != nil {
+			glog.Infof("updating status of %s failed, %v", u.key, err)
+		} else {
+			// The scrape may have been reconciled again meanwhile, in
+			// which case it is left dirty.
+			c.scrapes.Lock()
+			if u.e.obj == u.obj {
+				u.e.dirty = false
+				u.e.outcome = u.outcome
+			}
+			c.scrapes.Unlock()
+		}
+		c.recordSyncEvent(u.obj, u.state, u.errs)
+	}
 
 	sort.Strings(scrapeKeys)
 	var scrapeList []*promconfig.ScrapeConfig
@@ -447,12 +817,18 @@ func (c *Controller) syncConfigHandler() (bool, error) {
 		return false, errors.Wrap(err, "convert config")
 	}
 
+	if c.LoadChecker != nil {
+		c.configLoads.rendered(configHash(bs), pieces, c.now(), func(ctx context.Context, since time.Time) error {
+			return c.LoadChecker.ConfigLoaded(ctx, since, bs)
+		})
+	}
+
 	secUpdated, err := c.updateSecret(c.ConfigSecret, c.ConfigSecretKey, c.ConfigSecretNS, bs)
 	if err != nil {
 		return false, errors.Wrap(err, "udpate config secret")
 	}
 
-	fileChanged, err := updateFile(c.ConfigFile, bs)
+	fileChanged, err := updateFile(c.ConfigFile, bs, c.Files)
 	if err != nil {
 		return secUpdated, errors.Wrap(err, "update config file")
 	}
@@ -504,57 +880,53 @@ func (c *Controller) updateSecret(name, key, namespace string, bs []byte) (bool,
 	return true, nil
 }
 
-func updateFile(fn string, bs []byte) (bool, error) {
-	if fn == "" {
-		return false, nil
-	}
-
-	obs, err := ioutil.ReadFile(fn)
-	if err != nil && !os.IsNotExist(err) {
-		glog.V(3).Infof("err reading file, %v", err)
-
-		return false, err
-	}
-
-	osha := sha1.Sum(obs)
-	nsha := sha1.Sum(bs)
-	if bytes.Compare(osha[:], nsha[:]) == 0 {
-		return false, nil
-	}
-
-	glog.V(1).Infof("fn: %s old: %s new: %s",
-		fn,
-		base64.StdEncoding.EncodeToString(osha[:]),
-		base64.StdEncoding.EncodeToString(nsha[:]))
-
-	glog.Infof("file %s changed, updating", fn)
-
-	return true, errors.Wrap(ioutil.WriteFile(fn, bs, 0644), "writing config file")
-}
-
-func (c *Controller) updatergstatus(org *configV1beta1.RuleGroup, errs []error) error {
+func (c *Controller) updatergstatus(org *configV1beta1.RuleGroup, res *rulefmt.RuleGroup, state renderState, load loadStatus, errs []error) error {
 	ctx := context.Background()
 	var err error
 
 	rg := org.DeepCopy()
+	rg.Status.Errors = nil
+	rg.Status.RuleErrors = nil
 	for _, err := range errs {
 		rg.Status.Errors = append(rg.Status.Errors, err.Error())
+		if rerr, ok := err.(*ruleError); ok {
+			rg.Status.RuleErrors = append(rg.Status.RuleErrors, configV1beta1.RuleError{
+				Index:  rerr.Index,
+				Name:   rerr.Name,
+				Reason: rerr.Err.Error(),
+			})
+		}
 	}
 	rg.Status.ErrorCount = len(rg.Status.Errors)
 
+	if len(errs) == 0 && res != nil {
+		bs, err := yaml.Marshal(res)
+		if err != nil {
+			return errors.Wrap(err, "rendering last valid config")
+		}
+		rg.Status.LastValidConfig = string(bs)
+	}
+
+	// Only the rules that are rendered are counted.
 	rcount := 0
 	acount := 0
-	for _, r := range rg.Spec.Rules {
-		if r.Record != "" {
-			rcount++
-		}
-		if r.Alert != "" {
-			acount++
+	if res != nil {
+		for _, r := range res.Rules {
+			if r.Record != "" {
+				rcount++
+			}
+			if r.Alert != "" {
+				acount++
+			}
 		}
 	}
 
 	rg.Status.RecordingRuleCount = rcount
 	rg.Status.AlertRuleCount = acount
+	rg.Status.ObservedGeneration = rg.Generation
+	c.setConditions(&rg.Status.Conditions, rg.Generation, state, load, errs)
+	c.setMetricsCondition(rg)
+	c.setTestsCondition(rg)
 	if !reflect.DeepEqual(org.Status, rg.Status) {
 		_, err = c.confclientset.ConfigV1beta1().RuleGroups(rg.Namespace).UpdateStatus(ctx, rg, metav1.UpdateOptions{})
 	}
@@ -562,16 +934,28 @@ func (c *Controller) updatergstatus(org *configV1beta1.RuleGroup, errs []error)
 	return err
 }
 
-func (c *Controller) updatescrapestatus(os *configV1beta1.Scrape, errs []error) error {
+func (c *Controller) updatescrapestatus(os *configV1beta1.Scrape, ps *promconfig.ScrapeConfig, state renderState, load loadStatus, errs []error) error {
 	ctx := context.Background()
 	var err error
 	s := os.DeepCopy()
 
+	s.Status.Errors = nil
 	for _, err := range errs {
 		s.Status.Errors = append(s.Status.Errors, err.Error())
 	}
 	s.Status.ErrorCount = len(s.Status.Errors)
 
+	if len(errs) == 0 && ps != nil {
+		bs, err := yaml.Marshal(ps)
+		if err != nil {
+			return errors.Wrap(err, "rendering last valid config")
+		}
+		s.Status.LastValidConfig = string(bs)
+	}
+
+	s.Status.ObservedGeneration = s.Generation
+	c.setConditions(&s.Status.Conditions, s.Generation, state, load, errs)
+
 	if !reflect.DeepEqual(os.Status, s.Status) {
 		_, err = c.confclientset.ConfigV1beta1().Scrapes(s.Namespace).UpdateStatus(ctx, s, metav1.UpdateOptions{})
 	}
@@ -579,10 +963,42 @@ func (c *Controller) updatescrapestatus(os *configV1beta1.Scrape, errs []error)
 	return err
 }
 
+// convertScrapeConfig converts s to the scrape config to be rendered, applying
+// the job naming policy and namespace isolation.
+func (c *Controller) convertScrapeConfig(s *configV1beta1.Scrape) (*promconfig.ScrapeConfig, []error) {
+	ps, err := convertScrape(s)
+	if err == nil {
+		ps.JobName, err = c.scrapeJobName(s, ps)
+	}
+	if err != nil {
+		return nil, []error{err}
+	}
+	if c.NamespaceIsolation {
+		if errs := isolateScrape(s.Namespace, ps); len(errs) > 0 {
+			return nil, errs
+		}
+	}
+	return ps, nil
+}
+
+// lastValidScrape returns the config last rendered from a valid spec of s,
+// or nil if there is none.
+func lastValidScrape(key string, s *configV1beta1.Scrape) *promconfig.ScrapeConfig {
+	if s.Status.LastValidConfig == "" {
+		return nil
+	}
+	last := &promconfig.ScrapeConfig{}
+	if err := yaml.Unmarshal([]byte(s.Status.LastValidConfig), last); err != nil {
+		glog.Infof("could not parse last valid config of %v, %v", key, err)
+		return nil
+	}
+	return last
+}
+
 func (c *Controller) enqueuerule(obj interface{}) {
 	var key string
 	var err error
-	if key, err = cache.MetaNamespaceKeyFunc(obj); err != nil {
+	if key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err != nil {
 		runtime.HandleError(err)
 		return
 	}
@@ -592,46 +1008,101 @@ func (c *Controller) enqueuerule(obj interface{}) {
 func (c *Controller) enqueuescrape(obj interface{}) {
 	var key string
 	var err error
-	if key, err = cache.MetaNamespaceKeyFunc(obj); err != nil {
+	if key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err != nil {
 		runtime.HandleError(err)
 		return
 	}
 	c.scrapesWorkqueue.AddRateLimited(key)
 }
 
-func convertRuleGroup(name string, conf *configV1beta1.RuleGroup) (*rulefmt.RuleGroup, []error) {
-	var err error
+// ruleError is an error in an individual rule of a rule group. Rules with
+// errors are left out of the rendered group, the rest of the group is still
+// rendered.
+type ruleError struct {
+	Index int
+	Name  string
+	Err   error
+}
 
+func (e *ruleError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("rule %d: %v", e.Index, e.Err)
+	}
+	return fmt.Sprintf("rule %d (%s): %v", e.Index, e.Name, e.Err)
+}
+
+// ruleCheck is applied to each successfully converted rule of a rule group.
+// It may modify the rule, and a rule for which it returns an error is
+// excluded from the group.
+type ruleCheck func(r *rulefmt.Rule) error
+
+// convertRuleGroup converts a rule group to the prometheus rule file format.
+// Invalid rules are reported as *ruleError and left out of the result. A nil
+// group is returned if the group as a whole is invalid, or has no valid
+// rules.
+func convertRuleGroup(name string, conf *configV1beta1.RuleGroup, checks ...ruleCheck) (*rulefmt.RuleGroup, []error) {
 	var interval model.Duration
 	if conf.Spec.Interval != "" {
+		var err error
 		interval, err = model.ParseDuration(conf.Spec.Interval)
-	}
-	if err != nil {
-		return nil, []error{errors.Wrap(err, "invalid interval")}
+		if err != nil {
+			return nil, []error{errors.Wrap(err, "invalid interval")}
+		}
 	}
 
 	var errs []error
 	var rules []rulefmt.Rule
 	for i, r := range conf.Spec.Rules {
+		name := r.Record
+		if r.Alert != "" {
+			name = r.Alert
+		}
+
+		rerr := func(err error) {
+			errs = append(errs, &ruleError{Index: i, Name: name, Err: err})
+		}
+
 		var rfor model.Duration
 		if r.For != "" {
-			rfor, err = model.ParseDuration(r.For)
-		}
-		if err != nil {
-			errs = append(errs, errors.Wrapf(err, "invalid for duration in rule %v", i))
-			continue
+			var err error
+			if rfor, err = model.ParseDuration(r.For); err != nil {
+				rerr(errors.Wrap(err, "invalid for duration"))
+				continue
+			}
 		}
-		rules = append(rules, rulefmt.Rule{
+
+		rule := rulefmt.Rule{
 			Alert:       r.Alert,
 			Expr:        r.Expr,
 			Record:      r.Record,
 			Labels:      r.Labels,
 			Annotations: r.Annotations,
 			For:         rfor,
-		})
+		}
+
+		if verrs := rule.Validate(); len(verrs) > 0 {
+			for _, err := range verrs {
+				rerr(err)
+			}
+			continue
+		}
+
+		failed := false
+		for _, check := range checks {
+			if err := check(&rule); err != nil {
+				rerr(err)
+				failed = true
+				break
+			}
+		}
+		if failed {
+			continue
+		}
+
+		rules = append(rules, rule)
 	}
 
-	if errs != nil {
+	if len(rules) == 0 && len(conf.Spec.Rules) > 0 {
 		return nil, errs
 	}
 
@@ -641,17 +1112,96 @@ func convertRuleGroup(name string, conf *configV1beta1.RuleGroup) (*rulefmt.Rule
 		Rules:    rules,
 	}
 
-	rgs := rulefmt.RuleGroups{Groups: []rulefmt.RuleGroup{rg}}
-	return &rg, rgs.Validate()
+	return &rg, errs
+}
+
+// convertScrape converts a scrape to a prometheus scrape config. The job_name
+// from the spec is kept, the controller's job naming policy is applied by
+// the caller.
+func convertScrape(conf *configV1beta1.Scrape) (*promconfig.ScrapeConfig, error) {
+	// A v1beta1 spec is treated as the raw form of a structured spec.
+	spec := configV1beta2.ScrapeSpec{Raw: string(conf.Spec)}
+	jobName := fmt.Sprintf("%s/%s", conf.Namespace, conf.Name)
+	return convertScrapeSpec(jobName, &spec)
+}
+
+// convertStructuredScrape converts a v1beta2 scrape to a prometheus scrape
+// config, as for convertScrape.
+func convertStructuredScrape(conf *configV1beta2.Scrape) (*promconfig.ScrapeConfig, error) {
+	jobName := fmt.Sprintf("%s/%s", conf.Namespace, conf.Name)
+	return convertScrapeSpec(jobName, &conf.Spec)
 }
 
-func convertScrape(name string, conf *configV1beta1.Scrape) (*promconfig.ScrapeConfig, error) {
+// convertScrapeSpec renders a structured scrape spec into a prometheus scrape
+// config. Structured fields are merged over any top level keys set in the
+// raw YAML, and the result is parsed by the prometheus config loader so that
+// the same validation is applied to both forms. jobName is used if neither
+// form provides one.
+func convertScrapeSpec(jobName string, spec *configV1beta2.ScrapeSpec) (*promconfig.ScrapeConfig, error) {
 	var pcfg promconfig.ScrapeConfig
-	err := yaml.Unmarshal([]byte(conf.Spec), &pcfg)
+
+	doc, structured, err := scrapeSpecDoc(spec)
 	if err != nil {
 		return nil, err
 	}
-	pcfg.JobName = fmt.Sprintf("%s/%s", conf.Namespace, conf.Name)
+
+	// Parse the raw form directly when it is used on its own, so that
+	// errors refer to the lines the user wrote.
+	if !structured {
+		if err = yaml.Unmarshal([]byte(spec.Raw), &pcfg); err != nil {
+			return nil, err
+		}
+		return &pcfg, nil
+	}
+
+	if _, ok := doc["job_name"]; !ok {
+		doc["job_name"] = jobName
+	}
+
+	bs, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "rendering scrape")
+	}
+	if err = yaml.Unmarshal(bs, &pcfg); err != nil {
+		return nil, err
+	}
 
 	return &pcfg, nil
 }
+
+// scrapeSpecDoc returns the top level keys of the raw form of spec, overlaid
+// with any structured fields. If no structured fields are set, false is
+// returned and the raw form is left for the caller to use as is.
+func scrapeSpecDoc(spec *configV1beta2.ScrapeSpec) (map[string]interface{}, bool, error) {
+	fields, err := structuredScrapeFields(spec)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(fields) == 0 {
+		return nil, false, nil
+	}
+
+	doc := map[string]interface{}{}
+	if err = yaml.Unmarshal([]byte(spec.Raw), &doc); err != nil {
+		return nil, false, errors.Wrap(err, "parsing raw scrape config")
+	}
+	for k, v := range fields {
+		doc[k] = v
+	}
+
+	return doc, true, nil
+}
+
+// structuredScrapeFields returns the structured fields set in spec, keyed
+// by their YAML names.
+func structuredScrapeFields(spec *configV1beta2.ScrapeSpec) (map[string]interface{}, error) {
+	sbs, err := yaml.Marshal(spec)
+	if err != nil {
+		return nil, errors.Wrap(err, "rendering structured scrape")
+	}
+	fields := map[string]interface{}{}
+	if err = yaml.Unmarshal(sbs, &fields); err != nil {
+		return nil, errors.Wrap(err, "rendering structured scrape")
+	}
+	return fields, nil
+}
@@ -22,6 +22,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	yaml "gopkg.in/yaml.v2"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -36,6 +37,7 @@ import (
 	"k8s.io/client-go/tools/record"
 
 	conf "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+	confV1beta2 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta2"
 	"github.com/QubitProducts/prom-config-controller/pkg/client/clientset/versioned/fake"
 	informers "github.com/QubitProducts/prom-config-controller/pkg/client/informers/externalversions"
 )
@@ -43,8 +45,35 @@ import (
 var (
 	alwaysReady        = func() bool { return true }
 	noResyncPeriodFunc = func() time.Duration { return 0 }
+	testNow            = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
 )
 
+// renderedConditions are the conditions of an object whose current spec is
+// rendered.
+func renderedConditions() []metav1.Condition {
+	return []metav1.Condition{
+		{
+			Type:               conf.ConditionValid,
+			Status:             metav1.ConditionTrue,
+			LastTransitionTime: metav1.NewTime(testNow),
+			Reason:             ReasonValid,
+		},
+		{
+			Type:               conf.ConditionRendered,
+			Status:             metav1.ConditionTrue,
+			LastTransitionTime: metav1.NewTime(testNow),
+			Reason:             ReasonRendered,
+		},
+		{
+			Type:               conf.ConditionLoaded,
+			Status:             metav1.ConditionUnknown,
+			LastTransitionTime: metav1.NewTime(testNow),
+			Reason:             ReasonUnconfirmed,
+			Message:            "prometheus has not been confirmed to have loaded the rendered configuration",
+		},
+	}
+}
+
 var testGroup = `
 rules:
 - record: something
@@ -61,6 +90,14 @@ var testConfigMap = `groups:
     expr: 1 + 1
 `
 
+var testLastValidGroup = `name: default/test
+rules:
+- record: something
+  expr: 1 + 1
+- record: something2
+  expr: 1 + 1
+`
+
 var testScrape = `job_name: extra-server
 metrics_path: /metrics
 scheme: http
@@ -103,6 +140,25 @@ scrape_configs:
     action: replace
 `
 
+var testLastValidScrape = `job_name: default/test
+metrics_path: /metrics
+scheme: http
+gce_sd_configs:
+- project: myproject
+  zone: europe-west1-b
+  filter: name eq mymonolith.*
+  refresh_interval: 1m
+  port: 1234
+  tag_separator: ','
+relabel_configs:
+- source_labels: [__meta_gce_instance_name]
+  separator: ;
+  regex: (.*)
+  target_label: instance
+  replacement: $1
+  action: replace
+`
+
 type fixture struct {
 	t *testing.T
 
@@ -208,12 +264,14 @@ func (f *fixture) newController() (*Controller, informers.SharedInformerFactory,
 	c := NewController(cfg,
 		f.kubeclient,
 		f.client,
+		nil,
 		i,
 		&reloader,
 		func(ctx context.Context) ([]*cluster, error) { return nil, nil })
 
 	c.rulesSynced = alwaysReady
 	c.recorder = &record.FakeRecorder{}
+	c.now = func() time.Time { return testNow }
 
 	for _, f := range f.ruleGroupLister {
 		i.Config().V1beta1().RuleGroups().Informer().GetIndexer().Add(f)
@@ -390,6 +448,14 @@ func (f *fixture) expectUpdateRuleGroupsStatusAction(rs *conf.RuleGroup) {
 	}, "status", rs.Namespace, rs))
 }
 
+func (f *fixture) expectUpdateScrapeStatusAction(s *conf.Scrape) {
+	f.actions = append(f.actions, core.NewUpdateSubresourceAction(schema.GroupVersionResource{
+		Resource: "scrapes",
+		Group:    conf.SchemeGroupVersion.Group,
+		Version:  conf.SchemeGroupVersion.Version,
+	}, "status", s.Namespace, s))
+}
+
 func (f *fixture) expectCreateConfigMapAction(cm *corev1.ConfigMap) {
 	f.kubeactions = append(f.kubeactions, core.NewCreateAction(schema.GroupVersionResource{
 		Resource: "configmaps",
@@ -463,9 +529,13 @@ func TestCreatesRuleGroup(t *testing.T) {
 	cm := ucm.DeepCopy()
 	cm.Data = map[string]string{}
 
+	nrs := rs.DeepCopy()
+	nrs.Status.LastValidConfig = testLastValidGroup
+	nrs.Status.Conditions = renderedConditions()
+
+	f.expectUpdateRuleGroupsStatusAction(nrs)
 	f.expectCreateConfigMapAction(cm)
 	f.expectUpdateConfigMapAction(ucm)
-	//f.expectUpdateRuleGroupsStatusAction(nrs)
 
 	f.run(rs, t)
 }
@@ -474,6 +544,8 @@ func TestDoNothing(t *testing.T) {
 	f := newFixture(t)
 	rs := newRuleGroup("test", testGroup)
 	rs.Status.RecordingRuleCount = 2
+	rs.Status.LastValidConfig = testLastValidGroup
+	rs.Status.Conditions = renderedConditions()
 
 	cm := newConfigMap(
 		"default",
@@ -492,6 +564,8 @@ func TestUpdateRuleGroup(t *testing.T) {
 	f := newFixture(t)
 	rs := newRuleGroup("test", testGroup)
 	rs.Status.RecordingRuleCount = 2
+	rs.Status.LastValidConfig = testLastValidGroup
+	rs.Status.Conditions = renderedConditions()
 
 	ucm := newConfigMap(
 		"default",
@@ -519,14 +593,92 @@ func TestCreatesScrape(t *testing.T) {
 		"prom-config-controller",
 		"prom-config-controller.yaml",
 		testSecret)
+	// The secret starts out empty, the controller only writes it when the
+	// rendered config differs from what is already there.
+	empty := newSecret(
+		"default",
+		"prom-config-controller",
+		"prom-config-controller.yaml",
+		"")
 	f.scrapeLister = append(f.scrapeLister, scrape)
 	f.objects = append(f.objects, scrape)
-	f.kubeobjects = append(f.kubeobjects, s)
+	f.kubeobjects = append(f.kubeobjects, empty)
+
+	ns := scrape.DeepCopy()
+	ns.Status.LastValidConfig = testLastValidScrape
+	ns.Status.Conditions = renderedConditions()
+	f.expectUpdateScrapeStatusAction(ns)
 	f.expectUpdateSecretAction(s)
 
 	f.run(scrape, t)
 }
 
+func TestConvertStructuredScrape(t *testing.T) {
+	legacy := newScrape("test", testScrape)
+	structured := &confV1beta2.Scrape{
+		ObjectMeta: legacy.ObjectMeta,
+		Spec: confV1beta2.ScrapeSpec{
+			JobName:     "extra-server",
+			MetricsPath: "/metrics",
+			Scheme:      "http",
+			GCESDConfigs: []confV1beta2.GCESDConfig{{
+				Project:         "myproject",
+				Zone:            "europe-west1-b",
+				Filter:          "name eq mymonolith.*",
+				RefreshInterval: "1m",
+				Port:            1234,
+				TagSeparator:    ",",
+			}},
+			RelabelConfigs: []confV1beta2.RelabelConfig{{
+				SourceLabels: []string{"__meta_gce_instance_name"},
+				Regex:        "(.*)",
+				TargetLabel:  "instance",
+			}},
+		},
+	}
+
+	exp, err := convertScrape(legacy)
+	if err != nil {
+		t.Fatalf("converting legacy scrape failed, %v", err)
+	}
+	got, err := convertStructuredScrape(structured)
+	if err != nil {
+		t.Fatalf("converting structured scrape failed, %v", err)
+	}
+
+	expbs, _ := yaml.Marshal(exp)
+	gotbs, _ := yaml.Marshal(got)
+	if string(expbs) != string(gotbs) {
+		t.Errorf("structured scrape did not match legacy form\nexpected:\n%s\ngot:\n%s", expbs, gotbs)
+	}
+}
+
+func TestConvertStructuredScrapeRaw(t *testing.T) {
+	s := &confV1beta2.Scrape{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Spec: confV1beta2.ScrapeSpec{
+			Raw:         "metrics_path: /other\nsample_limit: 10\n",
+			MetricsPath: "/metrics",
+		},
+	}
+
+	pcfg, err := convertStructuredScrape(s)
+	if err != nil {
+		t.Fatalf("converting scrape failed, %v", err)
+	}
+	if pcfg.MetricsPath != "/metrics" {
+		t.Errorf("expected structured metrics path to override raw, got %q", pcfg.MetricsPath)
+	}
+	if pcfg.SampleLimit != 10 {
+		t.Errorf("expected sample limit from raw config, got %d", pcfg.SampleLimit)
+	}
+
+	s.Spec.RelabelConfigs = []confV1beta2.RelabelConfig{{Regex: "(", Action: "keep"}}
+	if _, err := convertStructuredScrape(s); err == nil {
+		t.Errorf("expected invalid regex to be rejected")
+	}
+}
+
 /*
 func TestDoNothing(t *testing.T) {
 	f := newFixture(t)
@@ -551,3 +703,135 @@ func TestUpdateRuleGroup(t *testing.T) {
 	f.run(getKey(rs, t))
 }
 */
+
+func TestConvertRuleGroupPartial(t *testing.T) {
+	rs := newRuleGroup("test", `
+rules:
+- alert: Broken
+  expr: up == 0
+  for: 5 minutes
+- record: something
+  expr: 1 + 1
+- record: something2
+  expr: 1 +
+`)
+
+	rg, errs := convertRuleGroup(rs.Name, rs)
+	if rg == nil || len(rg.Rules) != 1 || rg.Rules[0].Record != "something" {
+		t.Fatalf("expected only the valid rule to be rendered, got %#v", rg)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %v", errs)
+	}
+	exp := []struct {
+		index int
+		name  string
+	}{{0, "Broken"}, {2, "something2"}}
+	for i, err := range errs {
+		rerr, ok := err.(*ruleError)
+		if !ok {
+			t.Fatalf("expected a rule error, got %T", err)
+		}
+		if rerr.Index != exp[i].index || rerr.Name != exp[i].name {
+			t.Errorf("expected error for rule %d (%s), got %v", exp[i].index, exp[i].name, rerr)
+		}
+	}
+}
+
+func TestSyncRulesSkipsInvalidGroup(t *testing.T) {
+	f := newFixture(t)
+	good := newRuleGroup("test", testGroup)
+	bad := newRuleGroup("bad", `
+rules:
+- record: something
+  expr: 1 + 1
+  for: forever
+`)
+
+	f.ruleGroupLister = append(f.ruleGroupLister, good, bad)
+	f.objects = append(f.objects, good, bad)
+
+	c, _, _ := f.newController()
+	if _, err := c.syncRuleHandler(); err != nil {
+		t.Fatalf("sync failed, %v", err)
+	}
+
+	ctx := context.Background()
+	cm, err := f.kubeclient.CoreV1().ConfigMaps("default").Get(ctx, "prom-config-controller", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting configmap failed, %v", err)
+	}
+	if got := cm.Data["prom-config-controller.yaml"]; got != testConfigMap {
+		t.Errorf("expected only the valid group to be rendered, got:\n%s", got)
+	}
+
+	st, err := f.client.ConfigV1beta1().RuleGroups("default").Get(ctx, "bad", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting rule group failed, %v", err)
+	}
+	if len(st.Status.RuleErrors) != 1 || st.Status.RuleErrors[0].Name != "something" {
+		t.Errorf("expected the invalid rule to be reported, got %#v", st.Status)
+	}
+}
+
+func TestScrapeLastValidConfig(t *testing.T) {
+	f := newFixture(t)
+	scrape := newScrape("test", "job_name: test\nscrape_interval: forever\n")
+	scrape.Status.LastValidConfig = testLastValidScrape
+
+	f.scrapeLister = append(f.scrapeLister, scrape)
+	f.objects = append(f.objects, scrape)
+
+	c, _, _ := f.newController()
+	if _, err := c.syncConfigHandler(); err != nil {
+		t.Fatalf("sync failed, %v", err)
+	}
+
+	ctx := context.Background()
+	sec, err := f.kubeclient.CoreV1().Secrets("default").Get(ctx, "prom-config-controller", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting secret failed, %v", err)
+	}
+	if got := string(sec.Data["prom-config-controller.yaml"]); got != testSecret {
+		t.Errorf("expected last valid config to be rendered, got:\n%s", got)
+	}
+
+	st, err := f.client.ConfigV1beta1().Scrapes("default").Get(ctx, "test", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting scrape failed, %v", err)
+	}
+	if st.Status.ErrorCount != 1 || st.Status.LastValidConfig != testLastValidScrape {
+		t.Errorf("expected error to be reported and last valid config kept, got %#v", st.Status)
+	}
+
+	if v := testutil.ToFloat64(staleScrapes.WithLabelValues("default", "test")); v != 1 {
+		t.Errorf("expected scrape to be marked stale, got %v", v)
+	}
+}
+
+func TestRuleGroupLastValidConfig(t *testing.T) {
+	f := newFixture(t)
+	rs := newRuleGroup("test", "interval: often\n"+testGroup)
+	rs.Status.LastValidConfig = testLastValidGroup
+
+	f.ruleGroupLister = append(f.ruleGroupLister, rs)
+	f.objects = append(f.objects, rs)
+
+	c, _, _ := f.newController()
+	if _, err := c.syncRuleHandler(); err != nil {
+		t.Fatalf("sync failed, %v", err)
+	}
+
+	ctx := context.Background()
+	cm, err := f.kubeclient.CoreV1().ConfigMaps("default").Get(ctx, "prom-config-controller", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting configmap failed, %v", err)
+	}
+	if got := cm.Data["prom-config-controller.yaml"]; got != testConfigMap {
+		t.Errorf("expected last valid rules to be rendered, got:\n%s", got)
+	}
+
+	if v := testutil.ToFloat64(staleRuleGroups.WithLabelValues("default", "test")); v != 1 {
+		t.Errorf("expected rule group to be marked stale, got %v", v)
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+
+	promconfig "github.com/QubitProducts/prom-config-controller/internal/prom2"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/QubitProducts/prom-config-controller/pkg/apis/config"
+	configV1beta1 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+	configV1beta2 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta2"
+)
+
+const scrapesCRDName = "scrapes." + config.GroupName
+
+func serveConvert(w http.ResponseWriter, r *http.Request) {
+	glog.V(2).Info("Conversion webhook called")
+	var body []byte
+	if r.Body != nil {
+		if data, err := ioutil.ReadAll(r.Body); err == nil {
+			body = data
+		}
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType != "application/json" {
+		glog.Errorf("contentType=%s, expect application/json", contentType)
+		http.Error(w, "invalid Content-Type, expect application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	review := apiextv1.ConversionReview{}
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		glog.Errorf("could not decode conversion review, %v", err)
+		http.Error(w, "invalid conversion review", http.StatusBadRequest)
+		return
+	}
+
+	response := apiextv1.ConversionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apiextv1.SchemeGroupVersion.String(),
+			Kind:       "ConversionReview",
+		},
+		Response: convertObjects(review.Request),
+	}
+
+	resp, err := json.Marshal(response)
+	if err != nil {
+		glog.Error(err)
+	}
+	if _, err := w.Write(resp); err != nil {
+		glog.Error(err)
+	}
+}
+
+// convertObjects converts every object in a conversion request. A failure
+// to convert any object fails the request, with a cause reported for each
+// object that could not be converted.
+func convertObjects(req *apiextv1.ConversionRequest) *apiextv1.ConversionResponse {
+	res := &apiextv1.ConversionResponse{
+		UID: req.UID,
+	}
+
+	var causes []metav1.StatusCause
+	var messages []string
+	for _, obj := range req.Objects {
+		converted, id, err := convertObject(obj.Raw, req.DesiredAPIVersion)
+		if err != nil {
+			glog.Infof("conversion of %s to %s failed, %v", id, req.DesiredAPIVersion, err)
+			causes = append(causes, metav1.StatusCause{
+				Field:   id,
+				Message: err.Error(),
+			})
+			messages = append(messages, fmt.Sprintf("%s: %v", id, err))
+			continue
+		}
+		res.ConvertedObjects = append(res.ConvertedObjects, runtime.RawExtension{Raw: converted})
+	}
+
+	if len(causes) > 0 {
+		res.ConvertedObjects = nil
+		res.Result = metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: fmt.Sprintf("errors during conversion, %s", strings.Join(messages, ", ")),
+			Reason:  metav1.StatusReasonInvalid,
+			Details: &metav1.StatusDetails{
+				Causes: causes,
+			},
+		}
+		return res
+	}
+
+	res.Result = metav1.Status{Status: metav1.StatusSuccess}
+	return res
+}
+
+// convertObject converts a single JSON encoded object to the desired API
+// version. It also returns a namespace/name identifier for the object, for
+// use in error reporting.
+func convertObject(raw []byte, desiredAPIVersion string) ([]byte, string, error) {
+	meta := struct {
+		metav1.TypeMeta   `json:",inline"`
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+	}{}
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, "unknown", errors.Wrap(err, "decoding object")
+	}
+	id := fmt.Sprintf("%s/%s", meta.Namespace, meta.Name)
+
+	if meta.Kind != "Scrape" {
+		return nil, id, fmt.Errorf("unsupported kind %q", meta.Kind)
+	}
+
+	if meta.APIVersion == desiredAPIVersion {
+		return raw, id, nil
+	}
+
+	v1beta1 := configV1beta1.SchemeGroupVersion.String()
+	v1beta2 := configV1beta2.SchemeGroupVersion.String()
+
+	var out interface{}
+	switch {
+	case meta.APIVersion == v1beta1 && desiredAPIVersion == v1beta2:
+		in := configV1beta1.Scrape{}
+		if err := json.Unmarshal(raw, &in); err != nil {
+			return nil, id, errors.Wrap(err, "decoding scrape")
+		}
+		out = scrapeToV1beta2(&in)
+	case meta.APIVersion == v1beta2 && desiredAPIVersion == v1beta1:
+		in := configV1beta2.Scrape{}
+		if err := json.Unmarshal(raw, &in); err != nil {
+			return nil, id, errors.Wrap(err, "decoding scrape")
+		}
+		s, err := scrapeToV1beta1(&in)
+		if err != nil {
+			return nil, id, err
+		}
+		out = s
+	default:
+		return nil, id, fmt.Errorf("unsupported conversion from %s to %s", meta.APIVersion, desiredAPIVersion)
+	}
+
+	bs, err := json.Marshal(out)
+	if err != nil {
+		return nil, id, errors.Wrap(err, "encoding scrape")
+	}
+	return bs, id, nil
+}
+
+func scrapeToV1beta2(in *configV1beta1.Scrape) *configV1beta2.Scrape {
+	out := &configV1beta2.Scrape{
+		TypeMeta:   in.TypeMeta,
+		ObjectMeta: *in.ObjectMeta.DeepCopy(),
+		Spec:       structureScrapeSpec(string(in.Spec)),
+		Status: configV1beta2.ScrapeStatus{
+			ErrorCount:         in.Status.ErrorCount,
+			Errors:             append([]string(nil), in.Status.Errors...),
+			LastValidConfig:    in.Status.LastValidConfig,
+			ObservedGeneration: in.Status.ObservedGeneration,
+			Conditions:         append([]metav1.Condition(nil), in.Status.Conditions...),
+		},
+	}
+	out.APIVersion = configV1beta2.SchemeGroupVersion.String()
+	return out
+}
+
+func scrapeToV1beta1(in *configV1beta2.Scrape) (*configV1beta1.Scrape, error) {
+	spec, err := renderScrapeSpec(&in.Spec)
+	if err != nil {
+		return nil, err
+	}
+	out := &configV1beta1.Scrape{
+		TypeMeta:   in.TypeMeta,
+		ObjectMeta: *in.ObjectMeta.DeepCopy(),
+		Spec:       configV1beta1.ScrapeSpec(spec),
+		Status: configV1beta1.ScrapeStatus{
+			ErrorCount:         in.Status.ErrorCount,
+			Errors:             append([]string(nil), in.Status.Errors...),
+			LastValidConfig:    in.Status.LastValidConfig,
+			ObservedGeneration: in.Status.ObservedGeneration,
+			Conditions:         append([]metav1.Condition(nil), in.Status.Conditions...),
+		},
+	}
+	out.APIVersion = configV1beta1.SchemeGroupVersion.String()
+	return out, nil
+}
+
+// structureScrapeSpec converts a legacy scrape config string to a structured
+// spec. Top level keys whose value can be represented exactly by the
+// structured fields are moved to them, everything else is kept in Raw.
+func structureScrapeSpec(raw string) configV1beta2.ScrapeSpec {
+	// Specs that prometheus would reject are kept as they are, so that
+	// the object can still be read, and fixed, through either version.
+	var pcfg promconfig.ScrapeConfig
+	if err := yaml.Unmarshal([]byte(raw), &pcfg); err != nil {
+		glog.V(2).Infof("keeping invalid scrape config in raw form, %v", err)
+		return configV1beta2.ScrapeSpec{Raw: raw}
+	}
+
+	doc := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(raw), &doc); err != nil {
+		return configV1beta2.ScrapeSpec{Raw: raw}
+	}
+
+	structured := map[string]interface{}{}
+	rest := map[string]interface{}{}
+	for k, v := range doc {
+		if isStructuredScrapeField(k, v) {
+			structured[k] = v
+		} else {
+			rest[k] = v
+		}
+	}
+
+	var spec configV1beta2.ScrapeSpec
+	bs, err := yaml.Marshal(structured)
+	if err == nil {
+		err = yaml.Unmarshal(bs, &spec)
+	}
+	if err != nil {
+		return configV1beta2.ScrapeSpec{Raw: raw}
+	}
+
+	if len(rest) > 0 {
+		bs, err := yaml.Marshal(rest)
+		if err != nil {
+			return configV1beta2.ScrapeSpec{Raw: raw}
+		}
+		spec.Raw = string(bs)
+	}
+
+	return spec
+}
+
+// isStructuredScrapeField reports whether the scrape config key k, with
+// value v, survives a round trip through the structured spec unchanged.
+func isStructuredScrapeField(k string, v interface{}) bool {
+	in := map[string]interface{}{k: v}
+	bs, err := yaml.Marshal(in)
+	if err != nil {
+		return false
+	}
+
+	var spec configV1beta2.ScrapeSpec
+	if err = yaml.UnmarshalStrict(bs, &spec); err != nil {
+		return false
+	}
+
+	if bs, err = yaml.Marshal(&spec); err != nil {
+		return false
+	}
+	out := map[string]interface{}{}
+	if err = yaml.Unmarshal(bs, &out); err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(in, out)
+}
+
+// renderScrapeSpec converts a structured spec to a legacy scrape config
+// string. A spec that only uses Raw is returned unchanged.
+func renderScrapeSpec(spec *configV1beta2.ScrapeSpec) (string, error) {
+	doc, structured, err := scrapeSpecDoc(spec)
+	if err != nil {
+		return "", err
+	}
+	if !structured {
+		return spec.Raw, nil
+	}
+
+	bs, err := yaml.Marshal(doc)
+	if err != nil {
+		return "", errors.Wrap(err, "rendering scrape")
+	}
+	return string(bs), nil
+}
+
+// registerConversion points the scrapes CRD at this controller's conversion
+// webhook.
+func (c *Controller) registerConversion() error {
+	ctx := context.Background()
+	if c.crdclientset == nil {
+		return nil
+	}
+	path := "/convert"
+	port := int32(443)
+	client := c.crdclientset.ApiextensionsV1().CustomResourceDefinitions()
+	crd, err := client.Get(ctx, scrapesCRDName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	conversion := &apiextv1.CustomResourceConversion{
+		Strategy: apiextv1.WebhookConverter,
+		Webhook: &apiextv1.WebhookConversion{
+			ClientConfig: &apiextv1.WebhookClientConfig{
+				Service: &apiextv1.ServiceReference{
+					Namespace: c.ServiceNS,
+					Name:      c.ServiceName,
+					Path:      &path,
+					Port:      &port,
+				},
+				CABundle: c.CACert,
+			},
+			ConversionReviewVersions: []string{"v1"},
+		},
+	}
+	if reflect.DeepEqual(crd.Spec.Conversion, conversion) {
+		return nil
+	}
+
+	crd = crd.DeepCopy()
+	crd.Spec.Conversion = conversion
+	if _, err := client.Update(ctx, crd, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+
+	glog.V(2).Info("Self registration as conversion webhook succeeded.")
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	confV1beta2 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta2"
+)
+
+func TestStructureScrapeSpec(t *testing.T) {
+	spec := structureScrapeSpec(testScrape)
+
+	if spec.JobName != "extra-server" || spec.MetricsPath != "/metrics" || spec.Scheme != "http" {
+		t.Errorf("top level fields were not structured, got %#v", spec)
+	}
+	if len(spec.GCESDConfigs) != 1 || spec.GCESDConfigs[0].Port != 1234 {
+		t.Errorf("gce sd config was not structured, got %#v", spec.GCESDConfigs)
+	}
+	if len(spec.RelabelConfigs) != 1 || spec.RelabelConfigs[0].TargetLabel != "instance" {
+		t.Errorf("relabel config was not structured, got %#v", spec.RelabelConfigs)
+	}
+	if spec.Raw != "" {
+		t.Errorf("expected no raw remainder, got %q", spec.Raw)
+	}
+
+	// consul has no structured form, so must be kept in raw
+	spec = structureScrapeSpec(`job_name: consul
+metrics_path: /metrics
+consul_sd_configs:
+- server: localhost:8500
+`)
+	if spec.MetricsPath != "/metrics" {
+		t.Errorf("expected metrics path to be structured, got %#v", spec)
+	}
+	if spec.Raw != "consul_sd_configs:\n- server: localhost:8500\n" {
+		t.Errorf("expected consul config to be kept in raw, got %q", spec.Raw)
+	}
+
+	// invalid specs are kept verbatim
+	invalid := "job_name: x\nscrape_interval: forever\n"
+	spec = structureScrapeSpec(invalid)
+	if !reflect.DeepEqual(spec, confV1beta2.ScrapeSpec{Raw: invalid}) {
+		t.Errorf("expected invalid spec to be kept in raw, got %#v", spec)
+	}
+}
+
+func TestConvertScrapeRoundTrip(t *testing.T) {
+	legacy := newScrape("test", testScrape)
+	legacy.Kind = "Scrape"
+	legacy.Status.ErrorCount = 1
+	legacy.Status.Errors = []string{"an error"}
+
+	raw, _ := json.Marshal(legacy)
+	res := convertObjects(&apiextv1.ConversionRequest{
+		UID:               "1234",
+		DesiredAPIVersion: confV1beta2.SchemeGroupVersion.String(),
+		Objects:           []runtime.RawExtension{{Raw: raw}},
+	})
+	if res.Result.Status != metav1.StatusSuccess {
+		t.Fatalf("conversion to v1beta2 failed, %v", res.Result.Message)
+	}
+	if res.UID != "1234" {
+		t.Errorf("expected response uid to match request, got %q", res.UID)
+	}
+
+	structured := confV1beta2.Scrape{}
+	if err := json.Unmarshal(res.ConvertedObjects[0].Raw, &structured); err != nil {
+		t.Fatalf("could not decode converted object, %v", err)
+	}
+	if structured.APIVersion != confV1beta2.SchemeGroupVersion.String() ||
+		structured.Name != legacy.Name ||
+		structured.Status.ErrorCount != 1 {
+		t.Errorf("metadata or status not preserved, got %#v", structured)
+	}
+
+	res = convertObjects(&apiextv1.ConversionRequest{
+		DesiredAPIVersion: legacy.APIVersion,
+		Objects:           []runtime.RawExtension{{Raw: res.ConvertedObjects[0].Raw}},
+	})
+	if res.Result.Status != metav1.StatusSuccess {
+		t.Fatalf("conversion to v1beta1 failed, %v", res.Result.Message)
+	}
+	back := newScrape("", "")
+	if err := json.Unmarshal(res.ConvertedObjects[0].Raw, back); err != nil {
+		t.Fatalf("could not decode converted object, %v", err)
+	}
+
+	exp, err := convertScrape(legacy)
+	if err != nil {
+		t.Fatalf("converting scrape failed, %v", err)
+	}
+	got, err := convertScrape(back)
+	if err != nil {
+		t.Fatalf("converting round tripped scrape failed, %v", err)
+	}
+	if !reflect.DeepEqual(exp, got) {
+		t.Errorf("round trip changed scrape config\nexpected: %#v\ngot: %#v", exp, got)
+	}
+}
+
+func TestConvertObjectsReportsFailures(t *testing.T) {
+	good, _ := json.Marshal(newScrape("good", testScrape))
+	bad := []byte(`{"apiVersion":"config.prometheus.io/v1beta1","kind":"Other","metadata":{"name":"bad","namespace":"default"}}`)
+
+	var goodObj map[string]interface{}
+	json.Unmarshal(good, &goodObj)
+	goodObj["kind"] = "Scrape"
+	good, _ = json.Marshal(goodObj)
+
+	res := convertObjects(&apiextv1.ConversionRequest{
+		DesiredAPIVersion: confV1beta2.SchemeGroupVersion.String(),
+		Objects:           []runtime.RawExtension{{Raw: good}, {Raw: bad}},
+	})
+	if res.Result.Status != metav1.StatusFailure {
+		t.Fatalf("expected conversion to fail")
+	}
+	if len(res.ConvertedObjects) != 0 {
+		t.Errorf("expected no converted objects on failure")
+	}
+	causes := res.Result.Details.Causes
+	if len(causes) != 1 || causes[0].Field != "default/bad" {
+		t.Errorf("expected a single cause for default/bad, got %#v", causes)
+	}
+}
+
+func TestServeConvertRejectsContentType(t *testing.T) {
+	r := httptest.NewRequest("POST", "/convert", strings.NewReader("{}"))
+	r.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	serveConvert(w, r)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected status %d, got %d", http.StatusUnsupportedMediaType, w.Code)
+	}
+}
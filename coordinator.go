@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// reloadCoordinator coalesces the reload requests made by the workers into
+// reloads of a prometheus or alertmanager deployment. A reload starts once
+// no reload has been requested for delay, but no later than maxDelay after
+// the first request it serves, and at least minInterval after the previous
+// reload started. A reload still retrying when the next one starts is
+// cancelled.
+type reloadCoordinator struct {
+	name        string
+	target      targetReloader
+	delay       time.Duration
+	maxDelay    time.Duration
+	minInterval time.Duration
+
+	requests chan struct{}
+	now      func() time.Time
+	// cancel cancels the reload in progress.
+	cancel context.CancelFunc
+
+	sync.Mutex
+	pending     bool
+	lastRequest time.Time
+	lastReload  time.Time
+	targets     map[string]*reloadTargetStatus
+}
+
+// reloadTargetStatus is the result of the last reload of a target.
+type reloadTargetStatus struct {
+	Time   time.Time `json:"time"`
+	Result string    `json:"result"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// reloadStatus is the status of a reload coordinator reported by
+// serveReloadStatus.
+type reloadStatus struct {
+	Pending     bool                           `json:"pending"`
+	LastRequest *time.Time                     `json:"lastRequest,omitempty"`
+	LastReload  *time.Time                     `json:"lastReload,omitempty"`
+	Targets     map[string]*reloadTargetStatus `json:"targets"`
+}
+
+func newReloadCoordinator(name string, target targetReloader, delay, maxDelay, minInterval time.Duration) *reloadCoordinator {
+	return &reloadCoordinator{
+		name:        name,
+		target:      target,
+		delay:       delay,
+		maxDelay:    maxDelay,
+		minInterval: minInterval,
+		requests:    make(chan struct{}, 1),
+		now:         time.Now,
+		targets:     map[string]*reloadTargetStatus{},
+	}
+}
+
+// Reload requests a reload, it does not wait for it to happen.
+func (c *reloadCoordinator) Reload() {
+	reloadRequests.WithLabelValues(c.name).Inc()
+
+	c.Lock()
+	c.pending = true
+	c.lastRequest = c.now()
+	c.Unlock()
+
+	select {
+	case c.requests <- struct{}{}:
+	default:
+	}
+}
+
+// Run reloads on request until stopCh is closed.
+func (c *reloadCoordinator) Run(stopCh <-chan struct{}) {
+	c.cancel = func() {}
+	defer func() { c.cancel() }()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-c.requests:
+		}
+
+		if !c.wait(stopCh) {
+			return
+		}
+
+		c.cancel()
+		var ctx context.Context
+		ctx, c.cancel = context.WithCancel(context.Background())
+
+		c.Lock()
+		c.pending = false
+		c.lastReload = c.now()
+		c.Unlock()
+
+		reloads.WithLabelValues(c.name).Inc()
+		go c.reload(ctx)
+	}
+}
+
+// wait waits for the next reload to be due, absorbing the requests made in
+// the meantime. It returns false if stopCh is closed.
+func (c *reloadCoordinator) wait(stopCh <-chan struct{}) bool {
+	deadline := time.Now().Add(c.maxDelay)
+	quiet := time.NewTimer(c.delay)
+	defer func() { quiet.Stop() }()
+
+debounce:
+	for {
+		select {
+		case <-stopCh:
+			return false
+		case <-c.requests:
+			d := c.delay
+			if until := time.Until(deadline); until < d {
+				d = until
+			}
+			quiet.Stop()
+			quiet = time.NewTimer(d)
+		case <-quiet.C:
+			break debounce
+		}
+	}
+
+	c.Lock()
+	next := c.lastReload.Add(c.minInterval)
+	c.Unlock()
+	interval := time.NewTimer(time.Until(next))
+	defer interval.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return false
+		case <-c.requests:
+		case <-interval.C:
+			return true
+		}
+	}
+}
+
+// reload runs a reload, recording the result for each target. Targets that
+// are no longer reloaded are forgotten once the reload completes.
+func (c *reloadCoordinator) reload(ctx context.Context) {
+	seen := map[string]bool{}
+	c.target.reload(ctx, func(target string, err error) {
+		c.Lock()
+		defer c.Unlock()
+		seen[target] = true
+
+		st := &reloadTargetStatus{Time: c.now(), Result: "success"}
+		success := 1.0
+		if err != nil {
+			st.Result = "failure"
+			st.Error = err.Error()
+			success = 0
+			glog.Errorf("%s reload of %s failed, %v", c.name, target, err)
+		}
+		c.targets[target] = st
+		reloadTargetTimestamp.WithLabelValues(c.name, target).Set(float64(st.Time.Unix()))
+		reloadTargetSuccess.WithLabelValues(c.name, target).Set(success)
+	})
+	if ctx.Err() != nil {
+		glog.V(1).Infof("%s reload superseded", c.name)
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	for target := range c.targets {
+		if !seen[target] {
+			delete(c.targets, target)
+			reloadTargetTimestamp.DeleteLabelValues(c.name, target)
+			reloadTargetSuccess.DeleteLabelValues(c.name, target)
+		}
+	}
+}
+
+// status returns the current status of the coordinator.
+func (c *reloadCoordinator) status() reloadStatus {
+	c.Lock()
+	defer c.Unlock()
+
+	st := reloadStatus{
+		Pending: c.pending,
+		Targets: map[string]*reloadTargetStatus{},
+	}
+	if !c.lastRequest.IsZero() {
+		t := c.lastRequest
+		st.LastRequest = &t
+	}
+	if !c.lastReload.IsZero() {
+		t := c.lastReload
+		st.LastReload = &t
+	}
+	for target, ts := range c.targets {
+		cp := *ts
+		st.Targets[target] = &cp
+	}
+	return st
+}
+
+// serveReloadStatus reports the status of each coordinator, by name, as
+// JSON.
+func serveReloadStatus(cs ...*reloadCoordinator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := map[string]reloadStatus{}
+		for _, c := range cs {
+			res[c.name] = c.status()
+		}
+
+		resp, err := json.Marshal(res)
+		if err != nil {
+			glog.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(resp); err != nil {
+			glog.Error(err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTargetReloader records reloads, reporting a result for each of its
+// targets. If block is set reloads wait to be cancelled.
+type fakeTargetReloader struct {
+	sync.Mutex
+	targets   map[string]error
+	block     bool
+	starts    chan time.Time
+	cancelled int
+}
+
+func (f *fakeTargetReloader) reload(ctx context.Context, report func(target string, err error)) {
+	f.starts <- time.Now()
+
+	f.Lock()
+	block := f.block
+	targets := make(map[string]error, len(f.targets))
+	for t, err := range f.targets {
+		targets[t] = err
+	}
+	f.Unlock()
+	if block {
+		<-ctx.Done()
+		f.Lock()
+		f.cancelled++
+		f.Unlock()
+		return
+	}
+	for t, err := range targets {
+		report(t, err)
+	}
+}
+
+func (f *fakeTargetReloader) waitStart(t *testing.T) time.Time {
+	t.Helper()
+	select {
+	case at := <-f.starts:
+		return at
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a reload")
+	}
+	return time.Time{}
+}
+
+func TestReloadCoordinator(t *testing.T) {
+	f := &fakeTargetReloader{
+		targets: map[string]error{"10.0.0.1:9090": nil, "10.0.0.2:9090": errors.New("reload response 503")},
+		starts:  make(chan time.Time, 10),
+	}
+	minInterval := 200 * time.Millisecond
+	c := newReloadCoordinator("test", f, 20*time.Millisecond, time.Second, minInterval)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go c.Run(stopCh)
+
+	// A burst of requests is served by a single reload.
+	for i := 0; i < 5; i++ {
+		c.Reload()
+		time.Sleep(5 * time.Millisecond)
+	}
+	first := f.waitStart(t)
+	select {
+	case <-f.starts:
+		t.Fatal("expected a single reload for a burst of requests")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	st := c.status()
+	if st.Pending || st.LastReload == nil || len(st.Targets) != 2 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+	if r := st.Targets["10.0.0.2:9090"]; r.Result != "failure" || r.Error != "reload response 503" {
+		t.Errorf("expected the failed target to be reported, got %+v", r)
+	}
+
+	// Reloads are at least the minimum interval apart.
+	c.Reload()
+	if second := f.waitStart(t); second.Sub(first) < minInterval {
+		t.Errorf("expected reloads at least %v apart, got %v", minInterval, second.Sub(first))
+	}
+
+	// Targets no longer reloaded are forgotten.
+	f.Lock()
+	delete(f.targets, "10.0.0.2:9090")
+	f.block = true
+	f.Unlock()
+
+	// A reload in progress is cancelled by the next one.
+	c.Reload()
+	f.waitStart(t)
+	f.Lock()
+	f.block = false
+	f.Unlock()
+	c.Reload()
+	f.waitStart(t)
+	time.Sleep(50 * time.Millisecond)
+
+	f.Lock()
+	cancelled := f.cancelled
+	f.Unlock()
+	if cancelled != 1 {
+		t.Errorf("expected the blocked reload to be cancelled, got %d", cancelled)
+	}
+
+	rec := httptest.NewRecorder()
+	serveReloadStatus(c)(rec, httptest.NewRequest("GET", "/reload/status", nil))
+	res := map[string]reloadStatus{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("could not decode status, %v", err)
+	}
+	if targets := res["test"].Targets; len(targets) != 1 || targets["10.0.0.1:9090"] == nil {
+		t.Errorf("expected only the remaining target, got %+v", targets)
+	}
+}
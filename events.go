@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// Event slots, the latest event in each slot of an object is remembered so
+// that it is not recorded again on every sync.
+const (
+	// syncSlot holds events about how an object was rendered.
+	syncSlot = "sync"
+	// loadSlot holds events about whether prometheus loaded an object.
+	loadSlot = "load"
+)
+
+// eventDedup remembers the latest event recorded in each slot of each
+// object.
+type eventDedup struct {
+	sync.Mutex
+	last map[string]string
+}
+
+func newEventDedup() *eventDedup {
+	return &eventDedup{last: map[string]string{}}
+}
+
+// record reports whether an event should be recorded, it returns false if it
+// is the same as the last event in the slot.
+func (d *eventDedup) record(key, slot, event string) bool {
+	d.Lock()
+	defer d.Unlock()
+	k := key + "\x00" + slot
+	if d.last[k] == event {
+		return false
+	}
+	d.last[k] = event
+	return true
+}
+
+// forget forgets the events of a deleted object.
+func (d *eventDedup) forget(key string) {
+	d.Lock()
+	defer d.Unlock()
+	for _, slot := range []string{syncSlot, loadSlot} {
+		delete(d.last, key+"\x00"+slot)
+	}
+}
+
+// eventKind identifies the kind of obj in the event dedup.
+func eventKind(obj k8sruntime.Object) string {
+	return fmt.Sprintf("%T", obj)
+}
+
+// recordEvent records an event on obj, unless it is the same as the last
+// event recorded in the same slot of obj.
+func (c *Controller) recordEvent(obj k8sruntime.Object, slot, eventtype, reason, message string) {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		glog.Infof("could not record event, %v", err)
+		return
+	}
+	key := eventKind(obj) + "/" + m.GetNamespace() + "/" + m.GetName()
+	event := strings.Join([]string{string(m.GetUID()), eventtype, reason, message}, "\x00")
+	if !c.events.record(key, slot, event) {
+		return
+	}
+	c.recorder.Event(obj, eventtype, reason, message)
+}
+
+// recordSyncEvent records how obj was rendered by the latest sync.
+func (c *Controller) recordSyncEvent(obj k8sruntime.Object, state renderState, errs []error) {
+	var msgs []string
+	conflict := false
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+		if _, ok := err.(*conflictError); ok {
+			conflict = true
+		}
+	}
+	msg := strings.Join(msgs, "; ")
+
+	switch {
+	case len(errs) == 0:
+		c.recordEvent(obj, syncSlot, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
+	case state == renderedCurrent:
+		c.recordEvent(obj, syncSlot, corev1.EventTypeWarning, ErrResourceInvalid, fmt.Sprintf(MessagePartiallySynced, msg))
+	case state == renderedStale:
+		c.recordEvent(obj, syncSlot, corev1.EventTypeWarning, ReasonStale, fmt.Sprintf(MessageResourceStale, msg))
+	case conflict:
+		c.recordEvent(obj, syncSlot, corev1.EventTypeWarning, ErrResourceConflict, fmt.Sprintf(MessageResourceDropped, msg))
+	default:
+		c.recordEvent(obj, syncSlot, corev1.EventTypeWarning, ErrResourceInvalid, fmt.Sprintf(MessageResourceDropped, msg))
+	}
+}
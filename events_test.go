@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var evs []string
+	for {
+		select {
+		case ev := <-recorder.Events:
+			evs = append(evs, ev)
+		default:
+			return evs
+		}
+	}
+}
+
+func TestSyncEvents(t *testing.T) {
+	f := newFixture(t)
+	good := newScrape("good", testScrape)
+	good.CreationTimestamp.Time = testNow
+	clash := newScrape("clash", "job_name: extra-server\nstatic_configs:\n- targets: [localhost:9090]\n")
+	clash.CreationTimestamp.Time = testNow.Add(time.Minute)
+	bad := newScrape("bad", "job_name: bad\nscrape_interval: forever\n")
+
+	f.scrapeLister = append(f.scrapeLister, good, clash, bad)
+	f.objects = append(f.objects, good, clash, bad)
+
+	c, _, _ := f.newController()
+	c.JobNamePolicy = JobNameUser
+	recorder := record.NewFakeRecorder(10)
+	c.recorder = recorder
+
+	if _, err := c.syncConfigHandler(); err != nil {
+		t.Fatalf("sync failed, %v", err)
+	}
+
+	evs := drainEvents(recorder)
+	expected := []string{
+		corev1.EventTypeWarning + " " + ErrResourceInvalid,
+		corev1.EventTypeNormal + " " + SuccessSynced,
+		corev1.EventTypeWarning + " " + ErrResourceConflict,
+	}
+	if len(evs) != len(expected) {
+		t.Fatalf("expected %d events, got %q", len(expected), evs)
+	}
+	for i := range expected {
+		if !strings.HasPrefix(evs[i], expected[i]) {
+			t.Errorf("expected event %q, got %q", expected[i], evs[i])
+		}
+	}
+
+	// Nothing has changed, so nothing is recorded again.
+	if _, err := c.syncConfigHandler(); err != nil {
+		t.Fatalf("sync failed, %v", err)
+	}
+	if evs := drainEvents(recorder); len(evs) != 0 {
+		t.Errorf("expected no events on resync, got %q", evs)
+	}
+}
+
+func TestEventDedup(t *testing.T) {
+	d := newEventDedup()
+	if !d.record("kind/ns/a", syncSlot, "x") {
+		t.Errorf("expected first event to be recorded")
+	}
+	if d.record("kind/ns/a", syncSlot, "x") {
+		t.Errorf("expected repeated event to be dropped")
+	}
+	if !d.record("kind/ns/a", loadSlot, "x") {
+		t.Errorf("expected event in another slot to be recorded")
+	}
+	if !d.record("kind/ns/a", syncSlot, "y") {
+		t.Errorf("expected changed event to be recorded")
+	}
+
+	d.forget("other/ns/a")
+	if d.record("kind/ns/a", syncSlot, "y") {
+		t.Errorf("expected events of other objects to be kept")
+	}
+
+	d.forget("kind/ns/a")
+	if !d.record("kind/ns/a", syncSlot, "y") {
+		t.Errorf("expected events of removed objects to be forgotten")
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// checksumSuffix is appended to the name of a rendered file to give the name
+// of its checksum file. Checksum files are in the format used by sha256sum,
+// so can be checked with sha256sum -c.
+const checksumSuffix = ".sha256"
+
+// FileOptions control how rendered files are written.
+type FileOptions struct {
+	// Mode is the permissions of written files, 0644 if unset.
+	Mode os.FileMode
+	// If Chown is set, written files are owned by UID and GID. Either may
+	// be -1 to leave it unchanged.
+	Chown bool
+	UID   int
+	GID   int
+	// Sync flushes files, and the directories they are in, to disk before
+	// they are considered written.
+	Sync bool
+	// Checksum writes a checksum file alongside each file, recording the
+	// hash of what was rendered. Files that no longer match their checksum
+	// are reported as drifted.
+	Checksum bool
+}
+
+func (o FileOptions) mode() os.FileMode {
+	if o.Mode == 0 {
+		return 0644
+	}
+	return o.Mode
+}
+
+func updateFile(fn string, bs []byte, opts FileOptions) (bool, error) {
+	if fn == "" {
+		return false, nil
+	}
+
+	obs, err := ioutil.ReadFile(fn)
+	if err != nil && !os.IsNotExist(err) {
+		glog.V(3).Infof("err reading file, %v", err)
+
+		return false, err
+	}
+	exists := err == nil
+
+	osha := sha256.Sum256(obs)
+	nsha := sha256.Sum256(bs)
+	sum := checksumLine(fn, nsha[:])
+
+	var recorded []byte
+	if opts.Checksum {
+		recorded, err = ioutil.ReadFile(fn + checksumSuffix)
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		if exists && len(recorded) > 0 && !bytes.Equal(recorded, checksumLine(fn, osha[:])) {
+			glog.Warningf("file %s does not match its checksum, it has been changed outside of the controller", fn)
+			fileDrift.WithLabelValues(fn).Inc()
+		}
+	}
+
+	if exists && bytes.Equal(osha[:], nsha[:]) {
+		if opts.Checksum && !bytes.Equal(recorded, sum) {
+			return false, errors.Wrap(writeFileAtomic(fn+checksumSuffix, sum, opts), "writing checksum file")
+		}
+		return false, nil
+	}
+
+	glog.V(1).Infof("fn: %s old: %s new: %s",
+		fn,
+		hex.EncodeToString(osha[:]),
+		hex.EncodeToString(nsha[:]))
+
+	glog.Infof("file %s changed, updating", fn)
+
+	if err = writeFileAtomic(fn, bs, opts); err != nil {
+		return false, errors.Wrap(err, "writing config file")
+	}
+	if opts.Checksum {
+		if err = writeFileAtomic(fn+checksumSuffix, sum, opts); err != nil {
+			return true, errors.Wrap(err, "writing checksum file")
+		}
+	}
+	return true, nil
+}
+
+// removeFile removes a rendered file and its checksum file.
+func removeFile(fn string) error {
+	for _, f := range []string{fn, fn + checksumSuffix} {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func checksumLine(fn string, sum []byte) []byte {
+	return []byte(fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum), filepath.Base(fn)))
+}
+
+// writeFileAtomic writes bs to fn, replacing any existing file in a single
+// rename so that readers never see a partially written file.
+func writeFileAtomic(fn string, bs []byte, opts FileOptions) error {
+	dir, base := filepath.Split(fn)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := ioutil.TempFile(dir, "."+strings.TrimPrefix(base, ".")+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if _, err = f.Write(bs); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Chmod(opts.mode()); err != nil {
+		f.Close()
+		return err
+	}
+	if opts.Chown {
+		if err = f.Chown(opts.UID, opts.GID); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if opts.Sync {
+		if err = f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, fn); err != nil {
+		return err
+	}
+	if opts.Sync {
+		return syncDir(dir)
+	}
+	return nil
+}
+
+// syncDir flushes a directory, so that a rename in it is durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestUpdateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "config.yaml")
+	opts := FileOptions{Mode: 0600, Sync: true, Checksum: true}
+
+	changed, err := updateFile(fn, []byte("one\n"), opts)
+	if err != nil || !changed {
+		t.Fatalf("expected file to be written, got %v, %v", changed, err)
+	}
+
+	fi, err := os.Stat(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %v", fi.Mode())
+	}
+
+	sum, err := ioutil.ReadFile(fn + checksumSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := "2c8b08da5ce60398e1f19af0e5dccc744df274b826abe585eaba68c525434806  config.yaml\n"
+	if string(sum) != exp {
+		t.Errorf("expected checksum %q, got %q", exp, sum)
+	}
+
+	if changed, err = updateFile(fn, []byte("one\n"), opts); err != nil || changed {
+		t.Errorf("expected no change, got %v, %v", changed, err)
+	}
+
+	// Changes made outside of the controller are reported and replaced.
+	if err := ioutil.WriteFile(fn, []byte("edited\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	before := testutil.ToFloat64(fileDrift.WithLabelValues(fn))
+	if changed, err = updateFile(fn, []byte("one\n"), opts); err != nil || !changed {
+		t.Errorf("expected drifted file to be rewritten, got %v, %v", changed, err)
+	}
+	if after := testutil.ToFloat64(fileDrift.WithLabelValues(fn)); after != before+1 {
+		t.Errorf("expected drift to be counted, got %v", after-before)
+	}
+
+	// Only the file and its checksum are left, no temporary files.
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 2 {
+		var names []string
+		for _, fi := range fis {
+			names = append(names, fi.Name())
+		}
+		t.Errorf("expected only the file and its checksum, got %v", names)
+	}
+}
@@ -27,7 +27,7 @@ PACKAGE_BASE="github.com/QubitProducts/prom-config-controller"
 ${SCRIPT_ROOT}/hack/generate-groups.sh "deepcopy,client,informer,lister" \
   "${PACKAGE_BASE}/pkg/client" \
   "${PACKAGE_BASE}/pkg/apis" \
-  config:v1beta1 \
+  config:v1beta1,v1beta2 \
   --output-base "$(dirname "${BASH_SOURCE[0]}")/codegen" \
   --go-header-file ${SCRIPT_ROOT}/hack/custom-boilerplate.go.txt
 
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	configV1beta1 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+// amInhibitRule is the alertmanager form of an inhibit rule.
+type amInhibitRule struct {
+	SourceMatch   map[string]string `yaml:"source_match,omitempty"`
+	SourceMatchRE map[string]string `yaml:"source_match_re,omitempty"`
+	TargetMatch   map[string]string `yaml:"target_match,omitempty"`
+	TargetMatchRE map[string]string `yaml:"target_match_re,omitempty"`
+	Equal         []string          `yaml:"equal,omitempty"`
+}
+
+// inhibitRuleModel holds the converted form of each inhibit rule between
+// syncs.
+type inhibitRuleModel struct {
+	sync.Mutex
+	rules map[string]*amInhibitRule
+}
+
+func newInhibitRuleModel() *inhibitRuleModel {
+	return &inhibitRuleModel{rules: map[string]*amInhibitRule{}}
+}
+
+func (m *inhibitRuleModel) keys() []string {
+	m.Lock()
+	defer m.Unlock()
+	var keys []string
+	for k := range m.rules {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// sorted returns the valid inhibit rules, in key order.
+func (m *inhibitRuleModel) sorted() []interface{} {
+	m.Lock()
+	defer m.Unlock()
+	keys := make([]string, 0, len(m.rules))
+	for k := range m.rules {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var res []interface{}
+	for _, k := range keys {
+		if m.rules[k] != nil {
+			res = append(res, m.rules[k])
+		}
+	}
+	return res
+}
+
+// convertInhibitRule converts an inhibit rule to its alertmanager form. The
+// target is matched on the namespace of the inhibit rule, so that it only
+// mutes alerts from its own namespace.
+func convertInhibitRule(ir *configV1beta1.InhibitRule) (*amInhibitRule, []error) {
+	var errs []error
+	spec := ir.Spec
+	if len(spec.SourceMatch) == 0 && len(spec.SourceMatchRE) == 0 {
+		errs = append(errs, errors.New("sourceMatch or sourceMatchRE is required"))
+	}
+	errs = append(errs, checkMatch(ir.Namespace, "sourceMatch", spec.SourceMatch, "sourceMatchRE", spec.SourceMatchRE)...)
+	errs = append(errs, checkMatch(ir.Namespace, "targetMatch", spec.TargetMatch, "targetMatchRE", spec.TargetMatchRE)...)
+	for _, l := range spec.Equal {
+		if !model.LabelName(l).IsValid() {
+			errs = append(errs, fmt.Errorf("invalid equal label %q", l))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	// The target match of the spec is copied, so the namespace can be added
+	// without modifying the cached object.
+	target := map[string]string{alertRouteNamespaceLabel: ir.Namespace}
+	for k, v := range spec.TargetMatch {
+		target[k] = v
+	}
+	return &amInhibitRule{
+		SourceMatch:   spec.SourceMatch,
+		SourceMatchRE: spec.SourceMatchRE,
+		TargetMatch:   target,
+		TargetMatchRE: spec.TargetMatchRE,
+		Equal:         spec.Equal,
+	}, nil
+}
+
+// syncInhibitRules reconciles every inhibit rule.
+func (c *Controller) syncInhibitRules() error {
+	irs, err := c.inhibitRulesLister.InhibitRules(c.Namespace).List(c.Selector)
+	if err != nil {
+		return errors.Wrap(err, "listing inhibit rules")
+	}
+
+	seen := map[string]bool{}
+	for _, ir := range irs {
+		var key string
+		if key, err = cache.MetaNamespaceKeyFunc(ir); err != nil {
+			runtime.HandleError(err)
+			continue
+		}
+		seen[key] = true
+		c.reconcileInhibitRule(key, ir)
+	}
+
+	for _, key := range c.inhibitRules.keys() {
+		if !seen[key] {
+			c.forgetInhibitRule(key)
+		}
+	}
+	return nil
+}
+
+// syncInhibitRule reconciles the inhibit rule with the given key, and
+// schedules the alertmanager config to be rendered.
+func (c *Controller) syncInhibitRule(key string) error {
+	ns, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+
+	ir, err := c.inhibitRulesLister.InhibitRules(ns).Get(name)
+	switch {
+	case kerrors.IsNotFound(err):
+		c.forgetInhibitRule(key)
+	case err != nil:
+		return err
+	case !c.selects(ir):
+		c.forgetInhibitRule(key)
+	default:
+		c.reconcileInhibitRule(key, ir)
+	}
+
+	c.queueRender(renderAlertmanagerKey)
+	return nil
+}
+
+// reconcileInhibitRule converts ir, updates its status, and stores the
+// result in the inhibit rule model.
+func (c *Controller) reconcileInhibitRule(key string, ir *configV1beta1.InhibitRule) {
+	res, errs := convertInhibitRule(ir)
+
+	state := renderedCurrent
+	if res == nil {
+		state = notRendered
+	}
+	if err := c.updateirstatus(ir, state, errs); err != nil {
+		glog.Infof("updating status of %s failed, %v", key, err)
+	}
+	c.recordSyncEvent(ir, state, errs)
+	for _, err := range errs {
+		glog.Infof("inhibit rule error in %v: %v", key, err)
+	}
+
+	c.inhibitRules.Lock()
+	defer c.inhibitRules.Unlock()
+	c.inhibitRules.rules[key] = res
+}
+
+// forgetInhibitRule removes a deleted inhibit rule from the inhibit rule
+// model.
+func (c *Controller) forgetInhibitRule(key string) {
+	c.events.forget(eventKind(&configV1beta1.InhibitRule{}) + "/" + key)
+
+	c.inhibitRules.Lock()
+	defer c.inhibitRules.Unlock()
+	delete(c.inhibitRules.rules, key)
+}
+
+func (c *Controller) updateirstatus(org *configV1beta1.InhibitRule, state renderState, errs []error) error {
+	ctx := context.Background()
+	var err error
+	ir := org.DeepCopy()
+
+	ir.Status.Errors = nil
+	for _, err := range errs {
+		ir.Status.Errors = append(ir.Status.Errors, err.Error())
+	}
+	ir.Status.ErrorCount = len(ir.Status.Errors)
+	ir.Status.ObservedGeneration = ir.Generation
+	c.setConditions(&ir.Status.Conditions, ir.Generation, state, unconfirmedAlertmanagerLoad, errs)
+
+	if !reflect.DeepEqual(org.Status, ir.Status) {
+		_, err = c.confclientset.ConfigV1beta1().InhibitRules(ir.Namespace).UpdateStatus(ctx, ir, metav1.UpdateOptions{})
+	}
+
+	return err
+}
+
+func (c *Controller) enqueueinhibitrule(obj interface{}) {
+	var key string
+	var err error
+	if key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	c.inhibitRulesWorkqueue.AddRateLimited(key)
+}
+
+func (c *Controller) runInhibitRulesWorker() {
+	processInhibitRule := makeProcessNextWorkItem(c.inhibitRulesWorkqueue, c.syncInhibitRule)
+	for processInhibitRule() {
+	}
+
+	glog.Info("inhibit rules worker stopped")
+}
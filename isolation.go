@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+
+	promconfig "github.com/QubitProducts/prom-config-controller/internal/prom2"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/prometheus/prometheus/promql"
+
+	configV1beta1 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+// namespaceLabel is the label forced on to targets and samples of scrapes,
+// and on to the selectors and output of rules, when namespace isolation is
+// enabled.
+const namespaceLabel = "namespace"
+
+// isolateScrape restricts a scrape config to targets in the given namespace.
+// Kubernetes service discovery that does not list any namespaces is limited
+// to namespace, and relabelling is added to force the namespace label on to
+// every target and sample. Configs that discover targets in other namespaces,
+// or through anything other than kubernetes service discovery, or that may
+// relabel on to the labels that decide where targets are scraped from, are
+// rejected.
+func isolateScrape(namespace string, pcfg *promconfig.ScrapeConfig) []error {
+	var errs []error
+
+	if pcfg.HonorLabels {
+		errs = append(errs, fmt.Errorf("honor_labels is not permitted with namespace isolation"))
+	}
+
+	sd := &pcfg.ServiceDiscoveryConfig
+	others := []struct {
+		name  string
+		count int
+	}{
+		{"static_configs", len(sd.StaticConfigs)},
+		{"dns_sd_configs", len(sd.DNSSDConfigs)},
+		{"file_sd_configs", len(sd.FileSDConfigs)},
+		{"consul_sd_configs", len(sd.ConsulSDConfigs)},
+		{"serverset_sd_configs", len(sd.ServersetSDConfigs)},
+		{"nerve_sd_configs", len(sd.NerveSDConfigs)},
+		{"marathon_sd_configs", len(sd.MarathonSDConfigs)},
+		{"gce_sd_configs", len(sd.GCESDConfigs)},
+		{"ec2_sd_configs", len(sd.EC2SDConfigs)},
+		{"openstack_sd_configs", len(sd.OpenstackSDConfigs)},
+		{"azure_sd_configs", len(sd.AzureSDConfigs)},
+		{"triton_sd_configs", len(sd.TritonSDConfigs)},
+	}
+	for _, o := range others {
+		if o.count > 0 {
+			errs = append(errs, fmt.Errorf("%s is not permitted with namespace isolation, only kubernetes_sd_configs may be used", o.name))
+		}
+	}
+
+	for i, k := range sd.KubernetesSDConfigs {
+		if k.Role == promconfig.KubernetesRoleNode {
+			errs = append(errs, fmt.Errorf("kubernetes_sd_configs[%d]: role %q is not permitted with namespace isolation", i, k.Role))
+		}
+		if k.APIServer.URL != nil {
+			errs = append(errs, fmt.Errorf("kubernetes_sd_configs[%d]: api_server is not permitted with namespace isolation", i))
+		}
+		if len(k.NamespaceDiscovery.Names) == 0 {
+			k.NamespaceDiscovery.Names = []string{namespace}
+			continue
+		}
+		for _, n := range k.NamespaceDiscovery.Names {
+			if n != namespace {
+				errs = append(errs, fmt.Errorf("kubernetes_sd_configs[%d]: discovery in namespace %q is not permitted from namespace %q", i, n, namespace))
+			}
+		}
+	}
+
+	// The reserved labels control which target is scraped, so writing
+	// __address__ would escape the namespace.
+	for i, rc := range pcfg.RelabelConfigs {
+		switch {
+		case rc.Action == promconfig.RelabelLabelMap && labelmapWritesReserved(rc):
+			errs = append(errs, fmt.Errorf("relabel_configs[%d]: labelmap of %s to %q is not permitted with namespace isolation, it may write %s", i, rc.Regex, rc.Replacement, strings.Join(reservedTargetLabels, ", ")))
+		case rc.Action != promconfig.RelabelLabelMap && templateWritesReserved(rc.TargetLabel, nil):
+			errs = append(errs, fmt.Errorf("relabel_configs[%d]: target_label %q is not permitted with namespace isolation, it may write %s", i, rc.TargetLabel, strings.Join(reservedTargetLabels, ", ")))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	// These are added last so that they take precedence over any
+	// relabelling in the spec.
+	pcfg.RelabelConfigs = append(pcfg.RelabelConfigs, namespaceRelabelConfig(namespace))
+	pcfg.MetricRelabelConfigs = append(pcfg.MetricRelabelConfigs, namespaceRelabelConfig(namespace))
+
+	return nil
+}
+
+// reservedTargetLabels are the target labels that decide where a target is
+// scraped from.
+var reservedTargetLabels = []string{"__address__", "__metrics_path__", "__scheme__"}
+
+// kubernetesLabelKey matches the sanitized label and annotation keys that
+// kubernetes service discovery appends to the dynamic meta label prefixes.
+// Kubernetes keys start and end with an alphanumeric character.
+const kubernetesLabelKey = `[a-zA-Z0-9](?:[a-zA-Z0-9_]*[a-zA-Z0-9])?`
+
+// kubernetesKeyPrefix matches the meta label prefixes that are followed by
+// a kubernetes label or annotation key.
+var kubernetesKeyPrefix = regexp.MustCompile(`^__meta_kubernetes_[a-z]+_(label|annotation|labelpresent|annotationpresent)_$`)
+
+// labelmapWritesReserved reports whether the labelmap rc may copy a label
+// on to one of the reserved target labels. The label names a capture group
+// of rc's regex can match are only narrowed down for groups that end the
+// regex after a kubernetes label or annotation prefix, as in the common
+// __meta_kubernetes_pod_label_(.+), any other group is assumed to be able to
+// match anything.
+func labelmapWritesReserved(rc *promconfig.RelabelConfig) bool {
+	re, err := syntax.Parse(rc.Regex.String(), syntax.Perl)
+	if err != nil {
+		return true
+	}
+	re = re.Simplify()
+
+	var subs []*syntax.Regexp
+	var flatten func(r *syntax.Regexp)
+	flatten = func(r *syntax.Regexp) {
+		if r.Op == syntax.OpConcat {
+			for _, sub := range r.Sub {
+				flatten(sub)
+			}
+			return
+		}
+		subs = append(subs, r)
+	}
+	flatten(re)
+	for len(subs) > 0 && (subs[0].Op == syntax.OpBeginText || subs[0].Op == syntax.OpBeginLine) {
+		subs = subs[1:]
+	}
+	for len(subs) > 0 && (subs[len(subs)-1].Op == syntax.OpEndText || subs[len(subs)-1].Op == syntax.OpEndLine) {
+		subs = subs[:len(subs)-1]
+	}
+
+	groups := map[string]string{}
+	if n := len(subs); n > 1 && subs[n-1].Op == syntax.OpCapture {
+		prefix := ""
+		literal := true
+		for _, sub := range subs[:n-1] {
+			if sub.Op != syntax.OpLiteral || sub.Flags&syntax.FoldCase != 0 {
+				literal = false
+				break
+			}
+			prefix += string(sub.Rune)
+		}
+		if literal && kubernetesKeyPrefix.MatchString(prefix) {
+			groups[fmt.Sprint(subs[n-1].Cap)] = kubernetesLabelKey
+			if subs[n-1].Name != "" {
+				groups[subs[n-1].Name] = kubernetesLabelKey
+			}
+		}
+	}
+	return templateWritesReserved(rc.Replacement, groups)
+}
+
+// templateWritesReserved reports whether the relabel template tmpl may
+// expand to one of the reserved target labels. groups gives a regular
+// expression for what the capture groups, by number or name, may hold,
+// groups that are not given may hold anything.
+func templateWritesReserved(tmpl string, groups map[string]string) bool {
+	pattern := ""
+	for rest := tmpl; rest != ""; {
+		i := strings.Index(rest, "$")
+		if i < 0 {
+			pattern += regexp.QuoteMeta(rest)
+			break
+		}
+		pattern += regexp.QuoteMeta(rest[:i])
+		rest = rest[i+1:]
+
+		var name string
+		switch {
+		case strings.HasPrefix(rest, "$"):
+			pattern += regexp.QuoteMeta("$")
+			rest = rest[1:]
+			continue
+		case strings.HasPrefix(rest, "{"):
+			end := strings.Index(rest, "}")
+			if end < 0 {
+				pattern += regexp.QuoteMeta("${")
+				rest = rest[1:]
+				continue
+			}
+			name, rest = rest[1:end], rest[end+1:]
+		default:
+			end := strings.IndexFunc(rest, func(r rune) bool {
+				return !(r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+			})
+			if end < 0 {
+				end = len(rest)
+			}
+			name, rest = rest[:end], rest[end:]
+		}
+		if g, ok := groups[name]; ok {
+			pattern += "(?:" + g + ")"
+		} else {
+			pattern += ".*"
+		}
+	}
+
+	re := regexp.MustCompile("^(?:" + pattern + ")$")
+	for _, l := range reservedTargetLabels {
+		if re.MatchString(l) {
+			return true
+		}
+	}
+	return false
+}
+
+func namespaceRelabelConfig(namespace string) *promconfig.RelabelConfig {
+	rc := promconfig.DefaultRelabelConfig
+	rc.TargetLabel = namespaceLabel
+	rc.Replacement = namespace
+	return &rc
+}
+
+// ruleChecks returns the checks applied to each rule of rg during
+// conversion.
+func (c *Controller) ruleChecks(rg *configV1beta1.RuleGroup) []ruleCheck {
+	var checks []ruleCheck
+	if c.isolateRules(rg) {
+		checks = append(checks, isolateRule(rg.Namespace))
+	}
+	return checks
+}
+
+// isolateRules reports whether namespace isolation should be applied to the
+// rules of rg.
+func (c *Controller) isolateRules(rg *configV1beta1.RuleGroup) bool {
+	if !c.RuleNamespaceIsolation {
+		return false
+	}
+	for _, ns := range c.RuleIsolationExemptNamespaces {
+		if ns == rg.Namespace {
+			return false
+		}
+	}
+	if c.RuleIsolationExemptKey != "" {
+		if rg.Labels[c.RuleIsolationExemptKey] == "true" || rg.Annotations[c.RuleIsolationExemptKey] == "true" {
+			return false
+		}
+	}
+	return true
+}
+
+// isolateRule returns a check that restricts a rule to series from the given
+// namespace. A namespace matcher is added to every selector in the rule's
+// expression, and the namespace label is forced on to the series and alerts
+// the rule produces. Selectors that can only match other namespaces are
+// rejected.
+func isolateRule(namespace string) ruleCheck {
+	return func(r *rulefmt.Rule) error {
+		expr, err := promql.ParseExpr(r.Expr)
+		if err != nil {
+			return errors.Wrap(err, "parsing expr")
+		}
+
+		if err = injectNamespaceMatcher(namespace, expr); err != nil {
+			return err
+		}
+		r.Expr = expr.String()
+
+		// The labels may be shared with the informer cache.
+		lbls := make(map[string]string, len(r.Labels)+1)
+		for k, v := range r.Labels {
+			lbls[k] = v
+		}
+		lbls[namespaceLabel] = namespace
+		r.Labels = lbls
+
+		return nil
+	}
+}
+
+// injectNamespaceMatcher replaces any namespace matchers on the selectors in
+// expr with one that matches only namespace.
+func injectNamespaceMatcher(namespace string, expr promql.Expr) error {
+	nsm, err := labels.NewMatcher(labels.MatchEqual, namespaceLabel, namespace)
+	if err != nil {
+		return err
+	}
+
+	inject := func(ms []*labels.Matcher) ([]*labels.Matcher, error) {
+		res := []*labels.Matcher{nsm}
+		for _, m := range ms {
+			if m.Name != namespaceLabel {
+				res = append(res, m)
+				continue
+			}
+			if !m.Matches(namespace) {
+				return nil, fmt.Errorf("selector %s does not match namespace %q", m, namespace)
+			}
+		}
+		return res, nil
+	}
+
+	promql.Inspect(expr, func(node promql.Node, path []promql.Node) error {
+		switch n := node.(type) {
+		case *promql.VectorSelector:
+			n.LabelMatchers, err = inject(n.LabelMatchers)
+		case *promql.MatrixSelector:
+			n.LabelMatchers, err = inject(n.LabelMatchers)
+		}
+		return err
+	})
+
+	return err
+}
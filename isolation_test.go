@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	promconfig "github.com/QubitProducts/prom-config-controller/internal/prom2"
+	v1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	conf "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+func TestIsolateScrape(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  string
+		names []string
+		errs  int
+	}{
+		{
+			name: "own namespace by default",
+			spec: `job_name: test
+kubernetes_sd_configs:
+- role: pod
+`,
+			names: []string{"default"},
+		},
+		{
+			name: "explicit own namespace",
+			spec: `job_name: test
+kubernetes_sd_configs:
+- role: endpoints
+  namespaces:
+    names: [default]
+`,
+			names: []string{"default"},
+		},
+		{
+			name: "cross namespace",
+			spec: `job_name: test
+kubernetes_sd_configs:
+- role: pod
+  namespaces:
+    names: [default, kube-system]
+`,
+			errs: 1,
+		},
+		{
+			name: "node role",
+			spec: `job_name: test
+kubernetes_sd_configs:
+- role: node
+`,
+			errs: 1,
+		},
+		{
+			name: "static and honor labels",
+			spec: `job_name: test
+honor_labels: true
+static_configs:
+- targets: [somewhere:9090]
+`,
+			errs: 2,
+		},
+		{
+			name: "gce",
+			spec: testScrape,
+			errs: 1,
+		},
+		{
+			name: "relabel address",
+			spec: `job_name: test
+kubernetes_sd_configs:
+- role: pod
+relabel_configs:
+- target_label: __address__
+  replacement: somewhere:9090
+- source_labels: [__meta_kubernetes_pod_annotation_target]
+  target_label: ${1}
+- action: labelmap
+  regex: __meta_kubernetes_pod_label_a(.+)
+- action: labelmap
+  regex: __meta_kubernetes_pod_label_(.+)
+  replacement: __${1}__
+- source_labels: [__meta_kubernetes_pod_name]
+  target_label: __tmp_pod
+`,
+			errs: 4,
+		},
+		{
+			name: "labelmap of kubernetes labels",
+			spec: `job_name: test
+kubernetes_sd_configs:
+- role: pod
+relabel_configs:
+- action: labelmap
+  regex: __meta_kubernetes_pod_label_(.+)
+- action: labelmap
+  regex: __meta_kubernetes_service_annotation_(?P<key>.+)
+  replacement: annotation_${key}
+- action: labelmap
+  regex: (.+)
+  replacement: pod_$1
+`,
+			names: []string{"default"},
+		},
+	}
+
+	for _, tt := range tests {
+		pcfg, err := convertScrape(newScrape("test", tt.spec))
+		if err != nil {
+			t.Fatalf("%s: converting scrape failed, %v", tt.name, err)
+		}
+
+		errs := isolateScrape("default", pcfg)
+		if len(errs) != tt.errs {
+			t.Errorf("%s: expected %d errors, got %v", tt.name, tt.errs, errs)
+			continue
+		}
+		if tt.errs > 0 {
+			continue
+		}
+
+		got := pcfg.ServiceDiscoveryConfig.KubernetesSDConfigs[0].NamespaceDiscovery.Names
+		if !reflect.DeepEqual(got, tt.names) {
+			t.Errorf("%s: expected namespaces %v, got %v", tt.name, tt.names, got)
+		}
+
+		for _, rcs := range [][]*promconfig.RelabelConfig{pcfg.RelabelConfigs, pcfg.MetricRelabelConfigs} {
+			last := rcs[len(rcs)-1]
+			if last.TargetLabel != namespaceLabel || last.Replacement != "default" {
+				t.Errorf("%s: expected final relabel config to force the namespace label, got %#v", tt.name, last)
+			}
+		}
+	}
+}
+
+func TestAdmitScrapeIsolation(t *testing.T) {
+	s := newScrape("test", `job_name: test
+kubernetes_sd_configs:
+- role: pod
+  namespaces:
+    names: [kube-system]
+`)
+	s.Kind = "Scrape"
+	raw, _ := json.Marshal(s)
+
+	ar := v1.AdmissionReview{
+		Request: &v1.AdmissionRequest{
+			Resource: metav1.GroupVersionResource(conf.SchemeGroupVersion.WithResource("scrapes")),
+			Object:   runtime.RawExtension{Raw: raw},
+		},
+	}
+
+	c := &Controller{}
+	if res := c.admit(ar); !res.Allowed {
+		t.Errorf("expected scrape to be allowed without isolation, got %v", res.Result)
+	}
+
+	c.NamespaceIsolation = true
+	res := c.admit(ar)
+	if res.Allowed {
+		t.Fatalf("expected cross namespace scrape to be denied")
+	}
+	if len(res.Result.Details.Causes) != 1 {
+		t.Errorf("expected a single cause, got %#v", res.Result.Details.Causes)
+	}
+}
+
+func TestIsolateRuleGroup(t *testing.T) {
+	tests := []struct {
+		expr string
+		exp  string
+		err  bool
+	}{
+		{expr: `up`, exp: `up{namespace="default"}`},
+		{expr: `rate(http_requests_total{job="a"}[5m] offset 1m)`, exp: `rate(http_requests_total{job="a",namespace="default"}[5m] offset 1m)`},
+		{expr: `up{namespace=~"def.*"}`, exp: `up{namespace="default"}`},
+		{expr: `up{namespace="other"}`, err: true},
+		{expr: `up / on() group_left count({__name__=~"x.*", namespace!="default"})`, err: true},
+	}
+
+	for _, tt := range tests {
+		rs := newRuleGroup("test", "rules:\n- record: test\n  expr: '"+tt.expr+"'\n")
+		rg, errs := convertRuleGroup(rs.Name, rs, isolateRule("default"))
+		if tt.err {
+			if len(errs) == 0 || rg != nil {
+				t.Errorf("%s: expected rule to be rejected, got %v", tt.expr, rg)
+			}
+			continue
+		}
+		if len(errs) != 0 {
+			t.Errorf("%s: unexpected errors, %v", tt.expr, errs)
+			continue
+		}
+		if rg.Rules[0].Expr != tt.exp {
+			t.Errorf("%s: expected %s, got %s", tt.expr, tt.exp, rg.Rules[0].Expr)
+		}
+		if rg.Rules[0].Labels[namespaceLabel] != "default" {
+			t.Errorf("%s: expected namespace label on output, got %v", tt.expr, rg.Rules[0].Labels)
+		}
+	}
+}
+
+func TestIsolateRulesExemption(t *testing.T) {
+	c := &Controller{}
+	c.RuleNamespaceIsolation = true
+	c.RuleIsolationExemptNamespaces = []string{"platform"}
+	c.RuleIsolationExemptKey = "example.com/exempt"
+
+	rs := newRuleGroup("test", testGroup)
+	if !c.isolateRules(rs) {
+		t.Errorf("expected rule group to be isolated")
+	}
+
+	annotated := rs.DeepCopy()
+	annotated.Annotations = map[string]string{"example.com/exempt": "true"}
+	if c.isolateRules(annotated) {
+		t.Errorf("expected annotated rule group to be exempt")
+	}
+
+	platform := rs.DeepCopy()
+	platform.Namespace = "platform"
+	if c.isolateRules(platform) {
+		t.Errorf("expected rule group in exempt namespace to be exempt")
+	}
+}
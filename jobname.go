@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	promconfig "github.com/QubitProducts/prom-config-controller/internal/prom2"
+	"github.com/pkg/errors"
+
+	configV1beta1 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+// Job naming policies, these control the job_name given to the scrape config
+// rendered for each Scrape.
+const (
+	// JobNameGenerated names jobs namespace/name, ignoring any job_name
+	// given in the spec.
+	JobNameGenerated = "generated"
+	// JobNameUser uses the job_name given in the spec. Scrapes whose
+	// job_name is already in use are rejected.
+	JobNameUser = "user"
+	// JobNameTemplate names jobs by executing JobNameTemplate.
+	JobNameTemplate = "template"
+)
+
+// jobNameData is passed to the job name template.
+type jobNameData struct {
+	Namespace   string
+	Name        string
+	JobName     string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// scrapeJobName returns the job name to use for the scrape config rendered
+// from s, according to the configured policy.
+func (c *Controller) scrapeJobName(s *configV1beta1.Scrape, pcfg *promconfig.ScrapeConfig) (string, error) {
+	switch c.JobNamePolicy {
+	case "", JobNameGenerated:
+		return fmt.Sprintf("%s/%s", s.Namespace, s.Name), nil
+	case JobNameUser:
+		return pcfg.JobName, nil
+	case JobNameTemplate:
+		if c.JobNameTemplate == nil {
+			return "", errors.New("no job name template configured")
+		}
+		buf := &bytes.Buffer{}
+		err := c.JobNameTemplate.Execute(buf, jobNameData{
+			Namespace:   s.Namespace,
+			Name:        s.Name,
+			JobName:     pcfg.JobName,
+			Labels:      s.Labels,
+			Annotations: s.Annotations,
+		})
+		if err != nil {
+			return "", errors.Wrap(err, "rendering job name template")
+		}
+		name := strings.TrimSpace(buf.String())
+		if name == "" {
+			return "", errors.New("job name template rendered an empty job name")
+		}
+		return name, nil
+	default:
+		return "", fmt.Errorf("unknown job name policy %q", c.JobNamePolicy)
+	}
+}
+
+// conflictError is returned for a scrape whose job name is already used by
+// another scrape, or by the base configuration.
+type conflictError struct {
+	JobName string
+	Owner   string
+}
+
+func (e *conflictError) Error() string {
+	return fmt.Sprintf("job_name %q is already used by %s", e.JobName, e.Owner)
+}
+
+// sortScrapesByAge orders scrapes oldest first, so that when two scrapes
+// claim the same job name the one that claimed it first keeps it.
+func sortScrapesByAge(ss []*configV1beta1.Scrape) {
+	sort.SliceStable(ss, func(i, j int) bool {
+		ti, tj := ss[i].CreationTimestamp, ss[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		if ss[i].Namespace != ss[j].Namespace {
+			return ss[i].Namespace < ss[j].Namespace
+		}
+		return ss[i].Name < ss[j].Name
+	})
+}
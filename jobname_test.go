@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/Masterminds/sprig"
+	promconfig "github.com/QubitProducts/prom-config-controller/internal/prom2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestScrapeJobName(t *testing.T) {
+	s := newScrape("test", testScrape)
+	s.Labels = map[string]string{"team": "infra"}
+
+	tests := []struct {
+		policy   string
+		template string
+		exp      string
+		err      bool
+	}{
+		{policy: "", exp: "default/test"},
+		{policy: JobNameGenerated, exp: "default/test"},
+		{policy: JobNameUser, exp: "extra-server"},
+		{policy: JobNameTemplate, template: `{{ .Labels.team }}-{{ .JobName }}`, exp: "infra-extra-server"},
+		{policy: JobNameTemplate, template: `{{ .Labels.missing }}`, err: true},
+		{policy: JobNameTemplate, err: true},
+		{policy: "other", err: true},
+	}
+
+	for _, tt := range tests {
+		c := &Controller{}
+		c.JobNamePolicy = tt.policy
+		if tt.template != "" {
+			c.JobNameTemplate = template.Must(template.New("jobname").Option("missingkey=error").Funcs(sprig.TxtFuncMap()).Parse(tt.template))
+		}
+
+		pcfg, err := convertScrape(s)
+		if err != nil {
+			t.Fatalf("converting scrape failed, %v", err)
+		}
+
+		got, err := c.scrapeJobName(s, pcfg)
+		if tt.err {
+			if err == nil {
+				t.Errorf("policy %q template %q: expected error, got %q", tt.policy, tt.template, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("policy %q template %q: unexpected error, %v", tt.policy, tt.template, err)
+			continue
+		}
+		if got != tt.exp {
+			t.Errorf("policy %q template %q: expected %q, got %q", tt.policy, tt.template, tt.exp, got)
+		}
+	}
+}
+
+func TestScrapeJobNameCollision(t *testing.T) {
+	f := newFixture(t)
+
+	older := newScrape("b", testScrape)
+	older.CreationTimestamp = metav1.NewTime(time.Unix(1000, 0))
+	newer := newScrape("a", testScrape)
+	newer.CreationTimestamp = metav1.NewTime(time.Unix(2000, 0))
+
+	f.scrapeLister = append(f.scrapeLister, newer, older)
+	f.objects = append(f.objects, newer, older)
+
+	c, _, _ := f.newController()
+	c.JobNamePolicy = JobNameUser
+
+	if _, err := c.syncConfigHandler(); err != nil {
+		t.Fatalf("sync failed, %v", err)
+	}
+
+	ctx := context.Background()
+	got, err := f.client.ConfigV1beta1().Scrapes("default").Get(ctx, "a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting scrape failed, %v", err)
+	}
+	if got.Status.ErrorCount != 1 || !strings.Contains(got.Status.Errors[0], "default/b") {
+		t.Errorf("expected newer scrape to report a collision with default/b, got %#v", got.Status)
+	}
+
+	sec, err := f.kubeclient.CoreV1().Secrets("default").Get(ctx, "prom-config-controller", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting secret failed, %v", err)
+	}
+	cfg, err := promconfig.Load(string(sec.Data["prom-config-controller.yaml"]))
+	if err != nil {
+		t.Fatalf("rendered config is invalid, %v", err)
+	}
+	if len(cfg.ScrapeConfigs) != 1 || cfg.ScrapeConfigs[0].JobName != "extra-server" {
+		t.Errorf("expected a single extra-server job, got %#v", cfg.ScrapeConfigs)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/prometheus/prometheus/promql"
+
+	configV1beta1 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+// Lints applied to the rules of rule groups at admission. Rules that fail
+// them are warned about, unless the lint is promoted to a denial for the
+// namespace of the rule group.
+const (
+	// LintAlertNoFor warns about alerts that fire on a single evaluation.
+	LintAlertNoFor = "alert-no-for"
+	// LintMissingSeverity warns about alerts without a severity label or
+	// annotation.
+	LintMissingSeverity = "missing-severity"
+	// LintMissingSummary warns about alerts without a summary annotation.
+	LintMissingSummary = "missing-summary"
+	// LintShortRateRange warns about rates over ranges that cover fewer
+	// than four scrapes.
+	LintShortRateRange = "short-rate-range"
+	// LintUnboundedCount warns about counts whose output cardinality is
+	// not bounded by the labels they group by.
+	LintUnboundedCount = "unbounded-count"
+	// LintLargeLookback warns about expressions that look further back
+	// than the maximum lookback.
+	LintLargeLookback = "large-lookback"
+)
+
+var lints = []string{
+	LintAlertNoFor,
+	LintMissingSeverity,
+	LintMissingSummary,
+	LintShortRateRange,
+	LintUnboundedCount,
+	LintLargeLookback,
+}
+
+// rangeFuncs are the functions that need several samples within their range
+// to give a meaningful result.
+var rangeFuncs = map[string]bool{
+	"rate":     true,
+	"increase": true,
+	"delta":    true,
+	"deriv":    true,
+}
+
+// highCardinalityLabels are labels whose values are not bounded in number,
+// so that counting by them is unbounded.
+var highCardinalityLabels = map[string]bool{
+	"pod":          true,
+	"instance":     true,
+	"container_id": true,
+	"id":           true,
+	"uid":          true,
+}
+
+// lintFinding is a lint that a rule failed.
+type lintFinding struct {
+	lint    string
+	message string
+}
+
+// lintRule returns the lints that r fails. scrapeInterval is the interval
+// that series are expected to be scraped at.
+func (c *Controller) lintRule(r rulefmt.Rule, scrapeInterval time.Duration) []lintFinding {
+	var res []lintFinding
+	add := func(lint, format string, args ...interface{}) {
+		res = append(res, lintFinding{lint: lint, message: fmt.Sprintf(format, args...)})
+	}
+
+	if r.Alert != "" {
+		if r.For == 0 {
+			add(LintAlertNoFor, "the alert has no for duration, so fires on a single evaluation")
+		}
+		if r.Labels["severity"] == "" && r.Annotations["severity"] == "" {
+			add(LintMissingSeverity, "the alert has no severity label")
+		}
+		if r.Annotations["summary"] == "" {
+			add(LintMissingSummary, "the alert has no summary annotation")
+		}
+	}
+
+	expr, err := promql.ParseExpr(r.Expr)
+	if err != nil {
+		return res
+	}
+	promql.Inspect(expr, func(node promql.Node, path []promql.Node) error {
+		switch n := node.(type) {
+		case *promql.Call:
+			if !rangeFuncs[n.Func.Name] || scrapeInterval == 0 {
+				break
+			}
+			for _, arg := range n.Args {
+				if ms, ok := arg.(*promql.MatrixSelector); ok && ms.Range < 4*scrapeInterval {
+					add(LintShortRateRange, "%s over %s covers fewer than 4 scrapes at the scrape interval of %s", n.Func.Name, model.Duration(ms.Range), model.Duration(scrapeInterval))
+				}
+			}
+		case *promql.AggregateExpr:
+			switch op := n.Op.String(); {
+			case op == "count_values":
+				add(LintUnboundedCount, "count_values makes a series for every distinct sample value")
+			case op == "count" && n.Without:
+				add(LintUnboundedCount, "count without (%s) keeps every other label", strings.Join(n.Grouping, ", "))
+			case op == "count":
+				for _, l := range n.Grouping {
+					if highCardinalityLabels[l] {
+						add(LintUnboundedCount, "count by %s makes a series for every %s", l, l)
+					}
+				}
+			}
+		}
+		return nil
+	})
+
+	if c.RuleLintMaxLookback > 0 {
+		if lookback := calcMaxOffset(expr); lookback > c.RuleLintMaxLookback {
+			add(LintLargeLookback, "the expression looks back %s, more than %s", model.Duration(lookback), model.Duration(c.RuleLintMaxLookback))
+		}
+	}
+	return res
+}
+
+// lintRuleGroup lints the rules of rg, returning the findings that are
+// denied in the namespace of rg as errors, and the others as warnings.
+func (c *Controller) lintRuleGroup(rg *configV1beta1.RuleGroup) ([]error, []string) {
+	global, _ := c.baseGlobal("")
+	interval := time.Duration(global.ScrapeInterval)
+
+	var errs []error
+	var warnings []string
+	rules := c.convertedRules(rg)
+	for _, i := range sortedRuleIndexes(rules) {
+		r := rules[i]
+		name := r.Record
+		if r.Alert != "" {
+			name = r.Alert
+		}
+		for _, f := range c.lintRule(r, interval) {
+			if c.lintDenied(rg.Namespace, f.lint) {
+				errs = append(errs, &ruleError{Index: i, Name: name, Err: fmt.Errorf("%s [%s]", f.message, f.lint)})
+				continue
+			}
+			warnings = append(warnings, fmt.Sprintf("rule %d (%s): %s [%s]", i, name, f.message, f.lint))
+		}
+	}
+	return errs, warnings
+}
+
+// lintDenied reports whether the lint is promoted to a denial in the
+// namespace.
+func (c *Controller) lintDenied(namespace, lint string) bool {
+	for _, ns := range []string{namespace, "*"} {
+		for _, l := range c.RuleLintDeny[ns] {
+			if l == lint || l == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lintPolicyFlag is a flag that can be given several times, each time
+// promoting lints to denials in a namespace, as namespace=lint[,lint...].
+// The namespace and lint may be * for all namespaces or lints.
+type lintPolicyFlag map[string][]string
+
+func (f lintPolicyFlag) String() string {
+	var ss []string
+	for ns, ls := range f {
+		ss = append(ss, ns+"="+strings.Join(ls, ","))
+	}
+	sort.Strings(ss)
+	return strings.Join(ss, " ")
+}
+
+func (f lintPolicyFlag) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("invalid lint policy %q, expected namespace=lint[,lint...]", s)
+	}
+	for _, l := range splitList(parts[1]) {
+		known := l == "*"
+		for _, kl := range lints {
+			known = known || kl == l
+		}
+		if !known {
+			return fmt.Errorf("unknown lint %q, expected one of %s", l, strings.Join(lints, ", "))
+		}
+		f[parts[0]] = append(f[parts[0]], l)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+)
+
+func TestLintRule(t *testing.T) {
+	good := map[string]string{"summary": "something is wrong"}
+	tests := []struct {
+		name  string
+		rule  rulefmt.Rule
+		lints []string
+	}{
+		{
+			name: "good alert",
+			rule: rulefmt.Rule{
+				Alert:       "Down",
+				Expr:        "sum(rate(errors_total[5m])) by (job) > 1",
+				For:         model.Duration(5 * time.Minute),
+				Labels:      map[string]string{"severity": "page"},
+				Annotations: good,
+			},
+		},
+		{
+			name:  "bare alert",
+			rule:  rulefmt.Rule{Alert: "Down", Expr: "up == 0"},
+			lints: []string{LintAlertNoFor, LintMissingSeverity, LintMissingSummary},
+		},
+		{
+			name:  "short rate",
+			rule:  rulefmt.Rule{Record: "job:errors:rate1m", Expr: "sum(rate(errors_total[1m])) by (job)"},
+			lints: []string{LintShortRateRange},
+		},
+		{
+			name:  "count by pod",
+			rule:  rulefmt.Rule{Record: "pod:up:count", Expr: "count(up) by (pod)"},
+			lints: []string{LintUnboundedCount},
+		},
+		{
+			name:  "count without",
+			rule:  rulefmt.Rule{Record: "up:count", Expr: "count without (instance) (up)"},
+			lints: []string{LintUnboundedCount},
+		},
+		{
+			name:  "count_values",
+			rule:  rulefmt.Rule{Record: "build:count", Expr: `count_values("version", build_info)`},
+			lints: []string{LintUnboundedCount},
+		},
+		{
+			name:  "large lookback",
+			rule:  rulefmt.Rule{Record: "job:up:avg30d", Expr: "avg_over_time(up[30d])"},
+			lints: []string{LintLargeLookback},
+		},
+	}
+
+	c := &Controller{}
+	c.RuleLintMaxLookback = 7 * 24 * time.Hour
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, f := range c.lintRule(tt.rule, 30*time.Second) {
+				got = append(got, f.lint)
+			}
+			if !reflect.DeepEqual(got, tt.lints) {
+				t.Errorf("expected lints %v, got %v", tt.lints, got)
+			}
+		})
+	}
+}
+
+func TestLintRuleGroup(t *testing.T) {
+	rg := newRuleGroup("lint", `
+rules:
+- alert: Down
+  expr: up == 0
+  labels:
+    severity: page
+  annotations:
+    summary: down
+`)
+
+	policy := lintPolicyFlag{}
+	if err := policy.Set("*=missing-summary"); err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Set("default=alert-no-for"); err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Set("default=no-such-lint"); err == nil {
+		t.Errorf("expected an unknown lint to be rejected")
+	}
+
+	c := &Controller{}
+	errs, warnings := c.lintRuleGroup(rg)
+	if len(errs) != 0 || len(warnings) != 1 || !strings.Contains(warnings[0], "rule 0 (Down)") {
+		t.Errorf("expected a warning, got %v, %v", errs, warnings)
+	}
+
+	// Lints can be promoted to denials by namespace.
+	c.RuleLintDeny = policy
+	errs, warnings = c.lintRuleGroup(rg)
+	if len(errs) != 1 || len(warnings) != 0 || !strings.Contains(errs[0].Error(), "[alert-no-for]") {
+		t.Errorf("expected a denial, got %v, %v", errs, warnings)
+	}
+
+	rg.Namespace = "other"
+	if errs, _ = c.lintRuleGroup(rg); len(errs) != 0 {
+		t.Errorf("expected no denial in another namespace, got %v", errs)
+	}
+}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/prometheus/prometheus/promql"
+	yaml "gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	configV1beta1 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+// Reasons used for the Loaded condition.
+const (
+	ReasonLoaded     = "Loaded"
+	ReasonLoadFailed = "LoadFailed"
+)
+
+// A LoadChecker confirms that prometheus has loaded rendered configuration.
+// The checks return nil once the configuration is loaded, a *loadFailure if
+// prometheus has rejected it, and any other error if it is not yet loaded.
+// Only reloads at or after since, when the configuration was rendered, are
+// considered.
+type LoadChecker interface {
+	ConfigLoaded(ctx context.Context, since time.Time, cfg []byte) error
+	RulesLoaded(ctx context.Context, since time.Time, groups *rulefmt.RuleGroups) error
+}
+
+// loadFailure is returned by a LoadChecker when prometheus has failed to
+// load the configuration.
+type loadFailure struct {
+	msg string
+}
+
+func (e *loadFailure) Error() string {
+	return e.msg
+}
+
+// configHash identifies a rendering of some configuration.
+func configHash(bs []byte) string {
+	return fmt.Sprintf("%x", sha1.Sum(bs))
+}
+
+// pieceHash identifies the config rendered for a single object, it is empty
+// if nothing was rendered.
+func pieceHash(v interface{}) string {
+	if rv := reflect.ValueOf(v); !rv.IsValid() || rv.IsNil() {
+		return ""
+	}
+	bs, err := yaml.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return configHash(bs)
+}
+
+// loadTracker tracks whether prometheus has loaded the latest rendering of
+// the scrape config, or the rules, and the rendered piece of each object
+// that contributed to it.
+type loadTracker struct {
+	sync.Mutex
+
+	hash       string
+	renderedAt time.Time
+	pieces     map[string]string
+	check      func(context.Context, time.Time) error
+
+	confirmed string
+	failed    string
+	failure   string
+
+	loaded       map[string]string
+	failedPieces map[string]string
+}
+
+func newLoadTracker() *loadTracker {
+	return &loadTracker{
+		loaded:       map[string]string{},
+		failedPieces: map[string]string{},
+	}
+}
+
+// status returns the Loaded condition for the object with the given key,
+// whose rendered piece has the given hash.
+func (t *loadTracker) status(key, piece string) loadStatus {
+	t.Lock()
+	defer t.Unlock()
+	switch {
+	case piece == "":
+		return unconfirmedLoad
+	case t.loaded[key] == piece:
+		return loadStatus{metav1.ConditionTrue, ReasonLoaded, "prometheus has loaded the rendered configuration"}
+	case t.failedPieces[key] == piece:
+		return loadStatus{metav1.ConditionFalse, ReasonLoadFailed, t.failure}
+	default:
+		return unconfirmedLoad
+	}
+}
+
+// rendered records the latest rendering. pieces maps the key of each
+// contributing object to the hash of its own rendered config.
+func (t *loadTracker) rendered(hash string, pieces map[string]string, now time.Time, check func(context.Context, time.Time) error) {
+	t.Lock()
+	defer t.Unlock()
+	if hash == t.hash {
+		return
+	}
+	t.hash = hash
+	t.renderedAt = now
+	t.pieces = pieces
+	t.check = check
+}
+
+// pending returns the latest rendering if it has not yet been confirmed or
+// failed.
+func (t *loadTracker) pending() (string, time.Time, func(context.Context, time.Time) error) {
+	t.Lock()
+	defer t.Unlock()
+	if t.check == nil || t.hash == t.confirmed || t.hash == t.failed {
+		return "", time.Time{}, nil
+	}
+	return t.hash, t.renderedAt, t.check
+}
+
+// resolve records the result of checking the rendering with the given hash,
+// and returns the pieces of the objects it affects.
+func (t *loadTracker) resolve(hash string, failure error) map[string]string {
+	t.Lock()
+	defer t.Unlock()
+	if hash != t.hash {
+		// a newer rendering has replaced this one
+		return nil
+	}
+
+	pieces := map[string]string{}
+	for k, v := range t.pieces {
+		pieces[k] = v
+	}
+
+	if failure == nil {
+		t.confirmed = hash
+		t.loaded = pieces
+		return pieces
+	}
+
+	t.failed = hash
+	t.failure = failure.Error()
+	t.failedPieces = pieces
+	return pieces
+}
+
+// runLoadChecker checks whether pending renderings have been loaded by
+// prometheus, and updates the Loaded condition of the objects that
+// contributed to them.
+func (c *Controller) runLoadChecker() {
+	if c.LoadChecker == nil {
+		return
+	}
+	c.checkLoad(c.configLoads, c.setScrapeLoaded)
+	c.checkLoad(c.rulesLoads, c.setRuleGroupLoaded)
+}
+
+func (c *Controller) checkLoad(t *loadTracker, set func(key string, st loadStatus)) {
+	hash, renderedAt, check := t.pending()
+	if check == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.LoadTimeout)
+	defer cancel()
+	err := check(ctx, renderedAt)
+	if err != nil {
+		if _, ok := err.(*loadFailure); !ok {
+			if c.now().Sub(renderedAt) < c.LoadTimeout {
+				glog.V(2).Infof("configuration %s not yet loaded, %v", hash, err)
+				return
+			}
+			err = &loadFailure{fmt.Sprintf("timed out waiting for prometheus to load the configuration, %v", err)}
+		}
+	}
+
+	pieces := t.resolve(hash, err)
+	st := loadStatus{metav1.ConditionTrue, ReasonLoaded, "prometheus has loaded the rendered configuration"}
+	if err != nil {
+		glog.Infof("prometheus did not load configuration %s, %v", hash, err)
+		st = loadStatus{metav1.ConditionFalse, ReasonLoadFailed, err.Error()}
+	} else {
+		glog.Infof("prometheus loaded configuration %s", hash)
+	}
+
+	for key := range pieces {
+		set(key, st)
+	}
+}
+
+func (c *Controller) setRuleGroupLoaded(key string, st loadStatus) {
+	ctx := context.Background()
+	ns, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	org, err := c.rulesLister.RuleGroups(ns).Get(name)
+	if err != nil {
+		glog.V(2).Infof("could not get rule group %s, %v", key, err)
+		return
+	}
+
+	rg := org.DeepCopy()
+	c.setLoadedCondition(&rg.Status.Conditions, rg.Status.ObservedGeneration, st)
+	if reflect.DeepEqual(org.Status, rg.Status) {
+		return
+	}
+	c.recordLoadEvent(rg, st)
+	if _, err = c.confclientset.ConfigV1beta1().RuleGroups(ns).UpdateStatus(ctx, rg, metav1.UpdateOptions{}); err != nil {
+		glog.Infof("updating status of %s failed, %v", key, err)
+	}
+}
+
+func (c *Controller) setScrapeLoaded(key string, st loadStatus) {
+	ctx := context.Background()
+	ns, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	org, err := c.scrapesLister.Scrapes(ns).Get(name)
+	if err != nil {
+		glog.V(2).Infof("could not get scrape %s, %v", key, err)
+		return
+	}
+
+	s := org.DeepCopy()
+	c.setLoadedCondition(&s.Status.Conditions, s.Status.ObservedGeneration, st)
+	if reflect.DeepEqual(org.Status, s.Status) {
+		return
+	}
+	c.recordLoadEvent(s, st)
+	if _, err = c.confclientset.ConfigV1beta1().Scrapes(ns).UpdateStatus(ctx, s, metav1.UpdateOptions{}); err != nil {
+		glog.Infof("updating status of %s failed, %v", key, err)
+	}
+}
+
+func (c *Controller) setLoadedCondition(conds *[]metav1.Condition, generation int64, st loadStatus) {
+	meta.SetStatusCondition(conds, metav1.Condition{
+		Type:               configV1beta1.ConditionLoaded,
+		Status:             st.Status,
+		ObservedGeneration: generation,
+		LastTransitionTime: metav1.NewTime(c.now()),
+		Reason:             st.Reason,
+		Message:            st.Message,
+	})
+}
+
+func (c *Controller) recordLoadEvent(obj k8sruntime.Object, st loadStatus) {
+	if st.Status == metav1.ConditionTrue {
+		c.recordEvent(obj, loadSlot, corev1.EventTypeNormal, st.Reason, st.Message)
+		return
+	}
+	c.recordEvent(obj, loadSlot, corev1.EventTypeWarning, st.Reason, st.Message)
+}
+
+// promLoadChecker checks the configuration loaded by prometheus using its
+// HTTP API.
+type promLoadChecker struct {
+	client  *http.Client
+	targets func() []*url.URL
+}
+
+// ConfigLoaded checks every target has successfully reloaded, and reports a
+// config that contains every setting in cfg.
+func (p *promLoadChecker) ConfigLoaded(ctx context.Context, since time.Time, cfg []byte) error {
+	var want interface{}
+	if err := yaml.Unmarshal(cfg, &want); err != nil {
+		return errors.Wrap(err, "parsing rendered config")
+	}
+
+	return p.forEachTarget(ctx, since, func(base *url.URL) error {
+		res := struct {
+			YAML string `json:"yaml"`
+		}{}
+		if err := p.getAPI(ctx, base, "/api/v1/status/config", &res); err != nil {
+			return err
+		}
+
+		var got interface{}
+		if err := yaml.Unmarshal([]byte(res.YAML), &got); err != nil {
+			return errors.Wrap(err, "parsing loaded config")
+		}
+		if !yamlContains(got, want) {
+			return fmt.Errorf("%s has not loaded the rendered config", base.Host)
+		}
+		return nil
+	})
+}
+
+// RulesLoaded checks every target has successfully reloaded, and reports
+// each of the rendered rule groups with the same rules and queries.
+func (p *promLoadChecker) RulesLoaded(ctx context.Context, since time.Time, groups *rulefmt.RuleGroups) error {
+	return p.forEachTarget(ctx, since, func(base *url.URL) error {
+		res := struct {
+			Groups []struct {
+				Name  string       `json:"name"`
+				Rules []loadedRule `json:"rules"`
+			} `json:"groups"`
+		}{}
+		if err := p.getAPI(ctx, base, "/api/v1/rules", &res); err != nil {
+			return err
+		}
+
+		loaded := map[string][]loadedRule{}
+		for _, g := range res.Groups {
+			loaded[g.Name] = g.Rules
+		}
+
+		for _, g := range groups.Groups {
+			var rules []loadedRule
+			for _, r := range g.Rules {
+				name := r.Record
+				if r.Alert != "" {
+					name = r.Alert
+				}
+				rules = append(rules, loadedRule{Name: name, Query: loadedQuery(r.Expr)})
+			}
+			got, ok := loaded[g.Name]
+			if !ok || !reflect.DeepEqual(got, rules) {
+				return fmt.Errorf("%s has not loaded rule group %s", base.Host, g.Name)
+			}
+		}
+		return nil
+	})
+}
+
+// loadedRule is a rule as reported by the prometheus rules API.
+type loadedRule struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+// loadedQuery returns expr as prometheus reports it once loaded, which is
+// the printed form of the parsed expression.
+func loadedQuery(expr string) string {
+	e, err := promql.ParseExpr(expr)
+	if err != nil {
+		return expr
+	}
+	return e.String()
+}
+
+func (p *promLoadChecker) forEachTarget(ctx context.Context, since time.Time, check func(*url.URL) error) error {
+	targets := p.targets()
+	if len(targets) == 0 {
+		return errors.New("no prometheus targets to check")
+	}
+	for _, base := range targets {
+		if err := p.reloadSucceeded(ctx, base, since); err != nil {
+			return err
+		}
+		if err := check(base); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reloadSucceeded returns nil if the prometheus at base has successfully
+// reloaded its configuration at or after since, and a *loadFailure if its
+// last reload after since failed. Until it has reloaded after since the
+// result of an earlier reload says nothing about the latest rendering, so
+// any other error is returned.
+func (p *promLoadChecker) reloadSucceeded(ctx context.Context, base *url.URL, since time.Time) error {
+	body, err := p.get(ctx, base, "/metrics")
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	var parser expfmt.TextParser
+	mfs, err := parser.TextToMetricFamilies(body)
+	if err != nil {
+		return errors.Wrap(err, "parsing prometheus metrics")
+	}
+
+	gauge := func(name string) (float64, bool) {
+		mf, ok := mfs[name]
+		if !ok || len(mf.GetMetric()) == 0 {
+			return 0, false
+		}
+		return mf.GetMetric()[0].GetGauge().GetValue(), true
+	}
+
+	successful, ok := gauge("prometheus_config_last_reload_successful")
+	if !ok {
+		successful = 1
+	}
+	reloadedAt, ok := gauge("prometheus_config_last_reload_success_timestamp_seconds")
+	if !ok {
+		return fmt.Errorf("prometheus at %s does not report when it last reloaded its configuration", base.Host)
+	}
+
+	// The timestamp has sub-second precision, since is truncated to allow
+	// for a little clock skew.
+	if reloadedAt < float64(since.Unix()) {
+		if successful != 1 {
+			return fmt.Errorf("prometheus at %s failed to reload its configuration", base.Host)
+		}
+		return fmt.Errorf("prometheus at %s has not reloaded its configuration since it was rendered", base.Host)
+	}
+	if successful != 1 {
+		return &loadFailure{fmt.Sprintf("prometheus at %s failed to reload its configuration", base.Host)}
+	}
+	return nil
+}
+
+func (p *promLoadChecker) getAPI(ctx context.Context, base *url.URL, apiPath string, data interface{}) error {
+	body, err := p.get(ctx, base, apiPath)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	res := struct {
+		Status string          `json:"status"`
+		Error  string          `json:"error"`
+		Data   json.RawMessage `json:"data"`
+	}{}
+	if err = json.NewDecoder(body).Decode(&res); err != nil {
+		return errors.Wrapf(err, "decoding %s response", apiPath)
+	}
+	if res.Status != "success" {
+		return fmt.Errorf("%s request failed, %s", apiPath, res.Error)
+	}
+	return errors.Wrapf(json.Unmarshal(res.Data, data), "decoding %s data", apiPath)
+}
+
+func (p *promLoadChecker) get(ctx context.Context, base *url.URL, apiPath string) (io.ReadCloser, error) {
+	u := *base
+	u.Path = path.Join(u.Path, apiPath)
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+		return nil, fmt.Errorf("request to %s failed, %s", u.String(), res.Status)
+	}
+	return res.Body, nil
+}
+
+// yamlContains reports whether every non-empty value in want is also in got.
+// Secrets, which prometheus redacts, match any value.
+func yamlContains(got, want interface{}) bool {
+	switch w := want.(type) {
+	case map[interface{}]interface{}:
+		g, ok := got.(map[interface{}]interface{})
+		if !ok {
+			return false
+		}
+		for k, wv := range w {
+			if isEmptyYAML(wv) {
+				continue
+			}
+			if !yamlContains(g[k], wv) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(g) != len(w) {
+			return false
+		}
+		for i := range w {
+			if !yamlContains(g[i], w[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		if got == "<secret>" {
+			return true
+		}
+		return fmt.Sprint(got) == fmt.Sprint(want)
+	}
+}
+
+func isEmptyYAML(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	conf "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+	listers "github.com/QubitProducts/prom-config-controller/pkg/client/listers/config/v1beta1"
+)
+
+// stubProm serves the parts of the prometheus HTTP API used to confirm
+// configuration has been loaded, and to list metric names.
+type stubProm struct {
+	sync.Mutex
+	reloadOK   bool
+	reloadedAt time.Time
+	config     string
+	rules      map[string][]loadedRule
+	metrics    []string
+	requests   int
+}
+
+func (p *stubProm) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.Lock()
+	defer p.Unlock()
+	p.requests++
+
+	reply := func(data interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "data": data})
+	}
+
+	switch r.URL.Path {
+	case "/metrics":
+		v := 0
+		if p.reloadOK {
+			v = 1
+		}
+		fmt.Fprintf(w, "# TYPE prometheus_config_last_reload_successful gauge\nprometheus_config_last_reload_successful %d\n", v)
+		fmt.Fprintf(w, "# TYPE prometheus_config_last_reload_success_timestamp_seconds gauge\nprometheus_config_last_reload_success_timestamp_seconds %f\n", float64(p.reloadedAt.UnixNano())/1e9)
+	case "/api/v1/status/config":
+		reply(map[string]string{"yaml": p.config})
+	case "/api/v1/rules":
+		var groups []interface{}
+		for name, rules := range p.rules {
+			groups = append(groups, map[string]interface{}{"name": name, "rules": rules})
+		}
+		reply(map[string]interface{}{"groups": groups})
+	case "/api/v1/label/__name__/values":
+		reply(p.metrics)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *stubProm) set(reloadOK bool, reloadedAt time.Time, config string) {
+	p.Lock()
+	defer p.Unlock()
+	p.reloadOK = reloadOK
+	p.reloadedAt = reloadedAt
+	p.config = config
+}
+
+func newStubChecker(t *testing.T, p *stubProm) *promLoadChecker {
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &promLoadChecker{
+		client:  srv.Client(),
+		targets: func() []*url.URL { return []*url.URL{u} },
+	}
+}
+
+func TestPromLoadCheckerConfig(t *testing.T) {
+	rendered := `global:
+  scrape_interval: 1m
+scrape_configs:
+- job_name: default/test
+  basic_auth:
+    username: user
+    password: pass
+`
+	loaded := `global:
+  scrape_interval: 1m
+  scrape_timeout: 10s
+scrape_configs:
+- job_name: default/test
+  honor_labels: false
+  basic_auth:
+    username: user
+    password: <secret>
+`
+	old := `global:
+  scrape_interval: 1m
+scrape_configs: []
+`
+
+	tests := []struct {
+		name       string
+		reloadOK   bool
+		reloadedAt time.Time
+		config     string
+		failure    bool
+		err        bool
+	}{
+		{name: "loaded", reloadOK: true, reloadedAt: testNow, config: loaded},
+		{name: "not yet loaded", reloadOK: true, reloadedAt: testNow, config: old, err: true},
+		{name: "not yet reloaded", reloadOK: true, reloadedAt: testNow.Add(-time.Minute), config: loaded, err: true},
+		{name: "reload failed", reloadOK: false, reloadedAt: testNow, config: old, err: true, failure: true},
+		{name: "earlier reload failed", reloadOK: false, reloadedAt: testNow.Add(-time.Minute), config: old, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &stubProm{}
+			p.set(tt.reloadOK, tt.reloadedAt, tt.config)
+			err := newStubChecker(t, p).ConfigLoaded(context.Background(), testNow, []byte(rendered))
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if _, ok := err.(*loadFailure); ok != tt.failure {
+				t.Fatalf("expected load failure %v, got %v", tt.failure, err)
+			}
+		})
+	}
+}
+
+func TestPromLoadCheckerRules(t *testing.T) {
+	groups := &rulefmt.RuleGroups{
+		Groups: []rulefmt.RuleGroup{
+			{
+				Name: "default/test",
+				Rules: []rulefmt.Rule{
+					{Record: "something", Expr: "1 + 1"},
+					{Alert: "Something", Expr: "1 > 0"},
+				},
+			},
+		},
+	}
+
+	p := &stubProm{
+		reloadOK:   true,
+		reloadedAt: testNow,
+		rules:      map[string][]loadedRule{"default/test": {{Name: "something", Query: "1 + 1"}}},
+	}
+	c := newStubChecker(t, p)
+	if err := c.RulesLoaded(context.Background(), testNow, groups); err == nil {
+		t.Fatalf("expected error for missing rule")
+	}
+
+	p.Lock()
+	p.rules["default/test"] = []loadedRule{{Name: "something", Query: "1 + 2"}, {Name: "Something", Query: "1 > 0"}}
+	p.Unlock()
+	if err := c.RulesLoaded(context.Background(), testNow, groups); err == nil {
+		t.Fatalf("expected error for changed query")
+	}
+
+	p.Lock()
+	p.rules["default/test"] = []loadedRule{{Name: "something", Query: "1 + 1"}, {Name: "Something", Query: "1 > 0"}}
+	p.Unlock()
+	if err := c.RulesLoaded(context.Background(), testNow, groups); err != nil {
+		t.Fatalf("expected rules to be loaded, got %v", err)
+	}
+}
+
+func TestConfirmScrapeLoaded(t *testing.T) {
+	tests := []struct {
+		name     string
+		reloadOK bool
+		stale    bool
+		loaded   bool
+		now      time.Time
+		status   metav1.ConditionStatus
+		reason   string
+		event    string
+	}{
+		{
+			name:     "loaded",
+			reloadOK: true,
+			loaded:   true,
+			now:      testNow,
+			status:   metav1.ConditionTrue,
+			reason:   ReasonLoaded,
+			event:    "Normal Loaded",
+		},
+		{
+			name:     "pending",
+			reloadOK: true,
+			now:      testNow,
+			status:   metav1.ConditionUnknown,
+			reason:   ReasonUnconfirmed,
+		},
+		{
+			name:     "timed out",
+			reloadOK: true,
+			now:      testNow.Add(time.Hour),
+			status:   metav1.ConditionFalse,
+			reason:   ReasonLoadFailed,
+			event:    "Warning LoadFailed",
+		},
+		{
+			name:     "reload failed",
+			reloadOK: false,
+			now:      testNow,
+			status:   metav1.ConditionFalse,
+			reason:   ReasonLoadFailed,
+			event:    "Warning LoadFailed",
+		},
+		{
+			name:     "earlier reload failed",
+			reloadOK: false,
+			stale:    true,
+			now:      testNow,
+			status:   metav1.ConditionUnknown,
+			reason:   ReasonUnconfirmed,
+		},
+		{
+			name:     "earlier reload failed and timed out",
+			reloadOK: false,
+			stale:    true,
+			now:      testNow.Add(time.Hour),
+			status:   metav1.ConditionFalse,
+			reason:   ReasonLoadFailed,
+			event:    "Warning LoadFailed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			scrape := newScrape("test", testScrape)
+			f.scrapeLister = append(f.scrapeLister, scrape)
+			f.objects = append(f.objects, scrape)
+
+			p := &stubProm{}
+			c, _, _ := f.newController()
+			recorder := record.NewFakeRecorder(10)
+			c.recorder = recorder
+			c.LoadChecker = newStubChecker(t, p)
+			c.LoadTimeout = time.Minute
+
+			if _, err := c.syncConfigHandler(); err != nil {
+				t.Fatalf("sync failed, %v", err)
+			}
+			if ev := <-recorder.Events; !strings.HasPrefix(ev, "Normal Synced") {
+				t.Fatalf("expected synced event, got %q", ev)
+			}
+
+			config := ""
+			if tt.loaded {
+				config = testSecret
+			}
+			reloadedAt := testNow
+			if tt.stale {
+				reloadedAt = testNow.Add(-time.Minute)
+			}
+			p.set(tt.reloadOK, reloadedAt, config)
+
+			// The status update is only seen by the lister in a running
+			// controller.
+			ctx := context.Background()
+			s, err := f.client.ConfigV1beta1().Scrapes("default").Get(ctx, "test", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("getting scrape failed, %v", err)
+			}
+			c.scrapesLister = fakeScrapeLister(t, s)
+
+			c.now = func() time.Time { return tt.now }
+			c.runLoadChecker()
+
+			s, err = f.client.ConfigV1beta1().Scrapes("default").Get(ctx, "test", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("getting scrape failed, %v", err)
+			}
+			cond := meta.FindStatusCondition(s.Status.Conditions, conf.ConditionLoaded)
+			if cond == nil || cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Fatalf("expected Loaded condition %s %s, got %#v", tt.status, tt.reason, cond)
+			}
+
+			select {
+			case ev := <-recorder.Events:
+				if !strings.HasPrefix(ev, tt.event) || tt.event == "" {
+					t.Errorf("expected event %q, got %q", tt.event, ev)
+				}
+			default:
+				if tt.event != "" {
+					t.Errorf("expected event %q", tt.event)
+				}
+			}
+
+			// Later syncs keep the result of the check.
+			c.scrapesLister = fakeScrapeLister(t, s)
+			if _, err := c.syncConfigHandler(); err != nil {
+				t.Fatalf("sync failed, %v", err)
+			}
+			s, err = f.client.ConfigV1beta1().Scrapes("default").Get(ctx, "test", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("getting scrape failed, %v", err)
+			}
+			cond = meta.FindStatusCondition(s.Status.Conditions, conf.ConditionLoaded)
+			if cond == nil || cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Fatalf("expected Loaded condition %s %s after resync, got %#v", tt.status, tt.reason, cond)
+			}
+		})
+	}
+}
+
+func fakeScrapeLister(t *testing.T, ss ...*conf.Scrape) listers.ScrapeLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, s := range ss {
+		if err := indexer.Add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return listers.NewScrapeLister(indexer)
+}
@@ -27,9 +27,12 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"text/template"
 	"time"
 
@@ -41,6 +44,7 @@ import (
 
 	gke "cloud.google.com/go/container/apiv1"
 
+	apiextclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 
@@ -65,14 +69,54 @@ var (
 	rulesMapName string
 	rulesMapKey  string
 	rulesFile    string
+	rulesDir     string
+
+	rulerURL             string
+	rulerTenant          string
+	rulerNamespacePrefix string
+
+	fileMode     string
+	fileUID      int
+	fileGID      int
+	fileSync     bool
+	fileChecksum bool
+
+	rulesShardBy   string
+	rulesShardSize int
+	rulesShardDir  string
 
 	configTemplate string
 
+	jobNamePolicy   string
+	jobNameTemplate string
+
+	namespaceIsolation bool
+	scrapeFiles        string
+
+	rulesNamespaceIsolation bool
+	rulesExemptNamespaces   string
+	rulesExemptKey          string
+	rulesLintDeny           = lintPolicyFlag{}
+	rulesLintMaxLookback    time.Duration
+
 	configSecNS   string
 	configSecName string
 	configSecKey  string
 	configFile    string
 
+	alertmanagerTemplate    string
+	alertmanagerSecNS       string
+	alertmanagerSecName     string
+	alertmanagerSecKey      string
+	alertmanagerFile        string
+	alertmanagerReloadHost  string
+	alertmanagerReloadPath  string
+	alertmanagerEndpointsNS string
+	alertmanagerEndpoints   string
+	alertmanagerTargets     reloadTargetsFlag
+	alertmanagerSilences    bool
+	alertmanagerSignal      string
+
 	namespace string
 	selector  string
 
@@ -86,8 +130,22 @@ var (
 	reloadPath        string
 	reloadEndpointsNS string
 	reloadEndpoints   string
+	reloadTargets     reloadTargetsFlag
 	reloadDelay       time.Duration
+	reloadMaxDelay    time.Duration
+	reloadMinInterval time.Duration
 	reloadRetries     int
+	reloadSignal      string
+	reloadProcDir     string
+
+	renderDelay time.Duration
+
+	reloadConfirm        bool
+	reloadConfirmTimeout time.Duration
+
+	rulesMetricsCheck bool
+	rulesMetricsURL   string
+	rulesMetricsCache time.Duration
 
 	gcpProject string
 	gcpKeysDir string
@@ -101,14 +159,47 @@ func init() {
 	flag.StringVar(&namespace, "namespace", "", "namespace to watch for resources")
 	flag.StringVar(&selector, "labels", "", "label selector for resources")
 	flag.StringVar(&configTemplate, "config.template", "config.yaml.tmpl", "")
+	flag.StringVar(&jobNamePolicy, "scrape.jobname.policy", JobNameGenerated, "How scrape job names are chosen, one of generated (namespace/name), user (the job_name in the spec), or template")
+	flag.StringVar(&jobNameTemplate, "scrape.jobname.template", "{{ .Namespace }}/{{ .Name }}", "Go template used to name scrape jobs with the template policy, given .Namespace, .Name, .JobName, .Labels and .Annotations")
+	flag.BoolVar(&namespaceIsolation, "scrape.namespace.isolation", false, "Restrict scrapes to kubernetes service discovery of their own namespace, and force a namespace label on their targets")
+	flag.StringVar(&scrapeFiles, "scrape.files", "", "Comma separated list of the files, and directories ending in /, that exist in the prometheus pods. If set, scrapes that refer to other files, such as a bearer_token_file, are denied by the webhook")
+	flag.BoolVar(&rulesNamespaceIsolation, "rules.namespace.isolation", false, "Restrict rule expressions to series from the rule group's own namespace, and force a namespace label on their output")
+	flag.StringVar(&rulesExemptNamespaces, "rules.namespace.isolation.exempt-namespaces", "", "Comma separated list of namespaces whose rule groups are not namespace isolated")
+	flag.StringVar(&rulesExemptKey, "rules.namespace.isolation.exempt-key", "", "Rule groups with this label or annotation set to \"true\" are not namespace isolated. Only set this if users can not set it on their own rule groups")
+	flag.Var(rulesLintDeny, "rules.lint.deny", "Lints to deny rule groups for in a namespace, rather than warn about, as namespace=lint[,lint...]. The namespace or lint may be * for all. Lints are alert-no-for, missing-severity, missing-summary, short-rate-range, unbounded-count and large-lookback. May be given more than once")
+	flag.DurationVar(&rulesLintMaxLookback, "rules.lint.max-lookback", 7*24*time.Hour, "Warn about rule expressions that look back further than this, 0 disables the warning")
 	flag.StringVar(&rulesMapNS, "rules.configmap.namespace", "infra", "")
 	flag.StringVar(&rulesMapName, "rules.configmap.name", "prom-config-controller", "")
 	flag.StringVar(&rulesMapKey, "rules.configmap.key", "rules.yaml", "")
 	flag.StringVar(&rulesFile, "rules.file", "rules.yaml", "")
+	flag.StringVar(&fileMode, "file.mode", "0644", "Permissions, in octal, of the rules and config files written")
+	flag.IntVar(&fileUID, "file.uid", -1, "User ID to own the rules and config files written, -1 leaves it unchanged")
+	flag.IntVar(&fileGID, "file.gid", -1, "Group ID to own the rules and config files written, -1 leaves it unchanged")
+	flag.BoolVar(&fileSync, "file.sync", false, "fsync the rules and config files, and their directories, when they are written")
+	flag.BoolVar(&fileChecksum, "file.checksum", false, "Write a sha256sum checksum file alongside each rules and config file, and report files that no longer match it")
+	flag.StringVar(&rulerURL, "rules.ruler.url", "", "URL of the rules endpoint of a Cortex, Mimir or Loki ruler to push rule groups to, e.g. http://mimir/prometheus/config/v1/rules")
+	flag.StringVar(&rulerTenant, "rules.ruler.tenant", "", "Tenant to push rule groups to the ruler as, sent in the X-Scope-OrgID header")
+	flag.StringVar(&rulerNamespacePrefix, "rules.ruler.namespace-prefix", "", "Prefix for the ruler namespaces of rule groups. Rule groups of the tenant in namespaces with this prefix that were not pushed by the controller are deleted, so it must be set with rules.ruler.url")
+	flag.StringVar(&rulesDir, "rules.dir", "", "Directory to write each rule group to, as <namespace>/<name>.yaml, instead of rules.file and the rules ConfigMap, which are removed. A rule_files glob for it is added to the rendered config")
+	flag.StringVar(&rulesShardBy, "rules.shard", ShardRulesNone, "How the rules are split across ConfigMaps, one of none (a single ConfigMap), namespace (ConfigMaps named <rules.configmap.name>-<namespace>-<n>), or size (ConfigMaps named <rules.configmap.name>-<n>)")
+	flag.IntVar(&rulesShardSize, "rules.shard.size", 512*1024, "Maximum size in bytes of the rules in each shard ConfigMap")
+	flag.StringVar(&rulesShardDir, "rules.shard.dir", "/etc/prometheus/rules", "Directory that prometheus has the rule shards mounted in, a rule_files glob for it is added to the rendered config when rules are sharded")
 	flag.StringVar(&configSecNS, "config.secret.namespace", "infra", "")
 	flag.StringVar(&configSecName, "config.secret.name", "prom-config-controller", "")
 	flag.StringVar(&configSecKey, "config.secret.key", "config.yaml", "")
 	flag.StringVar(&configFile, "config.file", "config.yaml", "")
+	flag.StringVar(&alertmanagerTemplate, "alertmanager.template", "", "Base alertmanager config template that the routes and receivers of AlertRoutes are added to. AlertRoutes are ignored if this is not set")
+	flag.StringVar(&alertmanagerSecNS, "alertmanager.secret.namespace", "infra", "Namespace of the secret the rendered alertmanager config is written to")
+	flag.StringVar(&alertmanagerSecName, "alertmanager.secret.name", "prom-config-controller-alertmanager", "Name of the secret the rendered alertmanager config is written to")
+	flag.StringVar(&alertmanagerSecKey, "alertmanager.secret.key", "alertmanager.yaml", "Key in the secret that the rendered alertmanager config is written to")
+	flag.StringVar(&alertmanagerFile, "alertmanager.file", "", "File to write the rendered alertmanager config to, it is not written if this is not set")
+	flag.StringVar(&alertmanagerReloadHost, "alertmanager.reload.host", "localhost:9093", "host:port for alertmanager reload, as for reload.host")
+	flag.StringVar(&alertmanagerReloadPath, "alertmanager.reload.path", "/-/reload", "HTTP path requested to reload alertmanager when its config changes")
+	flag.StringVar(&alertmanagerEndpointsNS, "alertmanager.reload.endpointsns", "", "Namespace of the Endpoints object listing the alertmanager servers to reload, as for reload.endpointsns")
+	flag.StringVar(&alertmanagerEndpoints, "alertmanager.reload.endpoints", "", "Name of the Endpoints object listing the alertmanager servers to reload, the port of alertmanager.reload.host is used")
+	flag.Var(&alertmanagerTargets, "alertmanager.reload.target", "Set of alertmanager servers to reload, as for reload.target, may be given more than once")
+	flag.StringVar(&alertmanagerSignal, "alertmanager.reload.signal", "", "Name of an alertmanager process to reload by sending it SIGHUP, in place of the HTTP reload, as for reload.signal")
+	flag.BoolVar(&alertmanagerSilences, "alertmanager.silences", false, "Put the silences of Silence resources in place using the alertmanager API at the alertmanager reload host or endpoints")
 	flag.StringVar(&serviceNS, "service.namespace", "infra", "The namespace that the controllers service is registered in")
 	flag.StringVar(&serviceName, "service.name", "prom-config-controller", "The controllers service name")
 	flag.StringVar(&tlsKey, "tls.key", "tls.key", "Path to TLS key file")
@@ -120,8 +211,19 @@ func init() {
 	flag.StringVar(&reloadPath, "reload.path", "/-/reload", "On config change, Reload")
 	flag.StringVar(&reloadEndpointsNS, "reload.endpointsns", "", "On config change, Reload")
 	flag.StringVar(&reloadEndpoints, "reload.endpoints", "", "On config change, Reload")
-	flag.DurationVar(&reloadDelay, "reload.delay", 2*time.Second, "delay to allow configmap changes to propagate")
+	flag.Var(&reloadTargets, "reload.target", "Set of servers to reload, discovered as kind:namespace/name:port[:notready]. kind is endpoints (an Endpoints object), endpointslices (the EndpointSlices of a service) or pods (the name is a pod label selector). The port may be a port name. Servers that are not ready are only reloaded with :notready. May be given more than once")
+	flag.DurationVar(&reloadDelay, "reload.delay", 2*time.Second, "delay to allow configmap changes to propagate, reloads requested within this delay of each other are combined")
+	flag.DurationVar(&reloadMaxDelay, "reload.delay.max", 30*time.Second, "longest that a reload is put off while further reloads are requested")
+	flag.DurationVar(&reloadMinInterval, "reload.min-interval", 10*time.Second, "minimum time between the start of reloads, a reload that is still retrying when the next starts is cancelled")
 	flag.IntVar(&reloadRetries, "reload.retries", 4, "number of retries when reloading")
+	flag.StringVar(&reloadSignal, "reload.signal", "", "Name of a process to reload by sending it SIGHUP, in place of the HTTP reload. The process must be in the same PID namespace, e.g. a sidecar in a pod with shareProcessNamespace")
+	flag.StringVar(&reloadProcDir, "reload.signal.proc", "/proc", "Where the proc filesystem used to find processes to signal is mounted")
+	flag.DurationVar(&renderDelay, "render.delay", time.Second, "how long to collect changes for before rendering them together")
+	flag.BoolVar(&reloadConfirm, "reload.confirm", false, "Confirm that prometheus has loaded the rendered configuration, using its HTTP API at the reload host or endpoints, and report it in the Loaded condition")
+	flag.BoolVar(&rulesMetricsCheck, "rules.metrics.check", false, "Warn about rules that select metrics prometheus has no series for, at admission and in the MetricsFound condition of rule groups. Prometheus is queried at rules.metrics.url, or the reload host or endpoints")
+	flag.StringVar(&rulesMetricsURL, "rules.metrics.url", "", "URL of the prometheus API used to check the metrics of rules, e.g. http://prometheus:9090")
+	flag.DurationVar(&rulesMetricsCache, "rules.metrics.cache", time.Minute, "how long the metric names listed by prometheus are reused for")
+	flag.DurationVar(&reloadConfirmTimeout, "reload.confirm.timeout", 2*time.Minute, "how long to wait for prometheus to load the rendered configuration before reporting a failure")
 
 	flag.StringVar(&gcpProject, "gcpProject", "", "Google Cloud project to scan for GKE clusters")
 	flag.StringVar(&gcpKeysDir, "gcpKeysDir", ".", "directory to write client keys to")
@@ -138,6 +240,28 @@ func (fl *filteredLog) Write(bs []byte) (int, error) {
 	return fl.base.Write(bs)
 }
 
+// splitList splits a comma separated flag value, ignoring empty items.
+func splitList(s string) []string {
+	var res []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// legacyReloadTargets adds the Endpoints object given by the endpointsns
+// and endpoints flags, reloaded on the port of the reload host, to the
+// targets.
+func legacyReloadTargets(ns, name, port string, targets []reloadTarget) []reloadTarget {
+	if ns == "" || name == "" {
+		return targets
+	}
+	t := reloadTarget{kind: TargetEndpoints, namespace: ns, name: name, port: port}
+	return append([]reloadTarget{t}, targets...)
+}
+
 func main() {
 	flag.Parse()
 	defer glog.Flush()
@@ -160,6 +284,11 @@ func main() {
 		glog.Fatalf("Error building prometheus clientset: %s", err.Error())
 	}
 
+	crdClient, err := apiextclientset.NewForConfig(cfg)
+	if err != nil {
+		glog.Fatalf("Error building apiextensions clientset: %s", err.Error())
+	}
+
 	promInformerFactory := informers.NewFilteredSharedInformerFactory(
 		promClient,
 		time.Second*30,
@@ -189,6 +318,75 @@ func main() {
 		}
 	}
 
+	var amTmpl *template.Template
+	if alertmanagerTemplate != "" {
+		glog.Infof("parsing alertmanager template %q", alertmanagerTemplate)
+		amTmpl, err = template.New(path.Base(alertmanagerTemplate)).Funcs(sprig.TxtFuncMap()).ParseFiles(alertmanagerTemplate)
+		if err != nil {
+			glog.Fatalf("error parsing alertmanager config template, %v", err)
+		}
+	}
+
+	var jobTmpl *template.Template
+	switch jobNamePolicy {
+	case JobNameGenerated, JobNameUser:
+	case JobNameTemplate:
+		jobTmpl, err = template.New("jobname").Option("missingkey=error").Funcs(sprig.TxtFuncMap()).Parse(jobNameTemplate)
+		if err != nil {
+			glog.Fatalf("error parsing job name template, %v", err)
+		}
+	default:
+		glog.Fatalf("unknown job name policy %q", jobNamePolicy)
+	}
+
+	mode, err := strconv.ParseUint(fileMode, 8, 32)
+	if err != nil {
+		glog.Fatalf("error parsing file mode, %v", err)
+	}
+
+	var sinks []RulesSink
+	if rulerURL != "" {
+		if rulerNamespacePrefix == "" {
+			glog.Fatalf("rules.ruler.namespace-prefix must be set with rules.ruler.url, rule groups of the tenant in namespaces with the prefix are deleted")
+		}
+		u, err := url.Parse(rulerURL)
+		if err != nil {
+			glog.Fatalf("error parsing ruler url, %v", err)
+		}
+		sinks = append(sinks, &rulerSink{
+			client:          &http.Client{Timeout: 30 * time.Second},
+			url:             u,
+			tenant:          rulerTenant,
+			namespacePrefix: rulerNamespacePrefix,
+		})
+	}
+
+	switch rulesShardBy {
+	case ShardRulesNone, ShardRulesByNamespace, ShardRulesBySize:
+	default:
+		glog.Fatalf("unknown rule sharding policy %q", rulesShardBy)
+	}
+	if rulesDir != "" && rulesShardBy != ShardRulesNone {
+		glog.Fatalf("rules.dir can not be used with rules.shard %s", rulesShardBy)
+	}
+
+	amHost, amPort, err := net.SplitHostPort(alertmanagerReloadHost)
+	if err != nil {
+		glog.Fatalf("error parsing alertmanager host:port pair, %v", err)
+	}
+
+	amReloader := &reloader{
+		method:  reloadMethod,
+		path:    alertmanagerReloadPath,
+		scheme:  reloadScheme,
+		host:    amHost,
+		port:    amPort,
+		retries: reloadRetries,
+
+		client:  kubeClient,
+		targets: legacyReloadTargets(alertmanagerEndpointsNS, alertmanagerEndpoints, amPort, alertmanagerTargets),
+	}
+
 	host, port, err := net.SplitHostPort(reloadHost)
 	if err != nil {
 		glog.Fatalf("error parsing host:port pair, %v", err)
@@ -200,12 +398,10 @@ func main() {
 		scheme:  reloadScheme,
 		host:    host,
 		port:    port,
-		delay:   reloadDelay,
 		retries: reloadRetries,
 
-		client:    kubeClient,
-		name:      reloadEndpoints,
-		namespace: reloadEndpointsNS,
+		client:  kubeClient,
+		targets: legacyReloadTargets(reloadEndpointsNS, reloadEndpoints, port, reloadTargets),
 	}
 
 	ccfg := ControllerConfig{
@@ -223,6 +419,75 @@ func main() {
 		ConfigSecret:     configSecName,
 		ConfigSecretKey:  configSecKey,
 		ConfigFile:       configFile,
+		JobNamePolicy:    jobNamePolicy,
+		JobNameTemplate:  jobTmpl,
+
+		AlertmanagerTemplate:  amTmpl,
+		AlertmanagerSecretNS:  alertmanagerSecNS,
+		AlertmanagerSecret:    alertmanagerSecName,
+		AlertmanagerSecretKey: alertmanagerSecKey,
+		AlertmanagerFile:      alertmanagerFile,
+
+		NamespaceIsolation: namespaceIsolation,
+		ScrapeFiles:        splitList(scrapeFiles),
+
+		RuleNamespaceIsolation:        rulesNamespaceIsolation,
+		RuleIsolationExemptNamespaces: splitList(rulesExemptNamespaces),
+		RuleIsolationExemptKey:        rulesExemptKey,
+		RuleLintDeny:                  rulesLintDeny,
+		RuleLintMaxLookback:           rulesLintMaxLookback,
+
+		LoadTimeout: reloadConfirmTimeout,
+		RenderDelay: renderDelay,
+
+		RuleShardBy:   rulesShardBy,
+		RuleShardSize: rulesShardSize,
+		RuleShardDir:  rulesShardDir,
+
+		RuleDir:    rulesDir,
+		RulesSinks: sinks,
+
+		Files: FileOptions{
+			Mode:     os.FileMode(mode),
+			Chown:    fileUID >= 0 || fileGID >= 0,
+			UID:      fileUID,
+			GID:      fileGID,
+			Sync:     fileSync,
+			Checksum: fileChecksum,
+		},
+	}
+	var amTarget targetReloader = amReloader
+	if alertmanagerSignal != "" {
+		amTarget = &signalReloader{procDir: reloadProcDir, name: alertmanagerSignal}
+	}
+	amCoordinator := newReloadCoordinator("alertmanager", amTarget, reloadDelay, reloadMaxDelay, reloadMinInterval)
+	ccfg.AlertmanagerReloader = amCoordinator
+	if alertmanagerSilences {
+		ccfg.Silencer = &amSilencer{
+			client:  &http.Client{Timeout: 10 * time.Second},
+			targets: amReloader.baseURLs,
+		}
+	}
+	if reloadConfirm {
+		ccfg.LoadChecker = &promLoadChecker{
+			client:  &http.Client{Timeout: 10 * time.Second},
+			targets: reloader.baseURLs,
+		}
+	}
+
+	if rulesMetricsCheck {
+		api := &promLoadChecker{
+			client:  &http.Client{Timeout: 10 * time.Second},
+			targets: reloader.baseURLs,
+		}
+		if rulesMetricsURL != "" {
+			u, err := url.Parse(rulesMetricsURL)
+			if err != nil {
+				glog.Fatalf("error parsing rules metrics url, %v", err)
+			}
+			api.targets = staticTargets(u)
+		}
+		ccfg.MetricChecker = newPromMetricChecker(api, rulesMetricsCache)
 	}
 
 	tokenFile := "/var/run/secrets/kubernetes.io/serviceaccount/token"
@@ -261,21 +526,32 @@ func main() {
 		cl = listGKEClusters(gkecm, gcpProject, gcpKeysDir, tokenFile)
 	}
 
+	var promTarget targetReloader = reloader
+	if reloadSignal != "" {
+		promTarget = &signalReloader{procDir: reloadProcDir, name: reloadSignal}
+	}
+	promCoordinator := newReloadCoordinator("prometheus", promTarget, reloadDelay, reloadMaxDelay, reloadMinInterval)
+
 	controller := NewController(
 		ccfg,
 		kubeClient,
 		promClient,
+		crdClient,
 		promInformerFactory,
-		reloader,
+		promCoordinator,
 		cl,
 	)
 
 	go promInformerFactory.Start(stopCh)
+	go promCoordinator.Run(stopCh)
+	go amCoordinator.Run(stopCh)
 
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
 	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) { fmt.Fprintf(w, "OK") })
-	mux.HandleFunc("/validate", serveValidate)
+	mux.HandleFunc("/validate", controller.serveValidate)
+	mux.HandleFunc("/convert", serveConvert)
+	mux.HandleFunc("/reload/status", serveReloadStatus(promCoordinator, amCoordinator))
 
 	// Best practice TLS setup: https://blog.gopheracademy.com/advent-2016/exposing-go-on-the-internet/
 	tlsConfig := &tls.Config{
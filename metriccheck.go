@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/promql"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configV1beta1 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+// Reasons used for the MetricsFound condition.
+const (
+	ReasonMetricsFound   = "MetricsFound"
+	ReasonMetricsMissing = "MetricsMissing"
+	ReasonMetricsUnknown = "MetricsUnknown"
+)
+
+// metricCheckTimeout bounds the time spent asking prometheus for metrics,
+// which is done while admitting rule groups.
+const metricCheckTimeout = 5 * time.Second
+
+// syntheticMetrics are series made by prometheus itself, that only exist
+// while alerts are pending or firing.
+var syntheticMetrics = map[string]bool{
+	"ALERTS":           true,
+	"ALERTS_FOR_STATE": true,
+}
+
+// A MetricChecker reports which metric names have no current series.
+type MetricChecker interface {
+	MissingMetrics(ctx context.Context, names []string) ([]string, error)
+}
+
+// promMetricChecker checks metric names against those prometheus has series
+// for, using the label values API. The names are cached for ttl, so that
+// rule groups can be checked as they are synced.
+type promMetricChecker struct {
+	api *promLoadChecker
+	ttl time.Duration
+	now func() time.Time
+
+	sync.Mutex
+	names   map[string]bool
+	fetched time.Time
+}
+
+func newPromMetricChecker(api *promLoadChecker, ttl time.Duration) *promMetricChecker {
+	return &promMetricChecker{
+		api: api,
+		ttl: ttl,
+		now: time.Now,
+	}
+}
+
+// MissingMetrics returns the names that prometheus has no series for, in
+// the order given.
+func (p *promMetricChecker) MissingMetrics(ctx context.Context, names []string) ([]string, error) {
+	known, err := p.metricNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, n := range names {
+		if !known[n] {
+			res = append(res, n)
+		}
+	}
+	return res, nil
+}
+
+func (p *promMetricChecker) metricNames(ctx context.Context) (map[string]bool, error) {
+	p.Lock()
+	defer p.Unlock()
+	if p.names != nil && p.now().Sub(p.fetched) < p.ttl {
+		return p.names, nil
+	}
+
+	targets := p.api.targets()
+	if len(targets) == 0 {
+		return nil, errors.New("no prometheus targets to check")
+	}
+	// Any target will do, as they are expected to scrape the same series.
+	var err error
+	for _, base := range targets {
+		var names []string
+		if err = p.api.getAPI(ctx, base, "/api/v1/label/__name__/values", &names); err != nil {
+			glog.V(2).Infof("listing metrics of %s failed, %v", base.Host, err)
+			continue
+		}
+		p.names = map[string]bool{}
+		for _, n := range names {
+			p.names[n] = true
+		}
+		p.fetched = p.now()
+		return p.names, nil
+	}
+	return nil, errors.Wrap(err, "listing metric names")
+}
+
+// staticTargets returns the targets of a prometheus at a fixed URL.
+func staticTargets(u *url.URL) func() []*url.URL {
+	return func() []*url.URL { return []*url.URL{u} }
+}
+
+// recordedSeries returns the series recorded by the rule groups as of the
+// last render. The result must not be modified.
+func (c *Controller) recordedSeries() map[string]bool {
+	c.rules.Lock()
+	defer c.rules.Unlock()
+	return c.rules.recorded
+}
+
+// checkRuleMetrics returns a message for each metric that a rule of rg
+// selects, but that prometheus has no series for. Metrics recorded by rg,
+// or in recorded, are left out, as they may not have been evaluated yet.
+func (c *Controller) checkRuleMetrics(ctx context.Context, rg *configV1beta1.RuleGroup, recorded map[string]bool) ([]string, error) {
+	rules := c.convertedRules(rg)
+	own := map[string]bool{}
+	for _, r := range rules {
+		own[r.Record] = true
+	}
+
+	indexes := sortedRuleIndexes(rules)
+	deps := map[int][]string{}
+	var names []string
+	seen := map[string]bool{}
+	for _, i := range indexes {
+		expr, err := promql.ParseExpr(rules[i].Expr)
+		if err != nil {
+			continue
+		}
+		ruleSeen := map[string]bool{}
+		for _, dep := range findDeps(expr) {
+			if dep == "" || own[dep] || recorded[dep] || syntheticMetrics[dep] || ruleSeen[dep] {
+				continue
+			}
+			ruleSeen[dep] = true
+			deps[i] = append(deps[i], dep)
+			if !seen[dep] {
+				seen[dep] = true
+				names = append(names, dep)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sort.Strings(names)
+
+	missing, err := c.MetricChecker.MissingMetrics(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	isMissing := map[string]bool{}
+	for _, m := range missing {
+		isMissing[m] = true
+	}
+	var res []string
+	for _, i := range indexes {
+		r := rules[i]
+		name := r.Record
+		if r.Alert != "" {
+			name = r.Alert
+		}
+		for _, dep := range deps[i] {
+			if isMissing[dep] {
+				res = append(res, fmt.Sprintf("rule %d (%s): metric %s has no series in prometheus", i, name, dep))
+			}
+		}
+	}
+	return res, nil
+}
+
+// setMetricsCondition sets the MetricsFound condition of rg, if a
+// MetricChecker is configured.
+func (c *Controller) setMetricsCondition(rg *configV1beta1.RuleGroup) {
+	if c.MetricChecker == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), metricCheckTimeout)
+	defer cancel()
+
+	cond := metav1.Condition{
+		Type:               configV1beta1.ConditionMetricsFound,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: rg.Generation,
+		LastTransitionTime: metav1.NewTime(c.now()),
+		Reason:             ReasonMetricsFound,
+	}
+	missing, err := c.checkRuleMetrics(ctx, rg, c.recordedSeries())
+	switch {
+	case err != nil:
+		glog.Infof("checking metrics of %s/%s failed, %v", rg.Namespace, rg.Name, err)
+		cond.Status = metav1.ConditionUnknown
+		cond.Reason = ReasonMetricsUnknown
+		cond.Message = err.Error()
+	case len(missing) > 0:
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = ReasonMetricsMissing
+		cond.Message = strings.Join(missing, "; ")
+	}
+	if len(cond.Message) > maxConditionMessage {
+		cond.Message = cond.Message[:maxConditionMessage]
+	}
+	meta.SetStatusCondition(&rg.Status.Conditions, cond)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	conf "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+func TestPromMetricChecker(t *testing.T) {
+	p := &stubProm{metrics: []string{"up", "http_requests_total"}}
+	c := newPromMetricChecker(newStubChecker(t, p), time.Minute)
+	now := testNow
+	c.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	missing, err := c.MissingMetrics(ctx, []string{"http_requests_total", "htp_requests_total", "up"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(missing, []string{"htp_requests_total"}) {
+		t.Errorf("expected htp_requests_total to be missing, got %v", missing)
+	}
+
+	// The names are listed again once the cache expires.
+	p.Lock()
+	p.metrics = append(p.metrics, "htp_requests_total")
+	p.Unlock()
+	if missing, _ = c.MissingMetrics(ctx, []string{"htp_requests_total"}); len(missing) != 1 {
+		t.Errorf("expected the cached names to be used, got %v", missing)
+	}
+	now = now.Add(2 * time.Minute)
+	if missing, _ = c.MissingMetrics(ctx, []string{"htp_requests_total"}); len(missing) != 0 {
+		t.Errorf("expected the names to be listed again, got %v", missing)
+	}
+	if p.requests != 2 {
+		t.Errorf("expected 2 requests to prometheus, got %d", p.requests)
+	}
+}
+
+func TestRuleMetrics(t *testing.T) {
+	rg := newRuleGroup("test", `
+rules:
+- alert: ErrorsHigh
+  expr: rate(htp_requests_total{code="500"}[5m]) > 1 and on (job) job:up:sum > 0
+  for: 5m
+  labels:
+    severity: page
+  annotations:
+    summary: errors are high
+- record: job:errors:rate5m
+  expr: sum(rate(htp_requests_total[5m])) by (job) / sum(up) by (job) + count(ALERTS)
+`)
+	rg.Kind = "RuleGroup"
+	recorder := newRuleGroup("recorder", `
+rules:
+- record: job:up:sum
+  expr: sum(up) by (job)
+`)
+
+	f := newFixture(t)
+	f.objects = append(f.objects, rg)
+	c, _, _ := f.newController()
+	// Series recorded by the rendered rules are not checked.
+	c.reconcileRuleGroup("default/recorder", recorder)
+	if _, err := c.renderRules(); err != nil {
+		t.Fatal(err)
+	}
+	p := &stubProm{metrics: []string{"up", "http_requests_total"}}
+	c.MetricChecker = newPromMetricChecker(newStubChecker(t, p), time.Minute)
+
+	// Missing metrics are warned about at admission.
+	raw, _ := json.Marshal(rg)
+	res := c.admit(v1.AdmissionReview{Request: &v1.AdmissionRequest{
+		Operation: v1.Create,
+		Resource:  metav1.GroupVersionResource(conf.SchemeGroupVersion.WithResource("rulegroups")),
+		Object:    runtime.RawExtension{Raw: raw},
+	}})
+	expected := []string{
+		"rule 0 (ErrorsHigh): metric htp_requests_total has no series in prometheus",
+		"rule 1 (job:errors:rate5m): metric htp_requests_total has no series in prometheus",
+	}
+	if !res.Allowed || !reflect.DeepEqual(res.Warnings, expected) {
+		t.Errorf("expected warnings %q, got %v, %q", expected, res.Result, res.Warnings)
+	}
+
+	// And reported in the MetricsFound condition.
+	c.reconcileRuleGroup("default/test", rg)
+	got, err := f.client.ConfigV1beta1().RuleGroups("default").Get(context.Background(), "test", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, conf.ConditionMetricsFound)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != ReasonMetricsMissing || !strings.Contains(cond.Message, "htp_requests_total") {
+		t.Fatalf("expected MetricsFound to be false, got %#v", cond)
+	}
+
+	// The condition is unknown if prometheus can not be asked.
+	c.MetricChecker = newPromMetricChecker(&promLoadChecker{targets: func() []*url.URL { return nil }}, time.Minute)
+	c.reconcileRuleGroup("default/test", got)
+	got, err = f.client.ConfigV1beta1().RuleGroups("default").Get(context.Background(), "test", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cond = meta.FindStatusCondition(got.Status.Conditions, conf.ConditionMetricsFound)
+	if cond == nil || cond.Status != metav1.ConditionUnknown || cond.Reason != ReasonMetricsUnknown {
+		t.Fatalf("expected MetricsFound to be unknown, got %#v", cond)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	staleScrapes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "prom_config_controller_scrape_stale",
+			Help: "Set to 1 for scrapes whose spec is invalid, and whose last valid config is being rendered instead.",
+		},
+		[]string{"namespace", "name"},
+	)
+	staleRuleGroups = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "prom_config_controller_rulegroup_stale",
+			Help: "Set to 1 for rule groups whose spec is invalid, and whose last valid rules are being rendered instead.",
+		},
+		[]string{"namespace", "name"},
+	)
+	fileDrift = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prom_config_controller_file_drift_total",
+			Help: "Count of rendered files found not to match their checksum file before being updated.",
+		},
+		[]string{"file"},
+	)
+	reloadSignals = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prom_config_controller_reload_signals_total",
+			Help: "Count of attempts to reload a process by signal, by process name and result, one of signalled, not_found or failed.",
+		},
+		[]string{"process", "result"},
+	)
+	reloadRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prom_config_controller_reload_requests_total",
+			Help: "Count of reloads requested by the workers, by reloader.",
+		},
+		[]string{"reloader"},
+	)
+	reloads = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prom_config_controller_reloads_total",
+			Help: "Count of reloads started, after coalescing the requested reloads, by reloader.",
+		},
+		[]string{"reloader"},
+	)
+	reloadTargetTimestamp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "prom_config_controller_reload_target_last_timestamp_seconds",
+			Help: "Time of the last completed reload of each target, by reloader and target.",
+		},
+		[]string{"reloader", "target"},
+	)
+	reloadTargetSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "prom_config_controller_reload_target_success",
+			Help: "Set to 1 if the last reload of each target succeeded, 0 if it failed, by reloader and target.",
+		},
+		[]string{"reloader", "target"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(staleScrapes, staleRuleGroups, fileDrift, reloadSignals,
+		reloadRequests, reloads, reloadTargetTimestamp, reloadTargetSuccess)
+}
@@ -32,6 +32,12 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&RuleGroupList{},
 		&Scrape{},
 		&ScrapeList{},
+		&AlertRoute{},
+		&AlertRouteList{},
+		&InhibitRule{},
+		&InhibitRuleList{},
+		&Silence{},
+		&SilenceList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
@@ -4,6 +4,25 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// Condition types reported on the status of rule groups and scrapes.
+const (
+	// ConditionValid is true when the spec has no errors.
+	ConditionValid = "Valid"
+	// ConditionRendered is true when the current spec is included in the
+	// rendered configuration.
+	ConditionRendered = "Rendered"
+	// ConditionLoaded is true when prometheus has loaded the rendered
+	// configuration.
+	ConditionLoaded = "Loaded"
+	// ConditionActive is true when a silence is in place in alertmanager.
+	ConditionActive = "Active"
+	// ConditionMetricsFound is true when prometheus has series for every
+	// metric that the rules of a rule group select.
+	ConditionMetricsFound = "MetricsFound"
+	// ConditionTestsPassed is true when every test of a rule group passes.
+	ConditionTestsPassed = "TestsPassed"
+)
+
 // Rule describes an alerting or recording rule.
 type Rule struct {
 	Record      string            `json:"record,omitempty"`
@@ -34,6 +53,59 @@ type RuleGroup struct {
 type RuleGroupSpec struct {
 	Interval string `json:"interval,omitempty"`
 	Rules    []Rule `json:"rules"`
+	// Tests are unit tests of the rules, in the form used by promtool test
+	// rules with camelCase field names. Rule groups whose tests fail are
+	// denied by the webhook.
+	Tests []RuleTest `json:"tests,omitempty"`
+}
+
+// RuleTest is a unit test of the rules of a rule group. The input series
+// are loaded, the rules are evaluated every interval from time 0, and the
+// alerts and expressions are checked at their eval times.
+type RuleTest struct {
+	// Name identifies the test in errors.
+	Name string `json:"name,omitempty"`
+	// Interval is the time between the samples of the input series, and
+	// between evaluations of the rules. Defaults to 1m.
+	Interval        string           `json:"interval,omitempty"`
+	InputSeries     []InputSeries    `json:"inputSeries,omitempty"`
+	AlertRuleTests  []AlertRuleTest  `json:"alertRuleTests,omitempty"`
+	PromQLExprTests []PromQLExprTest `json:"promqlExprTests,omitempty"`
+}
+
+// InputSeries is a series loaded for a test, with its values given in the
+// expanding notation of promtool, e.g. 1+1x10.
+type InputSeries struct {
+	Series string `json:"series"`
+	Values string `json:"values"`
+}
+
+// AlertRuleTest checks the alerts of a name firing at an eval time.
+type AlertRuleTest struct {
+	EvalTime  string     `json:"evalTime"`
+	Alertname string     `json:"alertname"`
+	ExpAlerts []ExpAlert `json:"expAlerts,omitempty"`
+}
+
+// ExpAlert is an alert expected to fire.
+type ExpAlert struct {
+	ExpLabels      map[string]string `json:"expLabels,omitempty"`
+	ExpAnnotations map[string]string `json:"expAnnotations,omitempty"`
+}
+
+// PromQLExprTest checks the result of an expression at an eval time.
+type PromQLExprTest struct {
+	Expr       string      `json:"expr"`
+	EvalTime   string      `json:"evalTime"`
+	ExpSamples []ExpSample `json:"expSamples,omitempty"`
+}
+
+// ExpSample is a sample expected in the result of an expression.
+type ExpSample struct {
+	// Labels is the series of the sample, e.g. up{job="api"}.
+	Labels string `json:"labels,omitempty"`
+	// Value is the value of the sample, e.g. 0.5 or NaN.
+	Value string `json:"value"`
 }
 
 // RuleGroupStatus is the status for a rule group resource
@@ -42,6 +114,27 @@ type RuleGroupStatus struct {
 	AlertRuleCount     int      `json:"alertRules"`
 	ErrorCount         int      `json:"errorCount"`
 	Errors             []string `json:"errors,omitempty"`
+	// RuleErrors lists the rules that were left out of the rendered group.
+	RuleErrors []RuleError `json:"ruleErrors,omitempty"`
+	// LastValidConfig is the rule group most recently rendered from a
+	// spec without errors. It is rendered in place of a spec with no valid
+	// rules.
+	LastValidConfig string `json:"lastValidConfig,omitempty"`
+	// ObservedGeneration is the generation of the spec that the status
+	// was computed from.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// RuleError describes why a rule could not be rendered.
+type RuleError struct {
+	// Index is the position of the rule in the spec.
+	Index int `json:"index"`
+	// Name is the record or alert name of the rule.
+	Name   string `json:"name,omitempty"`
+	Reason string `json:"reason"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -61,6 +154,7 @@ type ScrapeSpec string
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // +kubebuilder:subresource:status
+// +kubebuilder:storageversion
 // +kubebuilder:printcolumn:name="Errors",type=integer,JSONPath=`.status.errorCount`
 // Scrape
 type Scrape struct {
@@ -75,6 +169,15 @@ type Scrape struct {
 type ScrapeStatus struct {
 	ErrorCount int      `json:"errorCount"`
 	Errors     []string `json:"errors,omitempty"`
+	// LastValidConfig is the scrape config most recently rendered from a
+	// valid spec. It is rendered in place of an invalid spec.
+	LastValidConfig string `json:"lastValidConfig,omitempty"`
+	// ObservedGeneration is the generation of the spec that the status
+	// was computed from.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -86,3 +189,204 @@ type ScrapeList struct {
 
 	Items []Scrape `json:"items"`
 }
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Receiver",type=string,JSONPath=`.spec.route.receiver`
+// +kubebuilder:printcolumn:name="Errors",type=integer,JSONPath=`.status.errorCount`
+// AlertRoute
+type AlertRoute struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AlertRouteSpec   `json:"spec"`
+	Status AlertRouteStatus `json:"status,omitempty"`
+}
+
+// AlertRouteSpec is the spec for an alert route resource. The route only
+// matches alerts with a namespace label of the namespace of the resource,
+// and may only send to the receivers defined alongside it.
+type AlertRouteSpec struct {
+	Route     Route      `json:"route"`
+	Receivers []Receiver `json:"receivers"`
+}
+
+// Route describes an alertmanager route.
+type Route struct {
+	SubRoute `json:",inline"`
+	// Routes are child routes, tried in order.
+	Routes []SubRoute `json:"routes,omitempty"`
+}
+
+// SubRoute describes an alertmanager route with no children.
+type SubRoute struct {
+	Receiver       string            `json:"receiver"`
+	GroupBy        []string          `json:"groupBy,omitempty"`
+	Match          map[string]string `json:"match,omitempty"`
+	MatchRE        map[string]string `json:"matchRE,omitempty"`
+	Continue       bool              `json:"continue,omitempty"`
+	GroupWait      string            `json:"groupWait,omitempty"`
+	GroupInterval  string            `json:"groupInterval,omitempty"`
+	RepeatInterval string            `json:"repeatInterval,omitempty"`
+}
+
+// Receiver describes an alertmanager receiver.
+type Receiver struct {
+	Name string `json:"name"`
+	// Config is the receiver configuration in alertmanager YAML, e.g.
+	// slack_configs, without the name.
+	Config string `json:"config,omitempty"`
+}
+
+// AlertRouteStatus is the status for an alert route resource
+type AlertRouteStatus struct {
+	ErrorCount int      `json:"errorCount"`
+	Errors     []string `json:"errors,omitempty"`
+	// ObservedGeneration is the generation of the spec that the status
+	// was computed from.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AlertRouteList is a list of alert route resources
+type AlertRouteList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []AlertRoute `json:"items"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Errors",type=integer,JSONPath=`.status.errorCount`
+// InhibitRule
+type InhibitRule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   InhibitRuleSpec   `json:"spec"`
+	Status InhibitRuleStatus `json:"status,omitempty"`
+}
+
+// InhibitRuleSpec is the spec for an inhibit rule resource. Alerts matching
+// the source matchers mute alerts matching the target matchers. The target
+// only matches alerts with a namespace label of the namespace of the
+// resource, the source may match alerts from any namespace.
+type InhibitRuleSpec struct {
+	SourceMatch   map[string]string `json:"sourceMatch,omitempty"`
+	SourceMatchRE map[string]string `json:"sourceMatchRE,omitempty"`
+	TargetMatch   map[string]string `json:"targetMatch,omitempty"`
+	TargetMatchRE map[string]string `json:"targetMatchRE,omitempty"`
+	// Equal are the labels that must have the same value in the source and
+	// target alerts for the inhibition to take effect.
+	Equal []string `json:"equal,omitempty"`
+}
+
+// InhibitRuleStatus is the status for an inhibit rule resource
+type InhibitRuleStatus struct {
+	ErrorCount int      `json:"errorCount"`
+	Errors     []string `json:"errors,omitempty"`
+	// ObservedGeneration is the generation of the spec that the status
+	// was computed from.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// InhibitRuleList is a list of inhibit rule resources
+type InhibitRuleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []InhibitRule `json:"items"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Starts",type=string,JSONPath=`.status.startsAt`
+// +kubebuilder:printcolumn:name="Ends",type=string,JSONPath=`.status.endsAt`
+// +kubebuilder:printcolumn:name="Errors",type=integer,JSONPath=`.status.errorCount`
+// Silence
+type Silence struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SilenceSpec   `json:"spec"`
+	Status SilenceStatus `json:"status,omitempty"`
+}
+
+// SilenceSpec is the spec for a silence resource. The silence only matches
+// alerts with a namespace label of the namespace of the resource. It is in
+// place either between StartsAt and EndsAt, or during the windows of
+// Schedule.
+type SilenceSpec struct {
+	Matchers []SilenceMatcher `json:"matchers"`
+	Comment  string           `json:"comment,omitempty"`
+
+	StartsAt *metav1.Time `json:"startsAt,omitempty"`
+	EndsAt   *metav1.Time `json:"endsAt,omitempty"`
+
+	Schedule *SilenceSchedule `json:"schedule,omitempty"`
+}
+
+// SilenceMatcher matches an alert label.
+type SilenceMatcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex,omitempty"`
+	// IsNotEqual negates the matcher.
+	IsNotEqual bool `json:"isNotEqual,omitempty"`
+}
+
+// SilenceSchedule describes a silence that recurs on days of the week.
+type SilenceSchedule struct {
+	// Days are the days of the week that windows start on, e.g. Monday.
+	// Windows start every day if none are given.
+	Days []string `json:"days,omitempty"`
+	// Start and End are the times of day, as HH:MM, that windows start and
+	// end. A window with an End before its Start ends on the following day.
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// TimeZone is the IANA time zone of Start and End, UTC by default.
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// SilenceStatus is the status for a silence resource
+type SilenceStatus struct {
+	ErrorCount int      `json:"errorCount"`
+	Errors     []string `json:"errors,omitempty"`
+	// SilenceID is the ID of the alertmanager silence for the current, or
+	// next, window.
+	SilenceID string       `json:"silenceID,omitempty"`
+	StartsAt  *metav1.Time `json:"startsAt,omitempty"`
+	EndsAt    *metav1.Time `json:"endsAt,omitempty"`
+	// ObservedGeneration is the generation of the spec that the status
+	// was computed from.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// SilenceList is a list of silence resources
+type SilenceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []Silence `json:"items"`
+}
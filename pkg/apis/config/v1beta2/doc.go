@@ -0,0 +1,5 @@
+// +k8s:deepcopy-gen=package,register
+
+// Package v1beta2 is the v1beta2 version of the API.
+// +groupName=config.prometheus.io
+package v1beta2
@@ -0,0 +1,167 @@
+package v1beta2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The yaml tags on the spec types below match the field names of a
+// prometheus scrape_config, so that a spec can be rendered directly into
+// prometheus configuration.
+
+// ScrapeSpec is the spec for a scrape resource
+type ScrapeSpec struct {
+	// JobName is the job name to which the job label is set by default.
+	JobName string `json:"jobName,omitempty" yaml:"job_name,omitempty"`
+	// HonorLabels keeps labels from the scraped data when they clash with
+	// target labels.
+	HonorLabels bool `json:"honorLabels,omitempty" yaml:"honor_labels,omitempty"`
+	// Params is a set of query parameters with which targets are scraped.
+	Params map[string][]string `json:"params,omitempty" yaml:"params,omitempty"`
+	// +kubebuilder:validation:Pattern=`^([0-9]+(ms|s|m|h|d|w|y))+$`
+	ScrapeInterval string `json:"scrapeInterval,omitempty" yaml:"scrape_interval,omitempty"`
+	// +kubebuilder:validation:Pattern=`^([0-9]+(ms|s|m|h|d|w|y))+$`
+	ScrapeTimeout string `json:"scrapeTimeout,omitempty" yaml:"scrape_timeout,omitempty"`
+	MetricsPath   string `json:"metricsPath,omitempty" yaml:"metrics_path,omitempty"`
+	// +kubebuilder:validation:Enum=http;https
+	Scheme string `json:"scheme,omitempty" yaml:"scheme,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	SampleLimit int `json:"sampleLimit,omitempty" yaml:"sample_limit,omitempty"`
+
+	BasicAuth       *BasicAuth `json:"basicAuth,omitempty" yaml:"basic_auth,omitempty"`
+	BearerTokenFile string     `json:"bearerTokenFile,omitempty" yaml:"bearer_token_file,omitempty"`
+	TLSConfig       *TLSConfig `json:"tlsConfig,omitempty" yaml:"tls_config,omitempty"`
+
+	StaticConfigs       []StaticConfig       `json:"staticConfigs,omitempty" yaml:"static_configs,omitempty"`
+	FileSDConfigs       []FileSDConfig       `json:"fileSDConfigs,omitempty" yaml:"file_sd_configs,omitempty"`
+	DNSSDConfigs        []DNSSDConfig        `json:"dnsSDConfigs,omitempty" yaml:"dns_sd_configs,omitempty"`
+	KubernetesSDConfigs []KubernetesSDConfig `json:"kubernetesSDConfigs,omitempty" yaml:"kubernetes_sd_configs,omitempty"`
+	GCESDConfigs        []GCESDConfig        `json:"gceSDConfigs,omitempty" yaml:"gce_sd_configs,omitempty"`
+
+	RelabelConfigs       []RelabelConfig `json:"relabelConfigs,omitempty" yaml:"relabel_configs,omitempty"`
+	MetricRelabelConfigs []RelabelConfig `json:"metricRelabelConfigs,omitempty" yaml:"metric_relabel_configs,omitempty"`
+
+	// Raw is a prometheus scrape_config YAML document, as accepted by the
+	// v1beta1 API. It can be used for settings that have no structured
+	// equivalent; structured fields take precedence over it.
+	Raw string `json:"raw,omitempty" yaml:"-"`
+}
+
+// BasicAuth configures HTTP basic authentication.
+type BasicAuth struct {
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+}
+
+// TLSConfig configures the TLS settings used when scraping.
+type TLSConfig struct {
+	CAFile             string `json:"caFile,omitempty" yaml:"ca_file,omitempty"`
+	CertFile           string `json:"certFile,omitempty" yaml:"cert_file,omitempty"`
+	KeyFile            string `json:"keyFile,omitempty" yaml:"key_file,omitempty"`
+	ServerName         string `json:"serverName,omitempty" yaml:"server_name,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty" yaml:"insecure_skip_verify,omitempty"`
+}
+
+// StaticConfig is a statically configured group of targets.
+type StaticConfig struct {
+	Targets []string          `json:"targets" yaml:"targets"`
+	Labels  map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// FileSDConfig configures file based service discovery.
+type FileSDConfig struct {
+	Files []string `json:"files" yaml:"files"`
+	// +kubebuilder:validation:Pattern=`^([0-9]+(ms|s|m|h|d|w|y))+$`
+	RefreshInterval string `json:"refreshInterval,omitempty" yaml:"refresh_interval,omitempty"`
+}
+
+// DNSSDConfig configures DNS based service discovery.
+type DNSSDConfig struct {
+	Names []string `json:"names" yaml:"names"`
+	// +kubebuilder:validation:Pattern=`^([0-9]+(ms|s|m|h|d|w|y))+$`
+	RefreshInterval string `json:"refreshInterval,omitempty" yaml:"refresh_interval,omitempty"`
+	// +kubebuilder:validation:Enum=SRV;A;AAAA
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+	Port int    `json:"port,omitempty" yaml:"port,omitempty"`
+}
+
+// KubernetesSDConfig configures kubernetes service discovery.
+type KubernetesSDConfig struct {
+	APIServer string `json:"apiServer,omitempty" yaml:"api_server,omitempty"`
+	// +kubebuilder:validation:Enum=node;pod;service;endpoints;ingress
+	Role            string     `json:"role" yaml:"role"`
+	BasicAuth       *BasicAuth `json:"basicAuth,omitempty" yaml:"basic_auth,omitempty"`
+	BearerTokenFile string     `json:"bearerTokenFile,omitempty" yaml:"bearer_token_file,omitempty"`
+	TLSConfig       *TLSConfig `json:"tlsConfig,omitempty" yaml:"tls_config,omitempty"`
+	// Namespaces restricts discovery to the given namespaces.
+	Namespaces *KubernetesNamespaces `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
+}
+
+// KubernetesNamespaces lists the namespaces used for kubernetes service
+// discovery.
+type KubernetesNamespaces struct {
+	Names []string `json:"names,omitempty" yaml:"names,omitempty"`
+}
+
+// GCESDConfig configures GCE based service discovery.
+type GCESDConfig struct {
+	Project string `json:"project" yaml:"project"`
+	Zone    string `json:"zone" yaml:"zone"`
+	Filter  string `json:"filter,omitempty" yaml:"filter,omitempty"`
+	// +kubebuilder:validation:Pattern=`^([0-9]+(ms|s|m|h|d|w|y))+$`
+	RefreshInterval string `json:"refreshInterval,omitempty" yaml:"refresh_interval,omitempty"`
+	Port            int    `json:"port,omitempty" yaml:"port,omitempty"`
+	TagSeparator    string `json:"tagSeparator,omitempty" yaml:"tag_separator,omitempty"`
+}
+
+// RelabelConfig describes a relabelling step applied to targets or metrics.
+type RelabelConfig struct {
+	SourceLabels []string `json:"sourceLabels,omitempty" yaml:"source_labels,flow,omitempty"`
+	Separator    string   `json:"separator,omitempty" yaml:"separator,omitempty"`
+	Regex        string   `json:"regex,omitempty" yaml:"regex,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	Modulus     int64  `json:"modulus,omitempty" yaml:"modulus,omitempty"`
+	TargetLabel string `json:"targetLabel,omitempty" yaml:"target_label,omitempty"`
+	Replacement string `json:"replacement,omitempty" yaml:"replacement,omitempty"`
+	// +kubebuilder:validation:Enum=replace;keep;drop;hashmod;labelmap;labeldrop;labelkeep
+	Action string `json:"action,omitempty" yaml:"action,omitempty"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Errors",type=integer,JSONPath=`.status.errorCount`
+// Scrape
+type Scrape struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ScrapeSpec   `json:"spec"`
+	Status ScrapeStatus `json:"status,omitempty"`
+}
+
+// ScrapeStatus is the status for a scrape resource
+type ScrapeStatus struct {
+	ErrorCount int      `json:"errorCount"`
+	Errors     []string `json:"errors,omitempty"`
+	// LastValidConfig is the scrape config most recently rendered from a
+	// valid spec. It is rendered in place of an invalid spec.
+	LastValidConfig string `json:"lastValidConfig,omitempty"`
+	// ObservedGeneration is the generation of the spec that the status
+	// was computed from.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions are of the types defined in the v1beta1 API.
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ScrapeList is a list of scrape resources
+type ScrapeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []Scrape `json:"items"`
+}
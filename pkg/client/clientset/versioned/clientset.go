@@ -23,6 +23,7 @@ import (
 	"net/http"
 
 	configv1beta1 "github.com/QubitProducts/prom-config-controller/pkg/client/clientset/versioned/typed/config/v1beta1"
+	configv1beta2 "github.com/QubitProducts/prom-config-controller/pkg/client/clientset/versioned/typed/config/v1beta2"
 	discovery "k8s.io/client-go/discovery"
 	rest "k8s.io/client-go/rest"
 	flowcontrol "k8s.io/client-go/util/flowcontrol"
@@ -31,6 +32,7 @@ import (
 type Interface interface {
 	Discovery() discovery.DiscoveryInterface
 	ConfigV1beta1() configv1beta1.ConfigV1beta1Interface
+	ConfigV1beta2() configv1beta2.ConfigV1beta2Interface
 }
 
 // Clientset contains the clients for groups. Each group has exactly one
@@ -38,6 +40,7 @@ type Interface interface {
 type Clientset struct {
 	*discovery.DiscoveryClient
 	configV1beta1 *configv1beta1.ConfigV1beta1Client
+	configV1beta2 *configv1beta2.ConfigV1beta2Client
 }
 
 // ConfigV1beta1 retrieves the ConfigV1beta1Client
@@ -45,6 +48,11 @@ func (c *Clientset) ConfigV1beta1() configv1beta1.ConfigV1beta1Interface {
 	return c.configV1beta1
 }
 
+// ConfigV1beta2 retrieves the ConfigV1beta2Client
+func (c *Clientset) ConfigV1beta2() configv1beta2.ConfigV1beta2Interface {
+	return c.configV1beta2
+}
+
 // Discovery retrieves the DiscoveryClient
 func (c *Clientset) Discovery() discovery.DiscoveryInterface {
 	if c == nil {
@@ -89,6 +97,10 @@ func NewForConfigAndClient(c *rest.Config, httpClient *http.Client) (*Clientset,
 	if err != nil {
 		return nil, err
 	}
+	cs.configV1beta2, err = configv1beta2.NewForConfigAndClient(&configShallowCopy, httpClient)
+	if err != nil {
+		return nil, err
+	}
 
 	cs.DiscoveryClient, err = discovery.NewDiscoveryClientForConfigAndClient(&configShallowCopy, httpClient)
 	if err != nil {
@@ -111,6 +123,7 @@ func NewForConfigOrDie(c *rest.Config) *Clientset {
 func New(c rest.Interface) *Clientset {
 	var cs Clientset
 	cs.configV1beta1 = configv1beta1.New(c)
+	cs.configV1beta2 = configv1beta2.New(c)
 
 	cs.DiscoveryClient = discovery.NewDiscoveryClient(c)
 	return &cs
@@ -22,6 +22,8 @@ import (
 	clientset "github.com/QubitProducts/prom-config-controller/pkg/client/clientset/versioned"
 	configv1beta1 "github.com/QubitProducts/prom-config-controller/pkg/client/clientset/versioned/typed/config/v1beta1"
 	fakeconfigv1beta1 "github.com/QubitProducts/prom-config-controller/pkg/client/clientset/versioned/typed/config/v1beta1/fake"
+	configv1beta2 "github.com/QubitProducts/prom-config-controller/pkg/client/clientset/versioned/typed/config/v1beta2"
+	fakeconfigv1beta2 "github.com/QubitProducts/prom-config-controller/pkg/client/clientset/versioned/typed/config/v1beta2/fake"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/discovery"
@@ -83,3 +85,8 @@ var (
 func (c *Clientset) ConfigV1beta1() configv1beta1.ConfigV1beta1Interface {
 	return &fakeconfigv1beta1.FakeConfigV1beta1{Fake: &c.Fake}
 }
+
+// ConfigV1beta2 retrieves the ConfigV1beta2Client
+func (c *Clientset) ConfigV1beta2() configv1beta2.ConfigV1beta2Interface {
+	return &fakeconfigv1beta2.FakeConfigV1beta2{Fake: &c.Fake}
+}
@@ -28,8 +28,11 @@ import (
 
 type ConfigV1beta1Interface interface {
 	RESTClient() rest.Interface
+	AlertRoutesGetter
+	InhibitRulesGetter
 	RuleGroupsGetter
 	ScrapesGetter
+	SilencesGetter
 }
 
 // ConfigV1beta1Client is used to interact with features provided by the config.prometheus.io group.
@@ -37,6 +40,14 @@ type ConfigV1beta1Client struct {
 	restClient rest.Interface
 }
 
+func (c *ConfigV1beta1Client) AlertRoutes(namespace string) AlertRouteInterface {
+	return newAlertRoutes(c, namespace)
+}
+
+func (c *ConfigV1beta1Client) InhibitRules(namespace string) InhibitRuleInterface {
+	return newInhibitRules(c, namespace)
+}
+
 func (c *ConfigV1beta1Client) RuleGroups(namespace string) RuleGroupInterface {
 	return newRuleGroups(c, namespace)
 }
@@ -45,6 +56,10 @@ func (c *ConfigV1beta1Client) Scrapes(namespace string) ScrapeInterface {
 	return newScrapes(c, namespace)
 }
 
+func (c *ConfigV1beta1Client) Silences(namespace string) SilenceInterface {
+	return newSilences(c, namespace)
+}
+
 // NewForConfig creates a new ConfigV1beta1Client for the given config.
 // NewForConfig is equivalent to NewForConfigAndClient(c, httpClient),
 // where httpClient was generated with rest.HTTPClientFor(c).
@@ -28,6 +28,14 @@ type FakeConfigV1beta1 struct {
 	*testing.Fake
 }
 
+func (c *FakeConfigV1beta1) AlertRoutes(namespace string) v1beta1.AlertRouteInterface {
+	return &FakeAlertRoutes{c, namespace}
+}
+
+func (c *FakeConfigV1beta1) InhibitRules(namespace string) v1beta1.InhibitRuleInterface {
+	return &FakeInhibitRules{c, namespace}
+}
+
 func (c *FakeConfigV1beta1) RuleGroups(namespace string) v1beta1.RuleGroupInterface {
 	return &FakeRuleGroups{c, namespace}
 }
@@ -36,6 +44,10 @@ func (c *FakeConfigV1beta1) Scrapes(namespace string) v1beta1.ScrapeInterface {
 	return &FakeScrapes{c, namespace}
 }
 
+func (c *FakeConfigV1beta1) Silences(namespace string) v1beta1.SilenceInterface {
+	return &FakeSilences{c, namespace}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeConfigV1beta1) RESTClient() rest.Interface {
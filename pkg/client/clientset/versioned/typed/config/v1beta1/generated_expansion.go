@@ -18,6 +18,12 @@ limitations under the License.
 
 package v1beta1
 
+type AlertRouteExpansion interface{}
+
+type InhibitRuleExpansion interface{}
+
 type RuleGroupExpansion interface{}
 
 type ScrapeExpansion interface{}
+
+type SilenceExpansion interface{}
@@ -24,10 +24,16 @@ import (
 
 // Interface provides access to all the informers in this group version.
 type Interface interface {
+	// AlertRoutes returns a AlertRouteInformer.
+	AlertRoutes() AlertRouteInformer
+	// InhibitRules returns a InhibitRuleInformer.
+	InhibitRules() InhibitRuleInformer
 	// RuleGroups returns a RuleGroupInformer.
 	RuleGroups() RuleGroupInformer
 	// Scrapes returns a ScrapeInformer.
 	Scrapes() ScrapeInformer
+	// Silences returns a SilenceInformer.
+	Silences() SilenceInformer
 }
 
 type version struct {
@@ -41,6 +47,16 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 	return &version{factory: f, namespace: namespace, tweakListOptions: tweakListOptions}
 }
 
+// AlertRoutes returns a AlertRouteInformer.
+func (v *version) AlertRoutes() AlertRouteInformer {
+	return &alertRouteInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
+// InhibitRules returns a InhibitRuleInformer.
+func (v *version) InhibitRules() InhibitRuleInformer {
+	return &inhibitRuleInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
 // RuleGroups returns a RuleGroupInformer.
 func (v *version) RuleGroups() RuleGroupInformer {
 	return &ruleGroupInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
@@ -50,3 +66,8 @@ func (v *version) RuleGroups() RuleGroupInformer {
 func (v *version) Scrapes() ScrapeInformer {
 	return &scrapeInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
+
+// Silences returns a SilenceInformer.
+func (v *version) Silences() SilenceInformer {
+	return &silenceInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
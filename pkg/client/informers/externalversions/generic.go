@@ -22,6 +22,7 @@ import (
 	"fmt"
 
 	v1beta1 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+	v1beta2 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta2"
 	schema "k8s.io/apimachinery/pkg/runtime/schema"
 	cache "k8s.io/client-go/tools/cache"
 )
@@ -53,10 +54,20 @@ func (f *genericInformer) Lister() cache.GenericLister {
 func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource) (GenericInformer, error) {
 	switch resource {
 	// Group=config.prometheus.io, Version=v1beta1
+	case v1beta1.SchemeGroupVersion.WithResource("alertroutes"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Config().V1beta1().AlertRoutes().Informer()}, nil
+	case v1beta1.SchemeGroupVersion.WithResource("inhibitrules"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Config().V1beta1().InhibitRules().Informer()}, nil
 	case v1beta1.SchemeGroupVersion.WithResource("rulegroups"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Config().V1beta1().RuleGroups().Informer()}, nil
 	case v1beta1.SchemeGroupVersion.WithResource("scrapes"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Config().V1beta1().Scrapes().Informer()}, nil
+	case v1beta1.SchemeGroupVersion.WithResource("silences"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Config().V1beta1().Silences().Informer()}, nil
+
+		// Group=config.prometheus.io, Version=v1beta2
+	case v1beta2.SchemeGroupVersion.WithResource("scrapes"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Config().V1beta2().Scrapes().Informer()}, nil
 
 	}
 
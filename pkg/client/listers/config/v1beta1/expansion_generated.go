@@ -18,6 +18,22 @@ limitations under the License.
 
 package v1beta1
 
+// AlertRouteListerExpansion allows custom methods to be added to
+// AlertRouteLister.
+type AlertRouteListerExpansion interface{}
+
+// AlertRouteNamespaceListerExpansion allows custom methods to be added to
+// AlertRouteNamespaceLister.
+type AlertRouteNamespaceListerExpansion interface{}
+
+// InhibitRuleListerExpansion allows custom methods to be added to
+// InhibitRuleLister.
+type InhibitRuleListerExpansion interface{}
+
+// InhibitRuleNamespaceListerExpansion allows custom methods to be added to
+// InhibitRuleNamespaceLister.
+type InhibitRuleNamespaceListerExpansion interface{}
+
 // RuleGroupListerExpansion allows custom methods to be added to
 // RuleGroupLister.
 type RuleGroupListerExpansion interface{}
@@ -33,3 +49,11 @@ type ScrapeListerExpansion interface{}
 // ScrapeNamespaceListerExpansion allows custom methods to be added to
 // ScrapeNamespaceLister.
 type ScrapeNamespaceListerExpansion interface{}
+
+// SilenceListerExpansion allows custom methods to be added to
+// SilenceLister.
+type SilenceListerExpansion interface{}
+
+// SilenceNamespaceListerExpansion allows custom methods to be added to
+// SilenceNamespaceLister.
+type SilenceNamespaceListerExpansion interface{}
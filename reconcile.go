@@ -0,0 +1,317 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	promconfig "github.com/QubitProducts/prom-config-controller/internal/prom2"
+	"github.com/golang/glog"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	yaml "gopkg.in/yaml.v2"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+
+	configV1beta1 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+// Keys of the render workqueue.
+const (
+	renderRulesKey   = "rules"
+	renderScrapesKey = "scrapes"
+)
+
+// ruleModel holds the converted form of each rule group between syncs, so
+// that a change to one rule group only requires that group to be converted.
+type ruleModel struct {
+	sync.Mutex
+	// groups are the rule groups to render, by key.
+	groups map[string]*rulefmt.RuleGroup
+	// pieces are the hashes of the rendered group of every rule group, by
+	// key.
+	pieces map[string]string
+	// recorded are the series recorded by the rule groups as of the last
+	// render. It is replaced, not modified, on each render.
+	recorded map[string]bool
+}
+
+func newRuleModel() *ruleModel {
+	return &ruleModel{
+		groups: map[string]*rulefmt.RuleGroup{},
+		pieces: map[string]string{},
+	}
+}
+
+// sorted returns the keys and rule groups of the model in key order.
+func (m *ruleModel) sorted() ([]string, []rulefmt.RuleGroup) {
+	m.Lock()
+	defer m.Unlock()
+	var keys []string
+	var groups []rulefmt.RuleGroup
+	for _, k := range sortedKeys(m.pieces) {
+		if g, ok := m.groups[k]; ok {
+			keys = append(keys, k)
+			groups = append(groups, *g)
+		}
+	}
+	return keys, groups
+}
+
+func (m *ruleModel) keys() []string {
+	m.Lock()
+	defer m.Unlock()
+	var keys []string
+	for k := range m.pieces {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// scrapeEntry is the converted form of a scrape. Whether it is rendered
+// depends on the other scrapes, so this is decided when rendering.
+type scrapeEntry struct {
+	obj  *configV1beta1.Scrape
+	ps   *promconfig.ScrapeConfig
+	errs []error
+
+	// dirty is set when the scrape has changed since it was last rendered.
+	dirty bool
+	// outcome describes how the scrape was last rendered, its status is
+	// only updated when this changes.
+	outcome string
+}
+
+// scrapeModel holds the converted form of each scrape between syncs.
+type scrapeModel struct {
+	sync.Mutex
+	entries map[string]*scrapeEntry
+}
+
+func newScrapeModel() *scrapeModel {
+	return &scrapeModel{entries: map[string]*scrapeEntry{}}
+}
+
+func (m *scrapeModel) keys() []string {
+	m.Lock()
+	defer m.Unlock()
+	var keys []string
+	for k := range m.entries {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// sorted returns the keys and entries of the model, oldest scrape first. The
+// model must be locked.
+func (m *scrapeModel) sorted() ([]string, []*scrapeEntry) {
+	ss := make([]*configV1beta1.Scrape, 0, len(m.entries))
+	byObj := map[*configV1beta1.Scrape]string{}
+	for k, e := range m.entries {
+		ss = append(ss, e.obj)
+		byObj[e.obj] = k
+	}
+	sortScrapesByAge(ss)
+
+	keys := make([]string, 0, len(ss))
+	entries := make([]*scrapeEntry, 0, len(ss))
+	for _, s := range ss {
+		keys = append(keys, byObj[s])
+		entries = append(entries, m.entries[byObj[s]])
+	}
+	return keys, entries
+}
+
+// selects reports whether obj is one of the objects managed by this
+// controller.
+func (c *Controller) selects(obj metav1.Object) bool {
+	if c.Namespace != metav1.NamespaceAll && obj.GetNamespace() != c.Namespace {
+		return false
+	}
+	return c.Selector == nil || c.Selector.Matches(labels.Set(obj.GetLabels()))
+}
+
+// queueRender schedules a render. Renders queued within RenderDelay of each
+// other are coalesced into one.
+func (c *Controller) queueRender(key string) {
+	c.renderWorkqueue.AddAfter(key, c.RenderDelay)
+}
+
+// syncRuleGroup reconciles the rule group with the given key, and schedules
+// the rules to be rendered.
+func (c *Controller) syncRuleGroup(key string) error {
+	ns, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+
+	r, err := c.rulesLister.RuleGroups(ns).Get(name)
+	switch {
+	case kerrors.IsNotFound(err):
+		c.forgetRuleGroup(key)
+	case err != nil:
+		return err
+	case !c.selects(r):
+		c.forgetRuleGroup(key)
+	default:
+		c.reconcileRuleGroup(key, r)
+	}
+
+	c.queueRender(renderRulesKey)
+	return nil
+}
+
+// reconcileRuleGroup converts r, updates its status, and stores the result
+// in the rules model.
+func (c *Controller) reconcileRuleGroup(key string, r *configV1beta1.RuleGroup) {
+	res, rerrs := convertRuleGroup(r.GetName(), r, c.ruleChecks(r)...)
+
+	stale := false
+	if res == nil && r.Status.LastValidConfig != "" {
+		last := rulefmt.RuleGroup{}
+		if err := yaml.Unmarshal([]byte(r.Status.LastValidConfig), &last); err != nil {
+			glog.Infof("could not parse last valid config of %v, %v", key, err)
+		} else {
+			glog.Infof("rendering last valid config of %v", key)
+			res = &last
+			stale = true
+		}
+	}
+	state := notRendered
+	switch {
+	case stale:
+		staleRuleGroups.WithLabelValues(r.Namespace, r.Name).Set(1)
+		state = renderedStale
+	case res != nil:
+		state = renderedCurrent
+	}
+	if !stale {
+		staleRuleGroups.DeleteLabelValues(r.Namespace, r.Name)
+	}
+
+	piece := pieceHash(res)
+	if err := c.updatergstatus(r, res, state, c.rulesLoads.status(key, piece), rerrs); err != nil {
+		glog.Infof("updating status of %s failed, %v", key, err)
+	}
+	c.recordSyncEvent(r, state, rerrs)
+	for _, err := range rerrs {
+		glog.Infof("rule error in %v: %v", key, err)
+	}
+
+	c.rules.Lock()
+	defer c.rules.Unlock()
+	c.rules.pieces[key] = piece
+	if res == nil {
+		delete(c.rules.groups, key)
+		return
+	}
+	c.rules.groups[key] = res
+}
+
+// forgetRuleGroup removes a deleted rule group from the rules model.
+func (c *Controller) forgetRuleGroup(key string) {
+	if ns, name, err := cache.SplitMetaNamespaceKey(key); err == nil {
+		staleRuleGroups.DeleteLabelValues(ns, name)
+	}
+	c.events.forget(eventKind(&configV1beta1.RuleGroup{}) + "/" + key)
+
+	c.rules.Lock()
+	defer c.rules.Unlock()
+	delete(c.rules.groups, key)
+	delete(c.rules.pieces, key)
+}
+
+// syncScrape reconciles the scrape with the given key, and schedules the
+// scrape config to be rendered.
+func (c *Controller) syncScrape(key string) error {
+	ns, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+
+	s, err := c.scrapesLister.Scrapes(ns).Get(name)
+	switch {
+	case kerrors.IsNotFound(err):
+		c.forgetScrape(key)
+	case err != nil:
+		return err
+	case !c.selects(s):
+		c.forgetScrape(key)
+	default:
+		c.reconcileScrape(key, s)
+	}
+
+	c.queueRender(renderScrapesKey)
+	return nil
+}
+
+// reconcileScrape converts s and stores the result in the scrape model. Its
+// status is updated when the scrape config is rendered.
+func (c *Controller) reconcileScrape(key string, s *configV1beta1.Scrape) {
+	ps, errs := c.convertScrapeConfig(s)
+
+	c.scrapes.Lock()
+	defer c.scrapes.Unlock()
+	e, ok := c.scrapes.entries[key]
+	if !ok {
+		e = &scrapeEntry{}
+		c.scrapes.entries[key] = e
+	}
+	e.obj = s
+	e.ps = ps
+	e.errs = errs
+	e.dirty = true
+}
+
+// forgetScrape removes a deleted scrape from the scrape model.
+func (c *Controller) forgetScrape(key string) {
+	if ns, name, err := cache.SplitMetaNamespaceKey(key); err == nil {
+		staleScrapes.DeleteLabelValues(ns, name)
+	}
+	c.events.forget(eventKind(&configV1beta1.Scrape{}) + "/" + key)
+
+	c.scrapes.Lock()
+	defer c.scrapes.Unlock()
+	delete(c.scrapes.entries, key)
+}
+
+// render renders the rules, the scrape config or the alertmanager config,
+// and reloads prometheus or alertmanager if they have changed, or updates
+// the rules sinks.
+func (c *Controller) render(key string) error {
+	var changed bool
+	var err error
+	reloader := c.Reloader
+	switch key {
+	case renderRulesKey:
+		changed, err = c.renderRules()
+	case renderScrapesKey:
+		changed, err = c.renderScrapes()
+	case renderAlertmanagerKey:
+		changed, err = c.renderAlertmanager()
+		reloader = c.AlertmanagerReloader
+	case renderSinksKey:
+		return c.updateRulesSinks()
+	default:
+		glog.Infof("unknown render key %q", key)
+		return nil
+	}
+
+	// Outputs written before an error are reloaded, a retry would find them
+	// unchanged.
+	if changed && reloader != nil {
+		glog.Infof("the %s configuration has changed, issuing reload", key)
+		reloader.Reload()
+	}
+	return err
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
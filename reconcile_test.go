@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core "k8s.io/client-go/testing"
+
+	conf "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+// statusUpdates returns the names of the objects whose status was updated.
+func statusUpdates(actions []core.Action) []string {
+	var names []string
+	for _, a := range filterInformerActions(actions) {
+		if a.GetVerb() != "update" || a.GetSubresource() != "status" {
+			continue
+		}
+		obj := a.(core.UpdateAction).GetObject().(metav1.Object)
+		names = append(names, obj.GetName())
+	}
+	return names
+}
+
+func TestSyncRuleGroupKeyScoped(t *testing.T) {
+	f := newFixture(t)
+	a := newRuleGroup("a", testGroup)
+	b := newRuleGroup("b", testGroup)
+	f.ruleGroupLister = append(f.ruleGroupLister, a, b)
+	f.objects = append(f.objects, a, b)
+
+	c, i, _ := f.newController()
+	if _, err := c.syncRuleHandler(); err != nil {
+		t.Fatalf("sync failed, %v", err)
+	}
+
+	// Feed the status updates back into the cache, as the informer would.
+	ctx := context.Background()
+	indexer := i.Config().V1beta1().RuleGroups().Informer().GetIndexer()
+	for _, name := range []string{"a", "b"} {
+		rg, err := f.client.ConfigV1beta1().RuleGroups("default").Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("getting rule group failed, %v", err)
+		}
+		indexer.Update(rg)
+	}
+	f.client.ClearActions()
+
+	// Syncs of a changed and an unchanged group are rendered together.
+	obj, _, _ := indexer.GetByKey("default/a")
+	na := obj.(*conf.RuleGroup).DeepCopy()
+	na.Spec.Rules = na.Spec.Rules[:1]
+	indexer.Update(na)
+	for _, key := range []string{"default/a", "default/b"} {
+		if err := c.syncRuleGroup(key); err != nil {
+			t.Fatalf("sync failed, %v", err)
+		}
+	}
+
+	if got := statusUpdates(f.client.Actions()); len(got) != 1 || got[0] != "a" {
+		t.Errorf("expected only the status of a to be updated, got %v", got)
+	}
+	if l := c.renderWorkqueue.Len(); l != 1 {
+		t.Fatalf("expected one queued render, got %d", l)
+	}
+
+	key, _ := c.renderWorkqueue.Get()
+	if err := c.render(key.(string)); err != nil {
+		t.Fatalf("render failed, %v", err)
+	}
+	c.renderWorkqueue.Done(key)
+
+	cm, err := f.kubeclient.CoreV1().ConfigMaps("default").Get(ctx, "prom-config-controller", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting configmap failed, %v", err)
+	}
+	exp := `groups:
+- name: default/a
+  rules:
+  - record: something
+    expr: 1 + 1
+- name: default/b
+  rules:
+  - record: something
+    expr: 1 + 1
+  - record: something2
+    expr: 1 + 1
+`
+	if got := cm.Data["prom-config-controller.yaml"]; got != exp {
+		t.Errorf("expected rules:\n%s\ngot:\n%s", exp, got)
+	}
+
+	// Deleted rule groups are dropped from the model.
+	indexer.Delete(b)
+	if err := c.syncRuleGroup("default/b"); err != nil {
+		t.Fatalf("sync failed, %v", err)
+	}
+	if _, err := c.renderRules(); err != nil {
+		t.Fatalf("render failed, %v", err)
+	}
+	cm, err = f.kubeclient.CoreV1().ConfigMaps("default").Get(ctx, "prom-config-controller", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting configmap failed, %v", err)
+	}
+	exp = `groups:
+- name: default/a
+  rules:
+  - record: something
+    expr: 1 + 1
+`
+	if got := cm.Data["prom-config-controller.yaml"]; got != exp {
+		t.Errorf("expected rules:\n%s\ngot:\n%s", exp, got)
+	}
+}
+
+func TestSyncScrapeConflictReleased(t *testing.T) {
+	f := newFixture(t)
+	owner := newScrape("owner", testScrape)
+	owner.CreationTimestamp.Time = testNow
+	clash := newScrape("clash", testScrape)
+	clash.CreationTimestamp.Time = testNow.Add(time.Minute)
+	other := newScrape("other", "job_name: other\nstatic_configs:\n- targets: [localhost:9090]\n")
+	f.scrapeLister = append(f.scrapeLister, owner, clash, other)
+	f.objects = append(f.objects, owner, clash, other)
+
+	c, i, _ := f.newController()
+	c.JobNamePolicy = JobNameUser
+	if _, err := c.syncConfigHandler(); err != nil {
+		t.Fatalf("sync failed, %v", err)
+	}
+
+	ctx := context.Background()
+	s, err := f.client.ConfigV1beta1().Scrapes("default").Get(ctx, "clash", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting scrape failed, %v", err)
+	}
+	if s.Status.ErrorCount != 1 {
+		t.Fatalf("expected clash to conflict with owner, got %#v", s.Status)
+	}
+	f.client.ClearActions()
+
+	// Deleting owner releases its job name, and only clash is updated.
+	i.Config().V1beta1().Scrapes().Informer().GetIndexer().Delete(owner)
+	if err := c.syncScrape("default/owner"); err != nil {
+		t.Fatalf("sync failed, %v", err)
+	}
+	if _, err := c.renderScrapes(); err != nil {
+		t.Fatalf("render failed, %v", err)
+	}
+
+	if got := statusUpdates(f.client.Actions()); len(got) != 1 || got[0] != "clash" {
+		t.Errorf("expected only the status of clash to be updated, got %v", got)
+	}
+	s, err = f.client.ConfigV1beta1().Scrapes("default").Get(ctx, "clash", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting scrape failed, %v", err)
+	}
+	if s.Status.ErrorCount != 0 {
+		t.Errorf("expected clash to be rendered, got %#v", s.Status)
+	}
+}
+
+func TestSelects(t *testing.T) {
+	f := newFixture(t)
+	c, _, _ := f.newController()
+
+	rg := &conf.RuleGroup{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "test"}}
+	if c.selects(rg) {
+		t.Errorf("expected objects outside the watched namespace to be ignored")
+	}
+	rg.Namespace = "default"
+	if !c.selects(rg) {
+		t.Errorf("expected objects in the watched namespace to be selected")
+	}
+}
@@ -2,16 +2,17 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/cloudflare/backoff"
 	"github.com/golang/glog"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -20,6 +21,13 @@ type Reloader interface {
 	Reload()
 }
 
+// A targetReloader reloads a set of servers, calling report with the result
+// of reloading each one. Reloads abandoned because ctx was cancelled are not
+// reported.
+type targetReloader interface {
+	reload(ctx context.Context, report func(target string, err error))
+}
+
 type reloader struct {
 	scheme  string
 	method  string
@@ -27,97 +35,134 @@ type reloader struct {
 	host    string
 	port    string
 	retries int
-	delay   time.Duration
 
-	client    kubernetes.Interface
-	name      string
-	namespace string
+	client kubernetes.Interface
+	// targets are the sets of servers, discovered from the kubernetes API,
+	// that are reloaded in addition to the host.
+	targets []reloadTarget
 }
 
 func (r *reloader) Reload() {
-	glog.Infof("reloading prometheus")
+	r.reload(context.Background(), func(string, error) {})
+}
 
-	time.Sleep(r.delay)
+// reload reloads the host and every server of the targets concurrently,
+// and waits for them all to complete.
+func (r *reloader) reload(ctx context.Context, report func(target string, err error)) {
+	glog.Infof("reloading prometheus")
 
-	var actioned bool
+	var hosts []string
 	if r.host != "" {
-		r.reloadURL()
-		actioned = true
+		hosts = append(hosts, net.JoinHostPort(r.host, r.port))
 	}
-
-	if r.name != "" && r.namespace != "" {
-		r.reloadEndpoints()
-		actioned = true
+	if len(r.targets) > 0 {
+		glog.V(2).Info("performing target reload")
+		hosts = append(hosts, r.discoverTargets()...)
 	}
 
-	if !actioned {
+	if len(hosts) == 0 {
 		glog.V(2).Info("no reload options are active")
+		return
 	}
-}
 
-func (r *reloader) reloadURL() {
-	glog.V(2).Info("performing single reload")
-	u := &url.URL{
-		Scheme: r.scheme,
-		Host:   net.JoinHostPort(r.host, r.port),
-		Path:   r.path,
-	}
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		u := &url.URL{
+			Scheme: r.scheme,
+			Host:   host,
+			Path:   r.path,
+		}
 
-	go reloadOneURL(r.method, u, r.retries)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := reloadOneURL(ctx, r.method, u, r.retries)
+			if ctx.Err() == nil {
+				report(u.Host, err)
+			}
+		}()
+	}
+	wg.Wait()
 }
 
-func (r *reloader) reloadEndpoints() {
+// discoverTargets returns the host:port of every server of the targets.
+// Targets that can not be discovered are logged and skipped, so that the
+// others are still reloaded.
+func (r *reloader) discoverTargets() []string {
 	ctx := context.Background()
-	glog.V(2).Info("performing endpoint reload")
-	eps, err := r.client.CoreV1().Endpoints(r.namespace).Get(ctx, r.name, metav1.GetOptions{})
-	if err != nil {
-		glog.V(1).Infof("failed listing reload endpoints, %v", err)
-		return
-	}
-	if len(eps.Subsets) == 0 {
-		glog.V(2).Infof("no endpoints returned for %s/%s", r.namespace, r.name)
-		return
-	}
-	for _, ep := range eps.Subsets {
-		for _, addr := range ep.Addresses {
-			u := &url.URL{
-				Scheme: r.scheme,
-				Host:   net.JoinHostPort(addr.IP, r.port),
-				Path:   r.path,
-			}
-
-			go reloadOneURL(r.method, u, r.retries)
+	var hosts []string
+	for _, t := range r.targets {
+		ths, err := t.discover(ctx, r.client)
+		if err != nil {
+			glog.V(1).Infof("failed discovering reload target %s, %v", t, err)
+			continue
+		}
+		if len(ths) == 0 {
+			glog.V(2).Infof("no servers found for reload target %s", t)
 		}
+		hosts = append(hosts, ths...)
 	}
+	return hosts
 }
 
-func reloadOneURL(method string, u *url.URL, retries int) {
+// reloadOneURL requests a reload from u, retrying with backoff until it
+// succeeds, the retries are used up, or ctx is cancelled.
+func reloadOneURL(ctx context.Context, method string, u *url.URL, retries int) error {
 	glog.V(1).Infof("starting reload of %s using a %s", u.String(), method)
 	b := backoff.New(0, 0)
 	defer b.Reset()
+	var err error
 	for retries >= 0 {
-		req, err := http.NewRequest(method, u.String(), nil)
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, method, u.String(), nil)
 		if err != nil {
 			glog.V(1).Infof("reload failed, %v", err)
-			return
+			return err
 		}
 
-		res, err := http.DefaultClient.Do(req)
+		var res *http.Response
+		res, err = http.DefaultClient.Do(req)
 		if err == nil {
 			io.Copy(ioutil.Discard, res.Body)
 			res.Body.Close()
 
 			if res.StatusCode < 500 {
 				glog.V(2).Infof("reloaded %s", u)
-				return
+				return nil
 			}
 			glog.V(1).Infof("reload %s response, %v", u, res.StatusCode)
+			err = fmt.Errorf("reload response %v", res.StatusCode)
 		}
 
 		glog.V(1).Infof("reload failed, %v", err)
 
 		retries--
-		<-time.After(b.Duration())
+		select {
+		case <-ctx.Done():
+			glog.V(1).Infof("abandoning reload of %s, %v", u, ctx.Err())
+			return ctx.Err()
+		case <-time.After(b.Duration()):
+		}
 	}
 	glog.V(1).Infof("giving up reload of %s", u)
+	return err
+}
+
+// baseURLs returns the base URLs of the servers that are reloaded.
+func (r *reloader) baseURLs() []*url.URL {
+	var us []*url.URL
+	if r.host != "" {
+		us = append(us, &url.URL{
+			Scheme: r.scheme,
+			Host:   net.JoinHostPort(r.host, r.port),
+		})
+	}
+
+	for _, host := range r.discoverTargets() {
+		us = append(us, &url.URL{
+			Scheme: r.scheme,
+			Host:   host,
+		})
+	}
+	return us
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	yaml "gopkg.in/yaml.v2"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ruleDirGlob returns the rule_files entry that matches every rule group
+// file, or an empty string if rule groups are not written to a directory.
+func (c *Controller) ruleDirGlob() string {
+	if c.RuleDir == "" {
+		return ""
+	}
+	return filepath.Join(c.RuleDir, "*", "*.yaml")
+}
+
+// ruleGroupFile returns the path of the file the rule group with the given
+// key is written to.
+func (c *Controller) ruleGroupFile(key string) (string, error) {
+	ns, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(c.RuleDir, ns, name+".yaml"), nil
+}
+
+// updateRuleDir writes each rule group, given in key order, to its own file
+// in RuleDir, and removes the files of rule groups that are no longer
+// rendered.
+func (c *Controller) updateRuleDir(keys []string, groups []rulefmt.RuleGroup) (bool, error) {
+	if c.RuleDir == "" {
+		return false, nil
+	}
+
+	changed := false
+	used := map[string]bool{}
+	for i, g := range groups {
+		fn, err := c.ruleGroupFile(keys[i])
+		if err != nil {
+			return changed, err
+		}
+		used[fn] = true
+
+		bs, err := yaml.Marshal(&rulefmt.RuleGroups{Groups: []rulefmt.RuleGroup{g}})
+		if err != nil {
+			return changed, errors.Wrapf(err, "rendering rule group %s", keys[i])
+		}
+
+		if err = os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			return changed, errors.Wrap(err, "creating rule group directory")
+		}
+		updated, err := updateFile(fn, bs, c.Files)
+		if err != nil {
+			return changed, errors.Wrap(err, "writing rule group file")
+		}
+		changed = changed || updated
+	}
+
+	fns, err := filepath.Glob(c.ruleDirGlob())
+	if err != nil {
+		return changed, err
+	}
+	for _, fn := range fns {
+		if used[fn] {
+			continue
+		}
+		glog.Infof("removing stale rule group file %s", fn)
+		if err := removeFile(fn); err != nil {
+			return changed, errors.Wrap(err, "removing rule group file")
+		}
+		changed = true
+
+		// Namespace directories are removed once they are empty.
+		dir := filepath.Dir(fn)
+		if rest, _ := ioutil.ReadDir(dir); len(rest) == 0 {
+			os.Remove(dir)
+		}
+	}
+
+	return changed, nil
+}
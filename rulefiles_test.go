@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestUpdateRuleDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Files other than rule group files are left alone.
+	other := filepath.Join(dir, "README")
+	if err := ioutil.WriteFile(other, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Controller{ControllerConfig: ControllerConfig{RuleDir: dir}}
+	keys, groups := testShardGroups()
+	changed, err := c.updateRuleDir(keys, groups)
+	if err != nil {
+		t.Fatalf("updating rule dir failed, %v", err)
+	}
+	if !changed {
+		t.Errorf("expected rule dir to change")
+	}
+
+	files := func() []string {
+		fns, _ := filepath.Glob(c.ruleDirGlob())
+		var rel []string
+		for _, fn := range fns {
+			r, _ := filepath.Rel(dir, fn)
+			rel = append(rel, r)
+		}
+		return rel
+	}
+	if exp := []string{"a/one.yaml", "a/two.yaml", "b/one.yaml"}; !reflect.DeepEqual(files(), exp) {
+		t.Errorf("expected files %v, got %v", exp, files())
+	}
+
+	bs, err := ioutil.ReadFile(filepath.Join(dir, "b", "one.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := `groups:
+- name: b/one
+  rules:
+  - record: something
+    expr: 1 + 1
+`
+	if string(bs) != exp {
+		t.Errorf("expected file:\n%s\ngot:\n%s", exp, bs)
+	}
+
+	if changed, err = c.updateRuleDir(keys, groups); err != nil || changed {
+		t.Errorf("expected no change on second update, got %v, %v", changed, err)
+	}
+
+	// Deleted rule groups have their files, and empty directories, removed.
+	changed, err = c.updateRuleDir(keys[:1], groups[:1])
+	if err != nil || !changed {
+		t.Fatalf("expected change on removal, got %v, %v", changed, err)
+	}
+	if exp := []string{"a/one.yaml"}; !reflect.DeepEqual(files(), exp) {
+		t.Errorf("expected files %v, got %v", exp, files())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b")); !os.IsNotExist(err) {
+		t.Errorf("expected empty namespace directory to be removed, got %v", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("expected other files to be kept, got %v", err)
+	}
+}
+
+func TestRenderRulesToDirOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The single rules file and ConfigMaps are left over from before rule
+	// groups were written to a directory.
+	ruleFile := filepath.Join(dir, "rules.yaml")
+	if err := ioutil.WriteFile(ruleFile, []byte(testConfigMap), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := newFixture(t)
+	shard := newConfigMap("default", "prom-config-controller-0", "prom-config-controller-0.yaml", testConfigMap)
+	shard.Labels = map[string]string{ruleShardLabel: "prom-config-controller"}
+	unsharded := newConfigMap("default", "prom-config-controller", "prom-config-controller.yaml", testConfigMap)
+	unrelated := newConfigMap("default", "unrelated", "unrelated.yaml", "")
+	f.kubeobjects = append(f.kubeobjects, shard, unsharded, unrelated)
+
+	c, _, _ := f.newController()
+	c.RuleDir = filepath.Join(dir, "groups")
+	c.RuleFile = ruleFile
+	c.reconcileRuleGroup("default/test", newRuleGroup("test", testGroup))
+
+	changed, err := c.renderRules()
+	if err != nil {
+		t.Fatalf("rendering rules failed, %v", err)
+	}
+	if !changed {
+		t.Errorf("expected rules to change")
+	}
+
+	bs, err := ioutil.ReadFile(filepath.Join(c.RuleDir, "default", "test.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bs) != testConfigMap {
+		t.Errorf("expected rule group file:\n%s\ngot:\n%s", testConfigMap, bs)
+	}
+	if _, err := os.Stat(ruleFile); !os.IsNotExist(err) {
+		t.Errorf("expected single rules file to be removed, got %v", err)
+	}
+
+	cms, err := f.kubeclient.CoreV1().ConfigMaps("default").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("listing configmaps failed, %v", err)
+	}
+	var names []string
+	for _, cm := range cms.Items {
+		names = append(names, cm.Name)
+	}
+	if exp := []string{"unrelated"}; !reflect.DeepEqual(names, exp) {
+		t.Errorf("expected configmaps %v, got %v", exp, names)
+	}
+
+	if changed, err = c.renderRules(); err != nil || changed {
+		t.Errorf("expected no change on second render, got %v, %v", changed, err)
+	}
+}
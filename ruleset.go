@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/prometheus/prometheus/promql"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+
+	configV1beta1 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+// selectsRuleGroup reports whether rg is one of the rule groups the
+// controller renders.
+func (c *Controller) selectsRuleGroup(rg *configV1beta1.RuleGroup) bool {
+	if c.Namespace != "" && rg.Namespace != c.Namespace {
+		return false
+	}
+	return c.Selector == nil || c.Selector.Matches(labels.Set(rg.Labels))
+}
+
+// convertedRules converts each rule of rg on its own, so that the converted
+// rules, with the changes made by the rule checks, are known by their index
+// in the spec. Invalid rules are left out.
+func (c *Controller) convertedRules(rg *configV1beta1.RuleGroup) map[int]rulefmt.Rule {
+	res := map[int]rulefmt.Rule{}
+	checks := c.ruleChecks(rg)
+	for i, r := range rg.Spec.Rules {
+		// Conversion does not modify the group, so only the rules need
+		// replacing.
+		one := *rg
+		one.Spec.Rules = []configV1beta1.Rule{r}
+		if g, _ := convertRuleGroup(one.Name, &one, checks...); g != nil && len(g.Rules) == 1 {
+			res[i] = g.Rules[0]
+		}
+	}
+	return res
+}
+
+// ruleSetGroup is a rule group rendered alongside the group being checked.
+type ruleSetGroup struct {
+	key   string
+	rules map[int]rulefmt.Rule
+}
+
+// ruleRef is a converted rule of another rule group.
+type ruleRef struct {
+	key   string
+	index int
+	rule  rulefmt.Rule
+}
+
+// otherRuleGroups returns the converted rules of the rendered rule groups,
+// other than the one with the given key, from the informer cache, sorted by
+// key.
+func (c *Controller) otherRuleGroups(key string) ([]ruleSetGroup, error) {
+	if c.rulesLister == nil {
+		return nil, nil
+	}
+	sel := c.Selector
+	if sel == nil {
+		sel = labels.Everything()
+	}
+	rgs, err := c.rulesLister.RuleGroups(c.Namespace).List(sel)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []ruleSetGroup
+	for _, rg := range rgs {
+		k := rg.Namespace + "/" + rg.Name
+		if k == key {
+			continue
+		}
+		res = append(res, ruleSetGroup{key: k, rules: c.convertedRules(rg)})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].key < res[j].key })
+	return res, nil
+}
+
+// checkRuleSet checks a rule group against the other rule groups rendered
+// with it, from the informer cache. rg is nil if the group is being
+// deleted. Recording rules that would produce the same series as a rule of
+// another group are returned as errors. Alerts that share a name with an
+// alert of another group but have conflicting labels, and series recorded
+// by the current version of the group that other groups depend on but that
+// rg no longer records, are returned as warnings.
+func (c *Controller) checkRuleSet(key string, rg *configV1beta1.RuleGroup) ([]error, []string, error) {
+	others, err := c.otherRuleGroups(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var errs []error
+	var warnings []string
+
+	rules := map[int]rulefmt.Rule{}
+	if rg != nil {
+		rules = c.convertedRules(rg)
+	}
+	// The rules of the other groups are indexed by the series or alert
+	// they produce, in key and index order.
+	records := map[string][]ruleRef{}
+	alerts := map[string][]ruleRef{}
+	for _, o := range others {
+		for _, j := range sortedRuleIndexes(o.rules) {
+			or := o.rules[j]
+			ref := ruleRef{key: o.key, index: j, rule: or}
+			if or.Record != "" {
+				records[or.Record] = append(records[or.Record], ref)
+			}
+			if or.Alert != "" {
+				alerts[or.Alert] = append(alerts[or.Alert], ref)
+			}
+		}
+	}
+
+	for _, i := range sortedRuleIndexes(rules) {
+		r := rules[i]
+		if r.Record != "" {
+			for _, o := range records[r.Record] {
+				if reflect.DeepEqual(labelsOrNil(r.Labels), labelsOrNil(o.rule.Labels)) {
+					errs = append(errs, &ruleError{Index: i, Name: r.Record, Err: fmt.Errorf("records the same series as rule %d of %s", o.index, o.key)})
+				}
+			}
+		}
+		if r.Alert != "" {
+			for _, o := range alerts[r.Alert] {
+				for _, l := range sortedKeys(r.Labels) {
+					if ov, ok := o.rule.Labels[l]; ok && ov != r.Labels[l] {
+						warnings = append(warnings, fmt.Sprintf("rule %d (%s): label %s=%q conflicts with %s=%q on the alert of the same name in rule %d of %s", i, r.Alert, l, r.Labels[l], l, ov, o.index, o.key))
+					}
+				}
+			}
+		}
+	}
+
+	// Series that are no longer recorded by this group, and by no other
+	// group, break the rules that depend on them.
+	if c.rulesLister == nil {
+		return errs, warnings, nil
+	}
+	ns, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	current, err := c.rulesLister.RuleGroups(ns).Get(name)
+	if err != nil {
+		return errs, warnings, nil
+	}
+	recorded := map[string]bool{}
+	for _, r := range rules {
+		recorded[r.Record] = true
+	}
+	removed := map[string]bool{}
+	for _, r := range c.convertedRules(current) {
+		if r.Record != "" && !recorded[r.Record] && len(records[r.Record]) == 0 {
+			removed[r.Record] = true
+		}
+	}
+	if len(removed) == 0 {
+		return errs, warnings, nil
+	}
+	for _, o := range others {
+		for _, j := range sortedRuleIndexes(o.rules) {
+			or := o.rules[j]
+			expr, err := promql.ParseExpr(or.Expr)
+			if err != nil {
+				continue
+			}
+			seen := map[string]bool{}
+			for _, dep := range findDeps(expr) {
+				if removed[dep] && !seen[dep] {
+					seen[dep] = true
+					warnings = append(warnings, fmt.Sprintf("rule %d of %s depends on %s, which would no longer be recorded", j, o.key, dep))
+				}
+			}
+		}
+	}
+	return errs, warnings, nil
+}
+
+func sortedRuleIndexes(rules map[int]rulefmt.Rule) []int {
+	res := make([]int, 0, len(rules))
+	for i := range rules {
+		res = append(res, i)
+	}
+	sort.Ints(res)
+	return res
+}
+
+// labelsOrNil treats empty label sets as nil, so that they compare equal.
+func labelsOrNil(ls map[string]string) map[string]string {
+	if len(ls) == 0 {
+		return nil
+	}
+	return ls
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	conf "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+func TestAdmitRuleGroupRuleSet(t *testing.T) {
+	f := newFixture(t)
+	c, i, _ := f.newController()
+	c.Namespace = metav1.NamespaceAll
+	indexer := i.Config().V1beta1().RuleGroups().Informer().GetIndexer()
+
+	recorder := newRuleGroup("recorder", `
+rules:
+- record: job:up:sum
+  expr: sum(up) by (job)
+`)
+	user := newRuleGroup("user", `
+rules:
+- alert: JobDown
+  expr: job:up:sum == 0
+  labels:
+    severity: page
+`)
+	user.Namespace = "team"
+	indexer.Add(recorder)
+	indexer.Add(user)
+
+	review := func(op v1.Operation, rg *conf.RuleGroup) *v1.AdmissionResponse {
+		rg = rg.DeepCopy()
+		rg.Kind = "RuleGroup"
+		raw, _ := json.Marshal(rg)
+		req := &v1.AdmissionRequest{
+			Operation: op,
+			Resource:  metav1.GroupVersionResource(conf.SchemeGroupVersion.WithResource("rulegroups")),
+			Namespace: rg.Namespace,
+		}
+		if op == v1.Delete {
+			req.OldObject = runtime.RawExtension{Raw: raw}
+		} else {
+			req.Object = runtime.RawExtension{Raw: raw}
+		}
+		return c.admit(v1.AdmissionReview{Request: req})
+	}
+
+	// Recording the same series as another group is denied.
+	dup := newRuleGroup("dup", `
+rules:
+- record: job:up:sum
+  expr: sum(up) by (job)
+`)
+	dup.Namespace = "other"
+	res := review(v1.Create, dup)
+	if res.Allowed {
+		t.Fatalf("expected a duplicate recording rule to be denied")
+	}
+	if len(res.Result.Details.Causes) != 1 || !strings.Contains(res.Result.Message, "rule 0 of default/recorder") {
+		t.Errorf("unexpected denial %v", res.Result)
+	}
+
+	// Distinct labels make distinct series.
+	dup.Spec.Rules[0].Labels = map[string]string{"source": "other"}
+	if res = review(v1.Create, dup); !res.Allowed {
+		t.Errorf("expected a recording rule with other labels to be allowed, got %v", res.Result)
+	}
+
+	// Alerts of the same name with conflicting labels are warned about.
+	alert := newRuleGroup("alert", `
+rules:
+- alert: JobDown
+  expr: up == 0
+  for: 5m
+  labels:
+    severity: ticket
+  annotations:
+    summary: Job is down
+`)
+	res = review(v1.Create, alert)
+	if !res.Allowed || len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], `severity="page"`) {
+		t.Errorf("expected a warning for conflicting alert labels, got %v, %v", res.Result, res.Warnings)
+	}
+
+	// Renaming a recorded series that others depend on is warned about.
+	renamed := recorder.DeepCopy()
+	renamed.Spec.Rules[0].Record = "job:up:total"
+	res = review(v1.Update, renamed)
+	if !res.Allowed || len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], "rule 0 of team/user depends on job:up:sum") {
+		t.Errorf("expected a warning for the broken dependency, got %v, %v", res.Result, res.Warnings)
+	}
+
+	// As is deleting it.
+	res = review(v1.Delete, recorder)
+	if !res.Allowed || len(res.Warnings) != 1 {
+		t.Errorf("expected a warning for the broken dependency, got %v, %v", res.Result, res.Warnings)
+	}
+
+	// Updates that keep the recorded series are fine.
+	if res = review(v1.Update, recorder); !res.Allowed || len(res.Warnings) != 0 {
+		t.Errorf("expected an unchanged group to be allowed, got %v, %v", res.Result, res.Warnings)
+	}
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/template"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configV1beta1 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+// Reasons used for the TestsPassed condition.
+const (
+	ReasonTestsPassed = "TestsPassed"
+	ReasonTestsFailed = "TestsFailed"
+)
+
+// defaultTestInterval is the interval of tests that do not set one, as for
+// promtool.
+const defaultTestInterval = time.Minute
+
+// Limits on the tests of a rule group, which are run while admitting it.
+// Tests that need more evaluations or input samples than this are rejected
+// before they are run, and ruleTestTimeout bounds the time spent on all of
+// the tests of a group.
+const (
+	maxTestSteps    = 10000
+	maxTestSamples  = 100000
+	ruleTestTimeout = 10 * time.Second
+)
+
+// expandingValue matches the values of input series that expand to more
+// than one sample, e.g. 0+10x100.
+var expandingValue = regexp.MustCompile(`x([0-9]+)$`)
+
+// ruleTestT stands in for the testing.T that promql.Test reports storage
+// failures to, turning them into panics that runRuleTest recovers.
+type ruleTestT struct{}
+
+type ruleTestFatal string
+
+func (ruleTestT) Fatal(args ...interface{}) {
+	panic(ruleTestFatal(fmt.Sprint(args...)))
+}
+
+func (ruleTestT) Fatalf(format string, args ...interface{}) {
+	panic(ruleTestFatal(fmt.Sprintf(format, args...)))
+}
+
+// testAlert is an alert of a rule test, active since activeAt.
+type testAlert struct {
+	labels      labels.Labels
+	annotations map[string]string
+	activeAt    time.Time
+}
+
+// runRuleTests runs the tests of rg against its rules as written in the
+// spec, returning an error for each test that fails. Rule groups with
+// invalid rules are not tested, and tests are not started once ctx is done.
+func runRuleTests(ctx context.Context, rg *configV1beta1.RuleGroup) []error {
+	if len(rg.Spec.Tests) == 0 {
+		return nil
+	}
+	g, errs := convertRuleGroup(rg.Name, rg)
+	if len(errs) > 0 || g == nil {
+		return []error{errors.New("the tests were not run, as the rules have errors")}
+	}
+
+	var res []error
+	for i, t := range rg.Spec.Tests {
+		name := t.Name
+		if name == "" {
+			name = fmt.Sprintf("%d", i)
+		}
+		if err := ctx.Err(); err != nil {
+			return append(res, errors.Wrapf(err, "test %s was not run", name))
+		}
+		for _, err := range runRuleTest(ctx, g.Rules, t) {
+			res = append(res, errors.Wrapf(err, "test %s", name))
+		}
+	}
+	return res
+}
+
+// inputSamples returns an upper bound on the number of samples that the
+// values of an input series expand to.
+func inputSamples(values string) int {
+	n := 0
+	for _, v := range strings.Fields(values) {
+		m := expandingValue.FindStringSubmatch(v)
+		if m == nil {
+			n++
+			continue
+		}
+		count, err := strconv.Atoi(m[1])
+		if err != nil || count >= maxTestSamples {
+			return maxTestSamples + 1
+		}
+		n += count + 1
+	}
+	return n
+}
+
+// runRuleTest loads the input series of t, evaluates the rules every
+// interval up to the last eval time, and checks the alerts and expressions
+// of t. Evaluation stops with an error once ctx is done.
+func runRuleTest(ctx context.Context, rules []rulefmt.Rule, t configV1beta1.RuleTest) (errs []error) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg, ok := r.(ruleTestFatal)
+			if !ok {
+				panic(r)
+			}
+			errs = []error{errors.New(string(msg))}
+		}
+	}()
+
+	interval := defaultTestInterval
+	if t.Interval != "" {
+		d, err := model.ParseDuration(t.Interval)
+		if err != nil {
+			return []error{errors.Wrap(err, "invalid interval")}
+		}
+		interval = time.Duration(d)
+	}
+	if interval <= 0 {
+		return []error{errors.New("interval must be greater than 0")}
+	}
+
+	samples := 0
+	for _, s := range t.InputSeries {
+		samples += inputSamples(s.Values)
+		if samples > maxTestSamples {
+			return []error{fmt.Errorf("input series have more than %d samples", maxTestSamples)}
+		}
+	}
+
+	evalTime := func(s string) (time.Time, error) {
+		d, err := model.ParseDuration(s)
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "invalid eval time %q", s)
+		}
+		return time.Unix(0, 0).Add(time.Duration(d)).UTC(), nil
+	}
+	var err error
+	last := time.Unix(0, 0).UTC()
+	alertTimes := make([]time.Time, len(t.AlertRuleTests))
+	for i, at := range t.AlertRuleTests {
+		if alertTimes[i], err = evalTime(at.EvalTime); err != nil {
+			return []error{err}
+		}
+		if alertTimes[i].After(last) {
+			last = alertTimes[i]
+		}
+	}
+	exprTimes := make([]time.Time, len(t.PromQLExprTests))
+	for i, et := range t.PromQLExprTests {
+		if exprTimes[i], err = evalTime(et.EvalTime); err != nil {
+			return []error{err}
+		}
+		if exprTimes[i].After(last) {
+			last = exprTimes[i]
+		}
+	}
+	if steps := last.Sub(time.Unix(0, 0)) / interval; steps >= maxTestSteps {
+		return []error{fmt.Errorf("evaluating up to %s every %s takes more than %d steps", model.Duration(last.Sub(time.Unix(0, 0))), model.Duration(interval), maxTestSteps)}
+	}
+
+	load := fmt.Sprintf("load %s\n", model.Duration(interval))
+	for _, s := range t.InputSeries {
+		load += fmt.Sprintf("  %s %s\n", s.Series, s.Values)
+	}
+	pt, err := promql.NewTest(ruleTestT{}, load)
+	if err != nil {
+		return []error{errors.Wrap(err, "invalid input series")}
+	}
+	defer pt.Close()
+	if err := pt.Run(); err != nil {
+		return []error{errors.Wrap(err, "loading input series")}
+	}
+
+	query := func(ctx context.Context, qs string, ts time.Time) (promql.Vector, error) {
+		q, err := pt.QueryEngine().NewInstantQuery(pt.Storage(), qs, ts)
+		if err != nil {
+			return nil, err
+		}
+		defer q.Close()
+		res := q.Exec(ctx)
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		switch v := res.Value.(type) {
+		case promql.Vector:
+			return v, nil
+		case promql.Scalar:
+			return promql.Vector{promql.Sample{Point: promql.Point{T: v.T, V: v.V}}}, nil
+		default:
+			return nil, fmt.Errorf("expression returned a %s, not a vector or scalar", res.Value.Type())
+		}
+	}
+
+	// The rules are evaluated as prometheus would, with the output of
+	// recording rules stored for the rules and expressions that use it, and
+	// the firing alerts of each alert test taken from the last evaluation
+	// at or before its eval time.
+	active := map[string]map[uint64]*testAlert{}
+	firing := make([][]*testAlert, len(t.AlertRuleTests))
+	for ts := time.Unix(0, 0).UTC(); !ts.After(last); ts = ts.Add(interval) {
+		if err := ctx.Err(); err != nil {
+			return append(errs, errors.Wrapf(err, "evaluating at %s", model.Duration(ts.Sub(time.Unix(0, 0)))))
+		}
+		for _, r := range rules {
+			vec, err := query(ctx, r.Expr, ts)
+			if err != nil {
+				errs = append(errs, errors.Wrapf(err, "evaluating %s at %s", ruleName(r), model.Duration(ts.Sub(time.Unix(0, 0)))))
+				continue
+			}
+			if r.Record != "" {
+				if err := appendRecorded(pt, r, vec, ts); err != nil {
+					return append(errs, err)
+				}
+				continue
+			}
+			active[r.Alert] = evalTestAlert(ctx, r, vec, ts, active[r.Alert], query)
+		}
+
+		for i, at := range t.AlertRuleTests {
+			if ts.After(alertTimes[i]) || !ts.Add(interval).After(alertTimes[i]) {
+				continue
+			}
+			firing[i] = nil
+			for _, r := range rules {
+				if r.Alert != at.Alertname {
+					continue
+				}
+				for _, a := range active[r.Alert] {
+					if ts.Sub(a.activeAt) >= time.Duration(r.For) {
+						firing[i] = append(firing[i], a)
+					}
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	for i, at := range t.AlertRuleTests {
+		if err := compareTestAlerts(at, firing[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i, et := range t.PromQLExprTests {
+		vec, err := query(ctx, et.Expr, exprTimes[i])
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "evaluating %s at %s", et.Expr, et.EvalTime))
+			continue
+		}
+		if err := compareTestSamples(et, vec); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func ruleName(r rulefmt.Rule) string {
+	if r.Alert != "" {
+		return r.Alert
+	}
+	return r.Record
+}
+
+// appendRecorded stores the output of a recording rule evaluated at ts.
+func appendRecorded(pt *promql.Test, r rulefmt.Rule, vec promql.Vector, ts time.Time) error {
+	app, err := pt.Storage().Appender()
+	if err != nil {
+		return err
+	}
+	for _, s := range vec {
+		b := labels.NewBuilder(s.Metric).Set(labels.MetricName, r.Record)
+		for n, v := range r.Labels {
+			b.Set(n, v)
+		}
+		if _, err := app.Add(b.Labels(), ts.UnixNano()/int64(time.Millisecond), s.V); err != nil {
+			app.Rollback()
+			return errors.Wrapf(err, "storing the output of %s", r.Record)
+		}
+	}
+	return app.Commit()
+}
+
+// evalTestAlert returns the alerts of r active at ts, given the result of
+// its expression and the alerts active at the previous evaluation.
+func evalTestAlert(ctx context.Context, r rulefmt.Rule, vec promql.Vector, ts time.Time, prev map[uint64]*testAlert, query template.QueryFunc) map[uint64]*testAlert {
+	expand := func(name, text string, ls labels.Labels, value float64) string {
+		data := struct {
+			Labels map[string]string
+			Value  float64
+		}{ls.Map(), value}
+		defs := "{{$labels := .Labels}}{{$value := .Value}}"
+		te := template.NewTemplateExpander(ctx, defs+text, name, data, model.TimeFromUnixNano(ts.UnixNano()), query, nil)
+		res, err := te.Expand()
+		if err != nil {
+			return fmt.Sprintf("<error expanding template: %s>", err)
+		}
+		return res
+	}
+
+	res := map[uint64]*testAlert{}
+	for _, s := range vec {
+		b := labels.NewBuilder(s.Metric).Del(labels.MetricName)
+		for n, v := range r.Labels {
+			b.Set(n, expand("__alert_"+r.Alert, v, s.Metric, s.V))
+		}
+		b.Set(labels.AlertName, r.Alert)
+		ls := b.Labels()
+
+		annotations := map[string]string{}
+		for n, v := range r.Annotations {
+			annotations[n] = expand("__alert_"+r.Alert, v, ls, s.V)
+		}
+		a := &testAlert{labels: ls, annotations: annotations, activeAt: ts}
+		if p, ok := prev[ls.Hash()]; ok {
+			a.activeAt = p.activeAt
+		}
+		res[ls.Hash()] = a
+	}
+	return res
+}
+
+// compareTestAlerts checks the alerts firing at the eval time of at.
+func compareTestAlerts(at configV1beta1.AlertRuleTest, firing []*testAlert) error {
+	var got, want []string
+	for _, a := range firing {
+		got = append(got, testAlertString(a.labels, a.annotations))
+	}
+	for _, e := range at.ExpAlerts {
+		ls := labels.NewBuilder(labels.FromMap(e.ExpLabels)).Set(labels.AlertName, at.Alertname).Labels()
+		want = append(want, testAlertString(ls, e.ExpAnnotations))
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if strings.Join(got, ", ") == strings.Join(want, ", ") {
+		return nil
+	}
+	return fmt.Errorf("alertname %s at %s, expected alerts [%s], got [%s]", at.Alertname, at.EvalTime, strings.Join(want, ", "), strings.Join(got, ", "))
+}
+
+func testAlertString(ls labels.Labels, annotations map[string]string) string {
+	if len(annotations) == 0 {
+		return ls.String()
+	}
+	return ls.String() + " " + labels.FromMap(annotations).String()
+}
+
+// compareTestSamples checks the result of the expression of et.
+func compareTestSamples(et configV1beta1.PromQLExprTest, vec promql.Vector) error {
+	want := make([]promql.Sample, 0, len(et.ExpSamples))
+	for _, s := range et.ExpSamples {
+		var ls labels.Labels
+		if s.Labels != "" {
+			var err error
+			if ls, err = promql.ParseMetric(s.Labels); err != nil {
+				return errors.Wrapf(err, "expression %s, invalid labels %q", et.Expr, s.Labels)
+			}
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(s.Value), 64)
+		if err != nil {
+			return errors.Wrapf(err, "expression %s, invalid value %q", et.Expr, s.Value)
+		}
+		want = append(want, promql.Sample{Metric: ls, Point: promql.Point{V: v}})
+	}
+	got := append(promql.Vector(nil), vec...)
+	byLabels := func(ss []promql.Sample) func(i, j int) bool {
+		return func(i, j int) bool { return labels.Compare(ss[i].Metric, ss[j].Metric) < 0 }
+	}
+	sort.Slice(want, byLabels(want))
+	sort.Slice(got, byLabels(got))
+
+	match := len(got) == len(want)
+	for i := 0; match && i < len(got); i++ {
+		match = labels.Equal(got[i].Metric, want[i].Metric) && sameSampleValue(got[i].V, want[i].V)
+	}
+	if match {
+		return nil
+	}
+	return fmt.Errorf("expression %s at %s, expected samples [%s], got [%s]", et.Expr, et.EvalTime, testSamplesString(want), testSamplesString(got))
+}
+
+func sameSampleValue(a, b float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	return a == b || math.Abs(a-b) <= 1e-6*math.Max(math.Abs(a), math.Abs(b))
+}
+
+func testSamplesString(ss []promql.Sample) string {
+	var res []string
+	for _, s := range ss {
+		res = append(res, fmt.Sprintf("%s %g", s.Metric, s.V))
+	}
+	return strings.Join(res, ", ")
+}
+
+// setTestsCondition sets the TestsPassed condition of rg. The tests are only
+// run again when the generation of rg changes.
+func (c *Controller) setTestsCondition(rg *configV1beta1.RuleGroup) {
+	if len(rg.Spec.Tests) == 0 {
+		meta.RemoveStatusCondition(&rg.Status.Conditions, configV1beta1.ConditionTestsPassed)
+		return
+	}
+	if cond := meta.FindStatusCondition(rg.Status.Conditions, configV1beta1.ConditionTestsPassed); cond != nil && cond.ObservedGeneration == rg.Generation {
+		return
+	}
+
+	cond := metav1.Condition{
+		Type:               configV1beta1.ConditionTestsPassed,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: rg.Generation,
+		LastTransitionTime: metav1.NewTime(c.now()),
+		Reason:             ReasonTestsPassed,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ruleTestTimeout)
+	defer cancel()
+	if errs := runRuleTests(ctx, rg); len(errs) > 0 {
+		var msgs []string
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = ReasonTestsFailed
+		cond.Message = strings.Join(msgs, "; ")
+	}
+	if len(cond.Message) > maxConditionMessage {
+		cond.Message = cond.Message[:maxConditionMessage]
+	}
+	meta.SetStatusCondition(&rg.Status.Conditions, cond)
+}
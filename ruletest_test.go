@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+
+	conf "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+// newTestedRuleGroup returns a rule group with the spec given in YAML,
+// using the JSON field names of the multi-word test fields.
+func newTestedRuleGroup(t *testing.T, name, spec string) *conf.RuleGroup {
+	rg := newRuleGroup(name, "rules: []")
+	if err := yaml.Unmarshal([]byte(spec), &rg.Spec); err != nil {
+		t.Fatal(err)
+	}
+	return rg
+}
+
+const testRulesWithTests = `
+rules:
+- record: job:errors:rate1m
+  expr: sum(rate(errors_total[1m])) by (job)
+- alert: ErrorsHigh
+  expr: job:errors:rate1m > 1
+  for: 5m
+  labels:
+    severity: page
+  annotations:
+    summary: '{{ $labels.job }} has {{ $value }} errors per second'
+tests:
+- name: errors
+  inputSeries:
+  - series: errors_total{job="api",instance="a"}
+    values: 0+120x20
+  - series: errors_total{job="web",instance="b"}
+    values: 0+30x20
+  alertRuleTests:
+  - evalTime: 3m
+    alertname: ErrorsHigh
+  - evalTime: 10m
+    alertname: ErrorsHigh
+    expAlerts:
+    - expLabels:
+        job: api
+        severity: page
+      expAnnotations:
+        summary: api has 2 errors per second
+  promqlExprTests:
+  - expr: job:errors:rate1m
+    evalTime: 10m
+    expSamples:
+    - labels: job:errors:rate1m{job="api"}
+      value: "2"
+    - labels: job:errors:rate1m{job="web"}
+      value: "0.5"
+`
+
+func TestRunRuleTests(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(rg *conf.RuleGroup)
+		errs   []string
+	}{
+		{
+			name: "passing",
+		},
+		{
+			name: "alert fires early",
+			change: func(rg *conf.RuleGroup) {
+				rg.Spec.Tests[0].AlertRuleTests[0].ExpAlerts = rg.Spec.Tests[0].AlertRuleTests[1].ExpAlerts
+			},
+			errs: []string{"test errors: alertname ErrorsHigh at 3m, expected alerts"},
+		},
+		{
+			name: "wrong annotation",
+			change: func(rg *conf.RuleGroup) {
+				rg.Spec.Tests[0].AlertRuleTests[1].ExpAlerts[0].ExpAnnotations["summary"] = "api is fine"
+			},
+			errs: []string{`got [{alertname="ErrorsHigh", job="api", severity="page"} {summary="api has 2 errors per second"}]`},
+		},
+		{
+			name: "wrong sample",
+			change: func(rg *conf.RuleGroup) {
+				rg.Spec.Tests[0].PromQLExprTests[0].ExpSamples[1].Value = "1"
+			},
+			errs: []string{"test errors: expression job:errors:rate1m at 10m, expected samples"},
+		},
+		{
+			name: "invalid sample value",
+			change: func(rg *conf.RuleGroup) {
+				rg.Spec.Tests[0].PromQLExprTests[0].ExpSamples[1].Value = "half"
+			},
+			errs: []string{`test errors: expression job:errors:rate1m, invalid value "half"`},
+		},
+		{
+			name: "invalid input series",
+			change: func(rg *conf.RuleGroup) {
+				rg.Spec.Tests[0].InputSeries[0].Values = "lots"
+			},
+			errs: []string{"test errors: invalid input series"},
+		},
+		{
+			name: "too many steps",
+			change: func(rg *conf.RuleGroup) {
+				rg.Spec.Tests[0].Interval = "1s"
+				rg.Spec.Tests[0].PromQLExprTests[0].EvalTime = "1d"
+			},
+			errs: []string{"test errors: evaluating up to 1d every 1s takes more than 10000 steps"},
+		},
+		{
+			name: "too many samples",
+			change: func(rg *conf.RuleGroup) {
+				rg.Spec.Tests[0].InputSeries[0].Values = "0+1x1000000"
+			},
+			errs: []string{"test errors: input series have more than 100000 samples"},
+		},
+		{
+			name: "invalid rules",
+			change: func(rg *conf.RuleGroup) {
+				rg.Spec.Rules[0].Expr = "sum("
+			},
+			errs: []string{"the tests were not run"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rg := newTestedRuleGroup(t, "test", testRulesWithTests)
+			if tt.change != nil {
+				tt.change(rg)
+			}
+			errs := runRuleTests(context.Background(), rg)
+			if len(errs) != len(tt.errs) {
+				t.Fatalf("expected %d errors, got %v", len(tt.errs), errs)
+			}
+			for i, err := range errs {
+				if !strings.Contains(err.Error(), tt.errs[i]) {
+					t.Errorf("expected error containing %q, got %q", tt.errs[i], err)
+				}
+			}
+		})
+	}
+
+	// Tests are not run past their deadline.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	errs := runRuleTests(ctx, newTestedRuleGroup(t, "test", testRulesWithTests))
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "test errors was not run") {
+		t.Errorf("expected the tests not to be run, got %v", errs)
+	}
+}
+
+func TestRuleGroupTests(t *testing.T) {
+	rg := newTestedRuleGroup(t, "test", testRulesWithTests)
+	rg.Kind = "RuleGroup"
+	rg.Spec.Tests[0].PromQLExprTests[0].ExpSamples[1].Value = "1"
+
+	f := newFixture(t)
+	f.objects = append(f.objects, rg)
+	c, _, _ := f.newController()
+
+	// Failing tests are denied at admission.
+	raw, _ := json.Marshal(rg)
+	res := c.admit(v1.AdmissionReview{Request: &v1.AdmissionRequest{
+		Operation: v1.Create,
+		Resource:  metav1.GroupVersionResource(conf.SchemeGroupVersion.WithResource("rulegroups")),
+		Object:    runtime.RawExtension{Raw: raw},
+	}})
+	if res.Allowed || !strings.Contains(res.Result.Message, "test errors") {
+		t.Fatalf("expected the rule group to be denied, got %v", res.Result)
+	}
+
+	// And reported in the TestsPassed condition.
+	c.reconcileRuleGroup("default/test", rg)
+	got, err := f.client.ConfigV1beta1().RuleGroups("default").Get(context.Background(), "test", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, conf.ConditionTestsPassed)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != ReasonTestsFailed || !strings.Contains(cond.Message, "job:errors:rate1m") {
+		t.Fatalf("expected TestsPassed to be false, got %#v", cond)
+	}
+
+	// A new generation is tested again.
+	got.Spec.Tests[0].PromQLExprTests[0].ExpSamples[1].Value = "0.5"
+	got.Generation++
+	c.reconcileRuleGroup("default/test", got)
+	got, err = f.client.ConfigV1beta1().RuleGroups("default").Get(context.Background(), "test", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cond = meta.FindStatusCondition(got.Status.Conditions, conf.ConditionTestsPassed)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != ReasonTestsPassed {
+		t.Fatalf("expected TestsPassed to be true, got %#v", cond)
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	promconfig "github.com/QubitProducts/prom-config-controller/internal/prom2"
+	"github.com/prometheus/common/model"
+	yaml "gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	configV1beta1 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+	configV1beta2 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta2"
+)
+
+// relabelTarget is the form prometheus requires of the target label of a
+// replace action, which may refer to regex capture groups.
+var relabelTarget = regexp.MustCompile(`^(?:(?:[a-zA-Z_]|\$(?:\{\w+\}|\w+))+\w*)+$`)
+
+var relabelActions = []string{
+	string(promconfig.RelabelReplace),
+	string(promconfig.RelabelKeep),
+	string(promconfig.RelabelDrop),
+	string(promconfig.RelabelHashMod),
+	string(promconfig.RelabelLabelMap),
+	string(promconfig.RelabelLabelDrop),
+	string(promconfig.RelabelLabelKeep),
+}
+
+// scrapeJSONNames maps the YAML names of the fields of structured scrape
+// specs to their JSON names.
+var scrapeJSONNames = yamlJSONNames(reflect.TypeOf(configV1beta2.ScrapeSpec{}), map[string]string{})
+
+func yamlJSONNames(t reflect.Type, names map[string]string) map[string]string {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		return yamlJSONNames(t.Elem(), names)
+	case reflect.Struct:
+	default:
+		return names
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		y := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		j := strings.Split(f.Tag.Get("json"), ",")[0]
+		if y != "" && y != "-" && j != "" {
+			names[y] = j
+		}
+		yamlJSONNames(f.Type, names)
+	}
+	return names
+}
+
+// baseConfig is the part of the last rendered base config that scrapes are
+// validated against.
+type baseConfig struct {
+	sync.Mutex
+	global *promconfig.GlobalConfig
+	jobs   map[string]bool
+}
+
+// setBaseConfig records the base config that was rendered.
+func (c *Controller) setBaseConfig(cfg *promconfig.Config) {
+	c.base.Lock()
+	defer c.base.Unlock()
+	global := cfg.GlobalConfig
+	c.base.global = &global
+	c.base.jobs = map[string]bool{}
+	for _, sc := range cfg.ScrapeConfigs {
+		c.base.jobs[sc.JobName] = true
+	}
+}
+
+// baseGlobal returns the global config of the last rendered base config,
+// or the prometheus defaults if none has been rendered, and whether the job
+// name is used by the base config.
+func (c *Controller) baseGlobal(jobName string) (promconfig.GlobalConfig, bool) {
+	c.base.Lock()
+	defer c.base.Unlock()
+	if c.base.global == nil {
+		return promconfig.DefaultGlobalConfig, false
+	}
+	return *c.base.global, c.base.jobs[jobName]
+}
+
+// scrapePath is the field path of part of a scrape spec. Parts set by the
+// structured fields of a spec are named by their JSON names under spec,
+// those set in the raw YAML by their YAML names under rawPath.
+type scrapePath struct {
+	*field.Path
+	structured bool
+}
+
+func (p scrapePath) child(key string) scrapePath {
+	if p.structured {
+		if j, ok := scrapeJSONNames[key]; ok {
+			key = j
+		}
+	}
+	return scrapePath{p.Path.Child(key), p.structured}
+}
+
+func (p scrapePath) index(i int) scrapePath {
+	return scrapePath{p.Path.Index(i), p.structured}
+}
+
+// validateScrapeSpec validates the spec of the scrape with the given
+// metadata as prometheus would when loading it as part of the rendered
+// config, returning the converted config, with the job name it is rendered
+// with, and an error, with the field path of the problem, for each problem
+// found. rawPath is the field path of the raw YAML of the spec.
+func (c *Controller) validateScrapeSpec(meta metav1.ObjectMeta, spec *configV1beta2.ScrapeSpec, rawPath *field.Path) (*promconfig.ScrapeConfig, field.ErrorList) {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	fields, err := structuredScrapeFields(spec)
+	if err != nil {
+		return nil, field.ErrorList{field.Invalid(specPath, "", err.Error())}
+	}
+	doc := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(spec.Raw), &doc); err != nil {
+		return nil, field.ErrorList{field.Invalid(rawPath, "", err.Error())}
+	}
+	for k, v := range fields {
+		doc[k] = v
+	}
+	keyPath := func(key string) scrapePath {
+		if _, ok := fields[key]; ok {
+			return scrapePath{specPath, true}.child(key)
+		}
+		return scrapePath{rawPath, false}.child(key)
+	}
+
+	// The job name is checked against the base config as it is rendered,
+	// which depends on the job naming policy.
+	pcfg, convErr := convertScrapeSpec(fmt.Sprintf("%s/%s", meta.Namespace, meta.Name), spec)
+	jobName := ""
+	if pcfg != nil {
+		if jobName, err = c.scrapeJobName(&configV1beta1.Scrape{ObjectMeta: meta}, pcfg); err != nil {
+			errs = append(errs, field.Invalid(keyPath("job_name").Path, pcfg.JobName, err.Error()))
+		} else {
+			pcfg.JobName = jobName
+		}
+	}
+	global, claimed := c.baseGlobal(jobName)
+	if claimed {
+		errs = append(errs, field.Duplicate(keyPath("job_name").Path, jobName))
+	}
+
+	errs = append(errs, c.validateScrapeIntervals(doc, global, keyPath)...)
+	for _, key := range []string{"relabel_configs", "metric_relabel_configs"} {
+		errs = append(errs, validateRelabelConfigs(doc[key], keyPath(key))...)
+	}
+	errs = append(errs, c.validateScrapeFiles(doc, keyPath)...)
+
+	// Anything else prometheus rejects is reported against the whole spec,
+	// unless it has already been reported in detail.
+	if convErr != nil {
+		if len(errs) == 0 {
+			errs = append(errs, field.Invalid(specPath, "", convErr.Error()))
+		}
+		return nil, errs
+	}
+	if len(errs) == 0 {
+		if err := loadWithGlobal(global, pcfg); err != nil {
+			errs = append(errs, field.Invalid(specPath, "", err.Error()))
+		}
+	}
+	return pcfg, errs
+}
+
+// validateScrapeIntervals checks the scrape interval and timeout, taking
+// their defaults from the global config.
+func (c *Controller) validateScrapeIntervals(doc map[string]interface{}, global promconfig.GlobalConfig, keyPath func(string) scrapePath) field.ErrorList {
+	var errs field.ErrorList
+	parse := func(key string) (model.Duration, bool) {
+		v, ok := doc[key]
+		if !ok {
+			return 0, false
+		}
+		d, err := model.ParseDuration(fmt.Sprint(v))
+		if err != nil {
+			errs = append(errs, field.Invalid(keyPath(key).Path, v, err.Error()))
+			return 0, false
+		}
+		return d, true
+	}
+
+	interval, ok := parse("scrape_interval")
+	intervalFrom := "scrape_interval"
+	if !ok {
+		interval = global.ScrapeInterval
+		intervalFrom = "global scrape_interval"
+	}
+	if timeout, ok := parse("scrape_timeout"); ok && timeout > interval {
+		errs = append(errs, field.Invalid(keyPath("scrape_timeout").Path, doc["scrape_timeout"],
+			fmt.Sprintf("greater than the %s of %s", intervalFrom, interval)))
+	}
+	return errs
+}
+
+// validateRelabelConfigs checks each relabel config as prometheus does,
+// reporting every problem rather than just the first.
+func validateRelabelConfigs(v interface{}, p scrapePath) field.ErrorList {
+	if v == nil {
+		return nil
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		return field.ErrorList{field.Invalid(p.Path, v, "must be a list")}
+	}
+
+	var errs field.ErrorList
+	for i, item := range items {
+		ip := p.index(i)
+		rc, ok := stringMap(item)
+		if !ok {
+			errs = append(errs, field.Invalid(ip.Path, item, "must be a map"))
+			continue
+		}
+		before := len(errs)
+
+		action := string(promconfig.RelabelReplace)
+		if a, ok := rc["action"]; ok {
+			action = strings.ToLower(fmt.Sprint(a))
+			known := false
+			for _, ka := range relabelActions {
+				known = known || ka == action
+			}
+			if !known {
+				errs = append(errs, field.NotSupported(ip.child("action").Path, a, relabelActions))
+			}
+		}
+
+		if re, ok := rc["regex"]; ok {
+			if _, err := regexp.Compile("^(?:" + fmt.Sprint(re) + ")$"); err != nil {
+				errs = append(errs, field.Invalid(ip.child("regex").Path, re, err.Error()))
+			}
+		}
+
+		if sls, ok := rc["source_labels"].([]interface{}); ok {
+			for j, sl := range sls {
+				if !model.LabelName(fmt.Sprint(sl)).IsValid() {
+					errs = append(errs, field.Invalid(ip.child("source_labels").index(j).Path, sl, "invalid label name"))
+				}
+			}
+		}
+
+		target, hasTarget := rc["target_label"]
+		targetPath := ip.child("target_label").Path
+		switch promconfig.RelabelAction(action) {
+		case promconfig.RelabelReplace:
+			if !hasTarget {
+				errs = append(errs, field.Required(targetPath, "required for the replace action"))
+			} else if !relabelTarget.MatchString(fmt.Sprint(target)) {
+				errs = append(errs, field.Invalid(targetPath, target, "invalid label name"))
+			}
+		case promconfig.RelabelHashMod:
+			if !hasTarget {
+				errs = append(errs, field.Required(targetPath, "required for the hashmod action"))
+			} else if !model.LabelName(fmt.Sprint(target)).IsValid() {
+				errs = append(errs, field.Invalid(targetPath, target, "invalid label name"))
+			}
+			if m, ok := rc["modulus"]; !ok || fmt.Sprint(m) == "0" {
+				errs = append(errs, field.Required(ip.child("modulus").Path, "a non-zero modulus is required for the hashmod action"))
+			}
+		case promconfig.RelabelLabelDrop, promconfig.RelabelLabelKeep:
+			for _, k := range sortedMapKeys(rc) {
+				var unused bool
+				switch k {
+				case "source_labels", "target_label", "modulus":
+					unused = true
+				case "separator":
+					unused = fmt.Sprint(rc[k]) != promconfig.DefaultRelabelConfig.Separator
+				case "replacement":
+					unused = fmt.Sprint(rc[k]) != promconfig.DefaultRelabelConfig.Replacement
+				}
+				if unused {
+					errs = append(errs, field.Forbidden(ip.child(k).Path, fmt.Sprintf("the %s action only uses regex", action)))
+				}
+			}
+		}
+
+		// Leave anything else to prometheus.
+		if len(errs) == before {
+			bs, _ := yaml.Marshal(rc)
+			var prc promconfig.RelabelConfig
+			if err := yaml.Unmarshal(bs, &prc); err != nil {
+				errs = append(errs, field.Invalid(ip.Path, "", err.Error()))
+			}
+		}
+	}
+	return errs
+}
+
+// validateScrapeFiles checks that the files a scrape refers to are among
+// the files known to exist in the prometheus pods.
+func (c *Controller) validateScrapeFiles(doc map[string]interface{}, keyPath func(string) scrapePath) field.ErrorList {
+	if len(c.ScrapeFiles) == 0 {
+		return nil
+	}
+
+	var errs field.ErrorList
+	check := func(p scrapePath, v interface{}, glob bool) {
+		f := fmt.Sprint(v)
+		if !path.IsAbs(f) {
+			errs = append(errs, field.Invalid(p.Path, v, "must be an absolute path"))
+			return
+		}
+		if glob {
+			f = path.Dir(f) + "/"
+		}
+		if !c.scrapeFileExists(f) {
+			errs = append(errs, field.NotFound(p.Path, v))
+		}
+	}
+	checkHTTP := func(m map[string]interface{}, pathOf func(string) scrapePath) {
+		if v, ok := m["bearer_token_file"]; ok {
+			check(pathOf("bearer_token_file"), v, false)
+		}
+		if tls, ok := stringMap(m["tls_config"]); ok {
+			for _, k := range []string{"ca_file", "cert_file", "key_file"} {
+				if v, ok := tls[k]; ok {
+					check(pathOf("tls_config").child(k), v, false)
+				}
+			}
+		}
+	}
+
+	checkHTTP(doc, keyPath)
+	if sds, ok := doc["kubernetes_sd_configs"].([]interface{}); ok {
+		for i, sd := range sds {
+			if m, ok := stringMap(sd); ok {
+				checkHTTP(m, keyPath("kubernetes_sd_configs").index(i).child)
+			}
+		}
+	}
+	if sds, ok := doc["file_sd_configs"].([]interface{}); ok {
+		for i, sd := range sds {
+			m, _ := stringMap(sd)
+			files, _ := m["files"].([]interface{})
+			for j, f := range files {
+				check(keyPath("file_sd_configs").index(i).child("files").index(j), f, true)
+			}
+		}
+	}
+	return errs
+}
+
+// scrapeFileExists reports whether f is one of the scrape files, or within
+// one of the scrape directories, that exist in the prometheus pods.
+func (c *Controller) scrapeFileExists(f string) bool {
+	for _, sf := range c.ScrapeFiles {
+		if f == sf || (strings.HasSuffix(sf, "/") && strings.HasPrefix(f, sf)) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadWithGlobal loads a config made of the global config and the scrape,
+// so that prometheus checks the scrape against the global config.
+func loadWithGlobal(global promconfig.GlobalConfig, pcfg *promconfig.ScrapeConfig) error {
+	sc := *pcfg
+	cfg := promconfig.Config{
+		GlobalConfig:  global,
+		ScrapeConfigs: []*promconfig.ScrapeConfig{&sc},
+	}
+	bs, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = promconfig.Load(string(bs))
+	return err
+}
+
+// stringMap returns a YAML map with string keys.
+func stringMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			res[fmt.Sprint(k)] = v
+		}
+		return res, true
+	}
+	return nil, false
+}
+
+func sortedMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"text/template"
+
+	promconfig "github.com/QubitProducts/prom-config-controller/internal/prom2"
+	v1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	confv1beta2 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta2"
+)
+
+func TestAdmitScrapeValidation(t *testing.T) {
+	base, err := promconfig.Load(`global:
+  scrape_interval: 15s
+scrape_configs:
+- job_name: base
+  static_configs:
+  - targets: [localhost:9090]
+- job_name: team-test
+  static_configs:
+  - targets: [localhost:9091]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	structured := func(spec confv1beta2.ScrapeSpec) runtime.Object {
+		return &confv1beta2.Scrape{
+			TypeMeta:   metav1.TypeMeta{APIVersion: confv1beta2.SchemeGroupVersion.String(), Kind: "Scrape"},
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+			Spec:       spec,
+		}
+	}
+	raw := func(spec string) runtime.Object {
+		s := newScrape("test", spec)
+		s.Kind = "Scrape"
+		return s
+	}
+
+	tests := []struct {
+		name   string
+		policy string
+		obj    runtime.Object
+		fields []string
+	}{
+		{
+			name: "valid",
+			obj: raw(`job_name: test
+scrape_interval: 30s
+scrape_timeout: 20s
+bearer_token_file: /var/run/secrets/kubernetes.io/serviceaccount/token
+relabel_configs:
+- source_labels: [__meta_kubernetes_pod_label_app]
+  regex: web.*
+  action: keep
+`),
+		},
+		{
+			name: "every relabel problem",
+			obj: raw(`job_name: test
+relabel_configs:
+- source_labels: [__meta_kubernetes_pod_label_app, bad-label]
+  regex: (
+  action: keep
+- action: bogus
+- source_labels: [app]
+  target_label: 1app
+- action: labeldrop
+  regex: tmp_.*
+  target_label: foo
+metric_relabel_configs:
+- action: hashmod
+  target_label: shard
+`),
+			fields: []string{
+				"spec.metric_relabel_configs[0].modulus",
+				"spec.relabel_configs[0].regex",
+				"spec.relabel_configs[0].source_labels[1]",
+				"spec.relabel_configs[1].action",
+				"spec.relabel_configs[2].target_label",
+				"spec.relabel_configs[3].target_label",
+			},
+		},
+		{
+			name: "timeout over interval",
+			obj: raw(`job_name: test
+scrape_interval: 10s
+scrape_timeout: 20s
+`),
+			fields: []string{"spec.scrape_timeout"},
+		},
+		{
+			name: "timeout over global interval",
+			obj: raw(`job_name: test
+scrape_timeout: 20s
+`),
+			fields: []string{"spec.scrape_timeout"},
+		},
+		{
+			name:   "job name of the base config",
+			policy: JobNameUser,
+			obj: raw(`job_name: base
+`),
+			fields: []string{"spec.job_name"},
+		},
+		{
+			name: "job name of the base config is not rendered",
+			obj: raw(`job_name: base
+`),
+		},
+		{
+			name:   "rendered job name of the base config",
+			policy: JobNameTemplate,
+			obj: raw(`job_name: test
+`),
+			fields: []string{"spec.job_name"},
+		},
+		{
+			name: "missing files",
+			obj: raw(`job_name: test
+bearer_token_file: /etc/prometheus/token
+file_sd_configs:
+- files: [/etc/prometheus/targets/*.json]
+kubernetes_sd_configs:
+- role: pod
+  tls_config:
+    ca_file: ca.crt
+`),
+			fields: []string{
+				"spec.bearer_token_file",
+				"spec.file_sd_configs[0].files[0]",
+				"spec.kubernetes_sd_configs[0].tls_config.ca_file",
+			},
+		},
+		{
+			name: "other problems are reported against the spec",
+			obj: raw(`job_name: test
+unknown_field: true
+`),
+			fields: []string{"spec"},
+		},
+		{
+			name: "structured",
+			obj: structured(confv1beta2.ScrapeSpec{
+				ScrapeInterval: "10s",
+				RelabelConfigs: []confv1beta2.RelabelConfig{{SourceLabels: []string{"app"}, Regex: "(", Action: "keep"}},
+				Raw:            "scrape_timeout: 20s\n",
+			}),
+			fields: []string{"spec.raw.scrape_timeout", "spec.relabelConfigs[0].regex"},
+		},
+	}
+
+	c := &Controller{}
+	c.JobNameTemplate = template.Must(template.New("jobname").Parse(`team-{{ .Name }}`))
+	c.ScrapeFiles = []string{"/var/run/secrets/kubernetes.io/serviceaccount/", "/etc/prometheus/targets.json"}
+	c.setBaseConfig(base)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.JobNamePolicy = tt.policy
+			bs, _ := json.Marshal(tt.obj)
+			gvk := tt.obj.GetObjectKind().GroupVersionKind()
+			ar := v1.AdmissionReview{
+				Request: &v1.AdmissionRequest{
+					Resource: metav1.GroupVersionResource(gvk.GroupVersion().WithResource("scrapes")),
+					Object:   runtime.RawExtension{Raw: bs},
+				},
+			}
+
+			res := c.admit(ar)
+			if len(tt.fields) == 0 {
+				if !res.Allowed {
+					t.Fatalf("expected scrape to be allowed, got %v", res.Result)
+				}
+				return
+			}
+			if res.Allowed {
+				t.Fatalf("expected scrape to be denied")
+			}
+
+			var fields []string
+			for _, c := range res.Result.Details.Causes {
+				if c.Field == "" {
+					t.Errorf("expected a field path for %q", c.Message)
+				}
+				fields = append(fields, c.Field)
+			}
+			sort.Strings(fields)
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("expected causes for %v, got %v", tt.fields, res.Result.Details.Causes)
+			}
+		})
+	}
+}
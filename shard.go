@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	yaml "gopkg.in/yaml.v2"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Rule sharding policies, these control how the rendered rules are split
+// across ConfigMaps.
+const (
+	// ShardRulesNone renders every rule group into RuleConfigMap.
+	ShardRulesNone = "none"
+	// ShardRulesByNamespace renders the rule groups of each namespace into
+	// their own ConfigMaps, named RuleConfigMap-<namespace>-<n>.
+	ShardRulesByNamespace = "namespace"
+	// ShardRulesBySize renders the rule groups into as few ConfigMaps as
+	// fit within RuleShardSize, named RuleConfigMap-<n>.
+	ShardRulesBySize = "size"
+)
+
+// ruleShardLabel is set on rule shard ConfigMaps to the name of the
+// RuleConfigMap they are shards of. It is used to find stale shards, and can
+// be used by sidecars to find the shards to mount.
+const ruleShardLabel = "prom-config-controller/rule-shard"
+
+// groupsHeader is the start of a rendered rulefmt.RuleGroups.
+const groupsHeader = "groups:\n"
+
+// ruleShard is a set of rule groups rendered into one ConfigMap.
+type ruleShard struct {
+	name   string
+	groups *rulefmt.RuleGroups
+	size   int
+}
+
+// sharding reports whether rules are sharded.
+func (c *Controller) sharding() bool {
+	return c.RuleShardBy != "" && c.RuleShardBy != ShardRulesNone
+}
+
+// ruleShardGlob returns the rule_files entry that matches every rule shard,
+// or an empty string if rules are not sharded.
+func (c *Controller) ruleShardGlob() string {
+	if !c.sharding() || c.RuleShardDir == "" {
+		return ""
+	}
+	return path.Join(c.RuleShardDir, c.RuleConfigMap+"-*.yaml")
+}
+
+// shardRules splits the rule groups, given in key order, into shards. Shards
+// are filled in order, so their names only depend on the rule groups and
+// their sizes. A rule group larger than the size budget is given a shard of
+// its own.
+func (c *Controller) shardRules(keys []string, groups []rulefmt.RuleGroup) ([]*ruleShard, error) {
+	var shards []*ruleShard
+	counts := map[string]int{}
+	current := map[string]*ruleShard{}
+
+	for i, g := range groups {
+		bs, err := yaml.Marshal(&rulefmt.RuleGroups{Groups: []rulefmt.RuleGroup{g}})
+		if err != nil {
+			return nil, errors.Wrapf(err, "rendering rule group %s", keys[i])
+		}
+		size := len(bs) - len(groupsHeader)
+
+		prefix := c.RuleConfigMap
+		if c.RuleShardBy == ShardRulesByNamespace {
+			ns, _, err := cache.SplitMetaNamespaceKey(keys[i])
+			if err != nil {
+				return nil, err
+			}
+			prefix = fmt.Sprintf("%s-%s", prefix, ns)
+		}
+
+		s := current[prefix]
+		if s == nil || (c.RuleShardSize > 0 && s.size+size > c.RuleShardSize) {
+			s = &ruleShard{
+				name:   fmt.Sprintf("%s-%d", prefix, counts[prefix]),
+				groups: &rulefmt.RuleGroups{},
+				size:   len(groupsHeader),
+			}
+			counts[prefix]++
+			current[prefix] = s
+			shards = append(shards, s)
+		}
+		if c.RuleShardSize > 0 && len(groupsHeader)+size > c.RuleShardSize {
+			glog.Infof("rule group %s is larger than the shard size, %d bytes", keys[i], size)
+		}
+
+		s.groups.Groups = append(s.groups.Groups, g)
+		s.size += size
+	}
+
+	sort.Slice(shards, func(i, j int) bool { return shards[i].name < shards[j].name })
+	return shards, nil
+}
+
+// updateRuleShards writes the rule shards to their ConfigMaps, and deletes
+// the ConfigMaps of shards that are no longer used, and the unsharded
+// RuleConfigMap.
+func (c *Controller) updateRuleShards(keys []string, groups []rulefmt.RuleGroup) (bool, error) {
+	if c.RuleConfigMap == "" {
+		return false, nil
+	}
+
+	shards, err := c.shardRules(keys, groups)
+	if err != nil {
+		return false, err
+	}
+
+	lbls := map[string]string{ruleShardLabel: c.RuleConfigMap}
+	changed := false
+	used := map[string]bool{}
+	for _, s := range shards {
+		bs, err := yaml.Marshal(s.groups)
+		if err != nil {
+			return changed, errors.Wrapf(err, "rendering rule shard %s", s.name)
+		}
+		updated, err := c.updateConfigMap(s.name, s.name+".yaml", c.RuleConfigMapNS, lbls, bs)
+		if err != nil {
+			return changed, errors.Wrapf(err, "updating rule shard %s", s.name)
+		}
+		changed = changed || updated
+		used[s.name] = true
+	}
+
+	deleted, err := c.deleteRuleConfigMaps(used)
+	return changed || deleted, err
+}
+
+// deleteRuleConfigMaps deletes the rule shard ConfigMaps not in keep, and
+// the unsharded RuleConfigMap. They are left over from before the rules
+// were sharded differently, or written to RuleDir, and prometheus would
+// load their rules twice.
+func (c *Controller) deleteRuleConfigMaps(keep map[string]bool) (bool, error) {
+	if c.RuleConfigMap == "" {
+		return false, nil
+	}
+
+	ctx := context.Background()
+	lbls := map[string]string{ruleShardLabel: c.RuleConfigMap}
+	cms, err := c.kubeclientset.CoreV1().ConfigMaps(c.RuleConfigMapNS).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(lbls).String(),
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "listing rule shards")
+	}
+	changed := false
+	for _, cm := range cms.Items {
+		if keep[cm.Name] {
+			continue
+		}
+		glog.Infof("deleting stale rule shard %s/%s", cm.Namespace, cm.Name)
+		if err := c.kubeclientset.CoreV1().ConfigMaps(cm.Namespace).Delete(ctx, cm.Name, metav1.DeleteOptions{}); err != nil {
+			return changed, errors.Wrapf(err, "deleting rule shard %s", cm.Name)
+		}
+		changed = true
+	}
+
+	err = c.kubeclientset.CoreV1().ConfigMaps(c.RuleConfigMapNS).Delete(ctx, c.RuleConfigMap, metav1.DeleteOptions{})
+	switch {
+	case err == nil:
+		glog.Infof("deleted unsharded rules configmap %s/%s", c.RuleConfigMapNS, c.RuleConfigMap)
+		changed = true
+	case !kerrors.IsNotFound(err):
+		return changed, errors.Wrapf(err, "deleting unsharded rules configmap %s", c.RuleConfigMap)
+	}
+
+	return changed, nil
+}
+
+// removeRuleFile removes the single RuleFile, which is not written while
+// rules are sharded or written to RuleDir.
+func (c *Controller) removeRuleFile() (bool, error) {
+	if c.RuleFile == "" {
+		return false, nil
+	}
+	if _, err := os.Stat(c.RuleFile); os.IsNotExist(err) {
+		return false, nil
+	}
+	glog.Infof("removing single rules file %s", c.RuleFile)
+	if err := removeFile(c.RuleFile); err != nil {
+		return false, err
+	}
+	return true, nil
+}
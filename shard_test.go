@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	yaml "gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testShardGroups() ([]string, []rulefmt.RuleGroup) {
+	keys := []string{"a/one", "a/two", "b/one"}
+	var groups []rulefmt.RuleGroup
+	for _, k := range keys {
+		groups = append(groups, rulefmt.RuleGroup{
+			Name:  k,
+			Rules: []rulefmt.Rule{{Record: "something", Expr: "1 + 1"}},
+		})
+	}
+	return keys, groups
+}
+
+func TestShardRules(t *testing.T) {
+	keys, groups := testShardGroups()
+	bs, _ := yaml.Marshal(&rulefmt.RuleGroups{Groups: groups[:1]})
+	one := len(bs)
+
+	tests := []struct {
+		name   string
+		by     string
+		size   int
+		shards map[string][]string
+	}{
+		{
+			name: "size, all fit",
+			by:   ShardRulesBySize,
+			size: 1024,
+			shards: map[string][]string{
+				"rules-0": {"a/one", "a/two", "b/one"},
+			},
+		},
+		{
+			name: "size, two per shard",
+			by:   ShardRulesBySize,
+			size: 2*one - len(groupsHeader),
+			shards: map[string][]string{
+				"rules-0": {"a/one", "a/two"},
+				"rules-1": {"b/one"},
+			},
+		},
+		{
+			name: "namespace",
+			by:   ShardRulesByNamespace,
+			size: 1024,
+			shards: map[string][]string{
+				"rules-a-0": {"a/one", "a/two"},
+				"rules-b-0": {"b/one"},
+			},
+		},
+		{
+			name: "namespace and size",
+			by:   ShardRulesByNamespace,
+			size: one,
+			shards: map[string][]string{
+				"rules-a-0": {"a/one"},
+				"rules-a-1": {"a/two"},
+				"rules-b-0": {"b/one"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Controller{ControllerConfig: ControllerConfig{
+				RuleConfigMap: "rules",
+				RuleShardBy:   tt.by,
+				RuleShardSize: tt.size,
+			}}
+			shards, err := c.shardRules(keys, groups)
+			if err != nil {
+				t.Fatalf("sharding failed, %v", err)
+			}
+
+			got := map[string][]string{}
+			for _, s := range shards {
+				bs, _ := yaml.Marshal(s.groups)
+				if len(bs) != s.size {
+					t.Errorf("shard %s size %d does not match rendered size %d", s.name, s.size, len(bs))
+				}
+				if len(bs) > tt.size {
+					t.Errorf("shard %s is %d bytes, over the budget of %d", s.name, len(bs), tt.size)
+				}
+				for _, g := range s.groups.Groups {
+					got[s.name] = append(got[s.name], g.Name)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.shards) {
+				t.Errorf("expected shards %v, got %v", tt.shards, got)
+			}
+		})
+	}
+}
+
+func TestUpdateRuleShards(t *testing.T) {
+	f := newFixture(t)
+	stale := newConfigMap("default", "prom-config-controller-9", "prom-config-controller-9.yaml", "groups: []\n")
+	stale.Labels = map[string]string{ruleShardLabel: "prom-config-controller"}
+	unsharded := newConfigMap("default", "prom-config-controller", "rules.yaml", "groups: []\n")
+	unrelated := newConfigMap("default", "unrelated", "unrelated.yaml", "")
+	f.kubeobjects = append(f.kubeobjects, stale, unsharded, unrelated)
+
+	c, _, _ := f.newController()
+	c.RuleShardBy = ShardRulesBySize
+	c.RuleShardSize = 1024
+	c.RuleShardDir = "/etc/prometheus/rules"
+
+	keys, groups := testShardGroups()
+	changed, err := c.updateRuleShards(keys, groups)
+	if err != nil {
+		t.Fatalf("updating shards failed, %v", err)
+	}
+	if !changed {
+		t.Errorf("expected shards to be changed")
+	}
+
+	ctx := context.Background()
+	cms, err := f.kubeclient.CoreV1().ConfigMaps("default").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("listing configmaps failed, %v", err)
+	}
+	var names []string
+	for _, cm := range cms.Items {
+		names = append(names, cm.Name)
+		if cm.Name == "prom-config-controller-0" {
+			if cm.Labels[ruleShardLabel] != "prom-config-controller" {
+				t.Errorf("expected shard to be labelled, got %v", cm.Labels)
+			}
+			if !strings.Contains(cm.Data["prom-config-controller-0.yaml"], "name: b/one") {
+				t.Errorf("expected shard to hold the rule groups, got %v", cm.Data)
+			}
+		}
+	}
+	if exp := []string{"prom-config-controller-0", "unrelated"}; !reflect.DeepEqual(names, exp) {
+		t.Errorf("expected configmaps %v, got %v", exp, names)
+	}
+
+	if changed, err = c.updateRuleShards(keys, groups); err != nil || changed {
+		t.Errorf("expected no change on second update, got %v, %v", changed, err)
+	}
+
+	if _, err := c.renderScrapes(); err != nil {
+		t.Fatalf("rendering config failed, %v", err)
+	}
+	sec, err := f.kubeclient.CoreV1().Secrets("default").Get(ctx, "prom-config-controller", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting secret failed, %v", err)
+	}
+	if exp := "rule_files:\n- /etc/prometheus/rules/prom-config-controller-*.yaml\n"; !strings.Contains(string(sec.Data["prom-config-controller.yaml"]), exp) {
+		t.Errorf("expected rule_files glob in config, got:\n%s", sec.Data["prom-config-controller.yaml"])
+	}
+}
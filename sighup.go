@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// signalReloader reloads a process running in the same PID namespace, such
+// as a sidecar of a pod with shareProcessNamespace, by sending it SIGHUP.
+// This avoids enabling the lifecycle HTTP API of prometheus or alertmanager.
+type signalReloader struct {
+	// procDir is where the proc filesystem is mounted.
+	procDir string
+	// name is the name of the processes to signal. It is matched against
+	// the command name, and the base name of the first argument, of each
+	// process.
+	name string
+}
+
+// Reload signals every process with the configured name.
+func (r *signalReloader) Reload() {
+	r.reload(context.Background(), func(string, error) {})
+}
+
+// reload signals every process with the configured name, reporting each
+// process as name[pid]. Whether processes were found and signalled is
+// logged and counted in the reload signals metric.
+func (r *signalReloader) reload(ctx context.Context, report func(target string, err error)) {
+	glog.Infof("reloading %s by signal", r.name)
+
+	pids, err := r.findProcesses()
+	if err != nil {
+		glog.Errorf("finding %s processes failed, %v", r.name, err)
+		reloadSignals.WithLabelValues(r.name, "failed").Inc()
+		report(r.name, err)
+		return
+	}
+	if len(pids) == 0 {
+		glog.Errorf("no %s process found to reload, is the process namespace shared?", r.name)
+		reloadSignals.WithLabelValues(r.name, "not_found").Inc()
+		report(r.name, errors.New("no process found"))
+		return
+	}
+
+	for _, pid := range pids {
+		target := fmt.Sprintf("%s[%d]", r.name, pid)
+		if err := signalProcess(pid, syscall.SIGHUP); err != nil {
+			glog.Errorf("signalling %s process %d failed, %v", r.name, pid, err)
+			reloadSignals.WithLabelValues(r.name, "failed").Inc()
+			report(target, err)
+			continue
+		}
+		glog.Infof("sent SIGHUP to %s process %d", r.name, pid)
+		reloadSignals.WithLabelValues(r.name, "signalled").Inc()
+		report(target, nil)
+	}
+}
+
+// findProcesses returns the PIDs of the processes with the configured name,
+// other than the controller itself.
+func (r *signalReloader) findProcesses() ([]int, error) {
+	fis, err := ioutil.ReadDir(r.procDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	for _, fi := range fis {
+		pid, err := strconv.Atoi(fi.Name())
+		if err != nil || !fi.IsDir() || pid == os.Getpid() {
+			continue
+		}
+		if r.matches(filepath.Join(r.procDir, fi.Name())) {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// matches reports whether the process with the given proc directory has the
+// configured name. Processes that exit while being checked do not match.
+func (r *signalReloader) matches(dir string) bool {
+	if comm, err := ioutil.ReadFile(filepath.Join(dir, "comm")); err == nil {
+		if string(bytes.TrimSpace(comm)) == r.name {
+			return true
+		}
+	}
+	cmdline, err := ioutil.ReadFile(filepath.Join(dir, "cmdline"))
+	if err != nil || len(cmdline) == 0 {
+		return false
+	}
+	arg0 := string(bytes.SplitN(cmdline, []byte{0}, 2)[0])
+	return filepath.Base(arg0) == r.name
+}
+
+func signalProcess(pid int, sig os.Signal) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(sig)
+}
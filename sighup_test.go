@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSignalReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	child := exec.Command("sleep", "30")
+	if err := child.Start(); err != nil {
+		t.Skipf("could not start a process to signal, %v", err)
+	}
+	defer child.Process.Kill()
+
+	procs := map[int]struct{ comm, cmdline string }{
+		// Matched on the base name of its first argument.
+		child.Process.Pid: {"sleep", "/bin/prometheus\x00--config.file=x\x00"},
+		// The controller never signals itself.
+		os.Getpid(): {"prometheus", ""},
+		// Not matched.
+		999999: {"alertmanager", "alertmanager\x00"},
+	}
+	for pid, p := range procs {
+		pdir := filepath.Join(dir, strconv.Itoa(pid))
+		if err := os.Mkdir(pdir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		ioutil.WriteFile(filepath.Join(pdir, "comm"), []byte(p.comm+"\n"), 0644)
+		ioutil.WriteFile(filepath.Join(pdir, "cmdline"), []byte(p.cmdline), 0644)
+	}
+
+	r := &signalReloader{procDir: dir, name: "prometheus"}
+	pids, err := r.findProcesses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pids) != 1 || pids[0] != child.Process.Pid {
+		t.Fatalf("expected to find only %d, got %v", child.Process.Pid, pids)
+	}
+
+	before := testutil.ToFloat64(reloadSignals.WithLabelValues("prometheus", "signalled"))
+	r.Reload()
+	if after := testutil.ToFloat64(reloadSignals.WithLabelValues("prometheus", "signalled")); after != before+1 {
+		t.Errorf("expected one signal to be counted, got %v", after-before)
+	}
+
+	err = child.Wait()
+	if ee, ok := err.(*exec.ExitError); !ok || !strings.Contains(ee.Error(), syscall.SIGHUP.String()) {
+		t.Errorf("expected the process to exit on SIGHUP, got %v", err)
+	}
+
+	// Missing processes are reported.
+	r.name = "missing"
+	before = testutil.ToFloat64(reloadSignals.WithLabelValues("missing", "not_found"))
+	r.Reload()
+	if after := testutil.ToFloat64(reloadSignals.WithLabelValues("missing", "not_found")); after != before+1 {
+		t.Errorf("expected a missing process to be counted, got %v", after-before)
+	}
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	// Time zone data is embedded, as the controller image does not have it.
+	_ "time/tzdata"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	configV1beta1 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+// Reasons used in the Active condition of silences.
+const (
+	ReasonActive  = "Active"
+	ReasonPending = "Pending"
+	ReasonExpired = "Expired"
+)
+
+// AlertmanagerSilence is a silence in the alertmanager v2 API.
+type AlertmanagerSilence struct {
+	ID        string                `json:"id,omitempty"`
+	Matchers  []AlertmanagerMatcher `json:"matchers"`
+	StartsAt  time.Time             `json:"startsAt"`
+	EndsAt    time.Time             `json:"endsAt"`
+	CreatedBy string                `json:"createdBy"`
+	Comment   string                `json:"comment"`
+	Status    *struct {
+		State string `json:"state"`
+	} `json:"status,omitempty"`
+}
+
+// AlertmanagerMatcher is a label matcher of a silence.
+type AlertmanagerMatcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+	IsEqual bool   `json:"isEqual"`
+}
+
+// A Silencer manages the silences of alertmanager.
+type Silencer interface {
+	ListSilences(ctx context.Context) ([]AlertmanagerSilence, error)
+	// PutSilence creates a silence, and returns its ID.
+	PutSilence(ctx context.Context, s AlertmanagerSilence) (string, error)
+	ExpireSilence(ctx context.Context, id string) error
+}
+
+// silenceComment returns the comment of the alertmanager silences of the
+// silence with the given key. The comment identifies the silence that
+// alertmanager silences created by the controller belong to.
+func silenceComment(key, comment string) string {
+	return key + ": " + comment
+}
+
+// silenceKey returns the key of the silence an alertmanager silence belongs
+// to, or false if it was not created by the controller.
+func silenceKey(s AlertmanagerSilence) (string, bool) {
+	if s.CreatedBy != controllerAgentName {
+		return "", false
+	}
+	i := strings.Index(s.Comment, ": ")
+	if i < 0 {
+		return "", false
+	}
+	return s.Comment[:i], true
+}
+
+// silenceWindow returns the current window of the silence, or the next one
+// if it is not in place at now. False is returned if the silence has no
+// current or future window.
+func silenceWindow(spec configV1beta1.SilenceSpec, now time.Time) (time.Time, time.Time, bool, error) {
+	sched := spec.Schedule
+	switch {
+	case sched == nil && (spec.StartsAt == nil || spec.EndsAt == nil):
+		return time.Time{}, time.Time{}, false, errors.New("either startsAt and endsAt, or schedule, are required")
+	case sched != nil && (spec.StartsAt != nil || spec.EndsAt != nil):
+		return time.Time{}, time.Time{}, false, errors.New("startsAt and endsAt can not be used with schedule")
+	case sched == nil:
+		if !spec.EndsAt.After(spec.StartsAt.Time) {
+			return time.Time{}, time.Time{}, false, errors.New("endsAt must be after startsAt")
+		}
+		return spec.StartsAt.Time, spec.EndsAt.Time, spec.EndsAt.After(now), nil
+	}
+
+	loc, err := time.LoadLocation(sched.TimeZone)
+	if err != nil {
+		return time.Time{}, time.Time{}, false, errors.Wrap(err, "invalid timeZone")
+	}
+	start, err := time.Parse("15:04", sched.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, false, errors.Wrap(err, "invalid start")
+	}
+	end, err := time.Parse("15:04", sched.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, false, errors.Wrap(err, "invalid end")
+	}
+	if start.Equal(end) {
+		return time.Time{}, time.Time{}, false, errors.New("start and end must differ")
+	}
+
+	days := map[time.Weekday]bool{}
+	for _, d := range sched.Days {
+		wd, ok := weekdays[strings.ToLower(d)]
+		if !ok {
+			return time.Time{}, time.Time{}, false, fmt.Errorf("invalid day %q", d)
+		}
+		days[wd] = true
+	}
+
+	// Windows starting from the day before are checked, as a window may
+	// run overnight.
+	local := now.In(loc)
+	for offset := -1; offset <= 7; offset++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, loc)
+		if len(days) > 0 && !days[day.Weekday()] {
+			continue
+		}
+		ws := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, loc)
+		we := time.Date(day.Year(), day.Month(), day.Day(), end.Hour(), end.Minute(), 0, 0, loc)
+		if !we.After(ws) {
+			we = we.AddDate(0, 0, 1)
+		}
+		if we.After(now) {
+			return ws, we, true, nil
+		}
+	}
+	return time.Time{}, time.Time{}, false, nil
+}
+
+var weekdays = map[string]time.Weekday{}
+
+func init() {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		weekdays[strings.ToLower(d.String())] = d
+	}
+}
+
+// silenceMatchers converts the matchers of a silence, adding a matcher on its
+// namespace.
+func silenceMatchers(s *configV1beta1.Silence) ([]AlertmanagerMatcher, []error) {
+	var errs []error
+	ms := []AlertmanagerMatcher{{Name: alertRouteNamespaceLabel, Value: s.Namespace, IsEqual: true}}
+	for i, m := range s.Spec.Matchers {
+		merr := func(err error) {
+			errs = append(errs, errors.Wrapf(err, "matchers[%d]", i))
+		}
+		if !model.LabelName(m.Name).IsValid() {
+			merr(fmt.Errorf("invalid label name %q", m.Name))
+			continue
+		}
+		if m.Name == alertRouteNamespaceLabel {
+			if m.IsRegex || m.IsNotEqual || m.Value != s.Namespace {
+				merr(fmt.Errorf("can only match alerts from namespace %q", s.Namespace))
+			}
+			continue
+		}
+		if m.IsRegex {
+			if _, err := regexp.Compile("^(?:" + m.Value + ")$"); err != nil {
+				merr(errors.Wrap(err, "invalid regex"))
+				continue
+			}
+		}
+		ms = append(ms, AlertmanagerMatcher{Name: m.Name, Value: m.Value, IsRegex: m.IsRegex, IsEqual: !m.IsNotEqual})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	sortMatchers(ms)
+	return ms, nil
+}
+
+func sortMatchers(ms []AlertmanagerMatcher) {
+	sort.Slice(ms, func(i, j int) bool {
+		if ms[i].Name != ms[j].Name {
+			return ms[i].Name < ms[j].Name
+		}
+		return ms[i].Value < ms[j].Value
+	})
+}
+
+// desiredSilence returns the alertmanager silence that should be in place
+// for s at now, or nil if there should be none.
+func desiredSilence(key string, s *configV1beta1.Silence, now time.Time) (*AlertmanagerSilence, []error) {
+	ms, errs := silenceMatchers(s)
+	start, end, ok, err := silenceWindow(s.Spec, now)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 || !ok {
+		return nil, errs
+	}
+	return &AlertmanagerSilence{
+		Matchers:  ms,
+		StartsAt:  start,
+		EndsAt:    end,
+		CreatedBy: controllerAgentName,
+		Comment:   silenceComment(key, s.Spec.Comment),
+	}, nil
+}
+
+// sameSilence reports whether the existing silence a is in place of the
+// desired silence b. The start of a silence may have been moved by
+// alertmanager, so it is not compared.
+func sameSilence(a, b *AlertmanagerSilence) bool {
+	ams := append([]AlertmanagerMatcher(nil), a.Matchers...)
+	sortMatchers(ams)
+	return a.EndsAt.Equal(b.EndsAt) && a.Comment == b.Comment && reflect.DeepEqual(ams, b.Matchers)
+}
+
+// syncSilenceHandler reconciles every silence, and expires alertmanager
+// silences created by the controller for silences that no longer exist.
+func (c *Controller) syncSilenceHandler() error {
+	if c.Silencer == nil {
+		return nil
+	}
+
+	ss, err := c.silencesLister.Silences(c.Namespace).List(c.Selector)
+	if err != nil {
+		return errors.Wrap(err, "listing silences")
+	}
+
+	seen := map[string]bool{}
+	for _, s := range ss {
+		var key string
+		if key, err = cache.MetaNamespaceKeyFunc(s); err != nil {
+			runtime.HandleError(err)
+			continue
+		}
+		seen[key] = true
+		if err := c.syncSilence(key); err != nil {
+			glog.Infof("syncing silence %s failed, %v", key, err)
+		}
+	}
+
+	ctx := context.TODO()
+	existing, err := c.Silencer.ListSilences(ctx)
+	if err != nil {
+		return errors.Wrap(err, "listing alertmanager silences")
+	}
+	for _, as := range existing {
+		key, ok := silenceKey(as)
+		if !ok || seen[key] || as.Status == nil || as.Status.State == "expired" {
+			continue
+		}
+		glog.Infof("expiring silence %s of deleted silence %s", as.ID, key)
+		if err := c.Silencer.ExpireSilence(ctx, as.ID); err != nil {
+			return errors.Wrapf(err, "expiring silence %s", as.ID)
+		}
+	}
+	return nil
+}
+
+// syncSilence puts the alertmanager silence for the current or next window of
+// the silence with the given key in place, expiring any others. The silence
+// is synced again when its window starts or ends.
+func (c *Controller) syncSilence(key string) error {
+	ns, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+
+	now := c.now()
+	var desired *AlertmanagerSilence
+	var errs []error
+	s, err := c.silencesLister.Silences(ns).Get(name)
+	switch {
+	case kerrors.IsNotFound(err):
+		s = nil
+		c.events.forget(eventKind(&configV1beta1.Silence{}) + "/" + key)
+	case err != nil:
+		return err
+	case !c.selects(s):
+		s = nil
+	default:
+		desired, errs = desiredSilence(key, s, now)
+	}
+
+	ctx := context.TODO()
+	existing, err := c.Silencer.ListSilences(ctx)
+	if err != nil {
+		return errors.Wrap(err, "listing alertmanager silences")
+	}
+
+	var current *AlertmanagerSilence
+	for i := range existing {
+		as := &existing[i]
+		if k, ok := silenceKey(*as); !ok || k != key || as.Status == nil || as.Status.State == "expired" {
+			continue
+		}
+		if current == nil && desired != nil && sameSilence(as, desired) {
+			current = as
+			continue
+		}
+		glog.Infof("expiring silence %s of %s", as.ID, key)
+		if err := c.Silencer.ExpireSilence(ctx, as.ID); err != nil {
+			return errors.Wrapf(err, "expiring silence %s", as.ID)
+		}
+	}
+
+	if desired != nil && current == nil {
+		glog.Infof("creating silence of %s from %v to %v", key, desired.StartsAt, desired.EndsAt)
+		if desired.ID, err = c.Silencer.PutSilence(ctx, *desired); err != nil {
+			return errors.Wrapf(err, "creating silence of %s", key)
+		}
+		current = desired
+	}
+
+	if s == nil {
+		return nil
+	}
+
+	if err := c.updatesilencestatus(s, current, now, errs); err != nil {
+		glog.Infof("updating status of %s failed, %v", key, err)
+	}
+	state := renderedCurrent
+	if len(errs) > 0 {
+		state = notRendered
+	}
+	c.recordSyncEvent(s, state, errs)
+
+	if current != nil {
+		next := current.EndsAt
+		if now.Before(current.StartsAt) {
+			next = current.StartsAt
+		}
+		c.silencesWorkqueue.AddAfter(key, next.Sub(now))
+	}
+	return nil
+}
+
+func (c *Controller) updatesilencestatus(org *configV1beta1.Silence, current *AlertmanagerSilence, now time.Time, errs []error) error {
+	ctx := context.Background()
+	var err error
+	s := org.DeepCopy()
+
+	s.Status.Errors = nil
+	for _, err := range errs {
+		s.Status.Errors = append(s.Status.Errors, err.Error())
+	}
+	s.Status.ErrorCount = len(s.Status.Errors)
+	s.Status.ObservedGeneration = s.Generation
+
+	s.Status.SilenceID = ""
+	s.Status.StartsAt = nil
+	s.Status.EndsAt = nil
+	if current != nil {
+		starts := metav1.NewTime(current.StartsAt)
+		ends := metav1.NewTime(current.EndsAt)
+		s.Status.SilenceID = current.ID
+		s.Status.StartsAt = &starts
+		s.Status.EndsAt = &ends
+	}
+
+	set := func(typ string, status metav1.ConditionStatus, reason, msg string) {
+		meta.SetStatusCondition(&s.Status.Conditions, metav1.Condition{
+			Type:               typ,
+			Status:             status,
+			ObservedGeneration: s.Generation,
+			LastTransitionTime: metav1.NewTime(now),
+			Reason:             reason,
+			Message:            msg,
+		})
+	}
+	if len(errs) == 0 {
+		set(configV1beta1.ConditionValid, metav1.ConditionTrue, ReasonValid, "")
+	} else {
+		set(configV1beta1.ConditionValid, metav1.ConditionFalse, ReasonInvalid, strings.Join(s.Status.Errors, "; "))
+	}
+	switch {
+	case current == nil && len(errs) > 0:
+		set(configV1beta1.ConditionActive, metav1.ConditionFalse, ReasonInvalid, "")
+	case current == nil:
+		set(configV1beta1.ConditionActive, metav1.ConditionFalse, ReasonExpired, "the silence has no future windows")
+	case now.Before(current.StartsAt):
+		set(configV1beta1.ConditionActive, metav1.ConditionFalse, ReasonPending, "")
+	default:
+		set(configV1beta1.ConditionActive, metav1.ConditionTrue, ReasonActive, "")
+	}
+
+	if !reflect.DeepEqual(org.Status, s.Status) {
+		_, err = c.confclientset.ConfigV1beta1().Silences(s.Namespace).UpdateStatus(ctx, s, metav1.UpdateOptions{})
+	}
+
+	return err
+}
+
+func (c *Controller) enqueuesilence(obj interface{}) {
+	var key string
+	var err error
+	if key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	c.silencesWorkqueue.AddRateLimited(key)
+}
+
+func (c *Controller) runSilencesWorker() {
+	processSilence := makeProcessNextWorkItem(c.silencesWorkqueue, c.syncSilence)
+	for processSilence() {
+	}
+
+	glog.Info("silences worker stopped")
+}
+
+// amSilencer manages silences using the alertmanager v2 API. Alertmanager
+// replicates silences between the members of a cluster, so each request is
+// only made to the first target that answers.
+type amSilencer struct {
+	client  *http.Client
+	targets func() []*url.URL
+}
+
+func (a *amSilencer) ListSilences(ctx context.Context) ([]AlertmanagerSilence, error) {
+	var res []AlertmanagerSilence
+	err := a.do(ctx, http.MethodGet, "/api/v2/silences", nil, &res)
+	return res, err
+}
+
+func (a *amSilencer) PutSilence(ctx context.Context, s AlertmanagerSilence) (string, error) {
+	res := struct {
+		SilenceID string `json:"silenceID"`
+	}{}
+	err := a.do(ctx, http.MethodPost, "/api/v2/silences", s, &res)
+	return res.SilenceID, err
+}
+
+func (a *amSilencer) ExpireSilence(ctx context.Context, id string) error {
+	return a.do(ctx, http.MethodDelete, "/api/v2/silence/"+url.PathEscape(id), nil, nil)
+}
+
+func (a *amSilencer) do(ctx context.Context, method, apiPath string, body, data interface{}) error {
+	var bs []byte
+	if body != nil {
+		var err error
+		if bs, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	targets := a.targets()
+	if len(targets) == 0 {
+		return errors.New("no alertmanagers to send silences to")
+	}
+	var errs []string
+	for _, base := range targets {
+		u := *base
+		u.Path = path.Join(u.Path, apiPath)
+		req, err := http.NewRequest(method, u.String(), bytes.NewReader(bs))
+		if err != nil {
+			return err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		res, err := a.client.Do(req.WithContext(ctx))
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		err = checkResponse(res)
+		if err == nil && data != nil {
+			err = errors.Wrapf(json.NewDecoder(res.Body).Decode(data), "decoding %s response", apiPath)
+		}
+		res.Body.Close()
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("alertmanager request failed, %s", strings.Join(errs, "; "))
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	conf "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+)
+
+// fakeSilencer keeps silences in memory.
+type fakeSilencer struct {
+	silences []AlertmanagerSilence
+	puts     int
+}
+
+func (f *fakeSilencer) ListSilences(ctx context.Context) ([]AlertmanagerSilence, error) {
+	return append([]AlertmanagerSilence(nil), f.silences...), nil
+}
+
+func (f *fakeSilencer) PutSilence(ctx context.Context, s AlertmanagerSilence) (string, error) {
+	f.puts++
+	s.ID = fmt.Sprintf("%d", len(f.silences))
+	s.Status = &struct {
+		State string `json:"state"`
+	}{"active"}
+	f.silences = append(f.silences, s)
+	return s.ID, nil
+}
+
+func (f *fakeSilencer) ExpireSilence(ctx context.Context, id string) error {
+	for i := range f.silences {
+		if f.silences[i].ID == id {
+			f.silences[i].Status.State = "expired"
+		}
+	}
+	return nil
+}
+
+func (f *fakeSilencer) active() []AlertmanagerSilence {
+	var res []AlertmanagerSilence
+	for _, s := range f.silences {
+		if s.Status.State != "expired" {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func TestSilenceWindow(t *testing.T) {
+	// A Wednesday.
+	now := time.Date(2022, 3, 2, 12, 0, 0, 0, time.UTC)
+	at := func(day, hour int) time.Time {
+		return time.Date(2022, 3, day, hour, 0, 0, 0, time.UTC)
+	}
+	mt := func(t time.Time) *metav1.Time {
+		m := metav1.NewTime(t)
+		return &m
+	}
+
+	tests := []struct {
+		name       string
+		spec       conf.SilenceSpec
+		start, end time.Time
+		ok         bool
+		err        bool
+	}{
+		{
+			name:  "fixed",
+			spec:  conf.SilenceSpec{StartsAt: mt(at(1, 0)), EndsAt: mt(at(3, 0))},
+			start: at(1, 0), end: at(3, 0), ok: true,
+		},
+		{
+			name: "fixed, ended",
+			spec: conf.SilenceSpec{StartsAt: mt(at(1, 0)), EndsAt: mt(at(2, 0))},
+			ok:   false,
+		},
+		{
+			name:  "overnight, current",
+			spec:  conf.SilenceSpec{Schedule: &conf.SilenceSchedule{Start: "11:00", End: "09:00"}},
+			start: at(2, 11), end: at(3, 9), ok: true,
+		},
+		{
+			name:  "weekends, next",
+			spec:  conf.SilenceSpec{Schedule: &conf.SilenceSchedule{Days: []string{"Saturday", "sunday"}, Start: "00:00", End: "23:59"}},
+			start: at(5, 0), end: time.Date(2022, 3, 5, 23, 59, 0, 0, time.UTC), ok: true,
+		},
+		{
+			name:  "time zone",
+			spec:  conf.SilenceSpec{Schedule: &conf.SilenceSchedule{Start: "13:00", End: "14:00", TimeZone: "Europe/Paris"}},
+			start: at(2, 12), end: at(2, 13), ok: true,
+		},
+		{
+			name: "unknown day",
+			spec: conf.SilenceSpec{Schedule: &conf.SilenceSchedule{Days: []string{"Someday"}, Start: "00:00", End: "01:00"}},
+			err:  true,
+		},
+		{
+			name: "no window",
+			spec: conf.SilenceSpec{},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, ok, err := silenceWindow(tt.spec, now)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if ok != tt.ok || (ok && (!start.Equal(tt.start) || !end.Equal(tt.end))) {
+				t.Errorf("expected window %v - %v (%v), got %v - %v (%v)", tt.start, tt.end, tt.ok, start, end, ok)
+			}
+		})
+	}
+}
+
+func TestSyncSilence(t *testing.T) {
+	f := newFixture(t)
+	s := &conf.Silence{
+		TypeMeta:   metav1.TypeMeta{APIVersion: conf.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Name: "ooh", Namespace: metav1.NamespaceDefault},
+		Spec: conf.SilenceSpec{
+			Matchers: []conf.SilenceMatcher{{Name: "severity", Value: "warning"}},
+			Comment:  "out of hours",
+			Schedule: &conf.SilenceSchedule{Start: "18:00", End: "08:00"},
+		},
+	}
+	f.objects = append(f.objects, s)
+
+	c, i, _ := f.newController()
+	silencer := &fakeSilencer{}
+	c.Silencer = silencer
+	c.silencesLister = i.Config().V1beta1().Silences().Lister()
+	indexer := i.Config().V1beta1().Silences().Informer().GetIndexer()
+	indexer.Add(s)
+
+	// testNow is midnight, so the window is in place.
+	if err := c.syncSilenceHandler(); err != nil {
+		t.Fatalf("sync failed, %v", err)
+	}
+	active := silencer.active()
+	if len(active) != 1 {
+		t.Fatalf("expected one silence, got %v", active)
+	}
+	exp := []AlertmanagerMatcher{
+		{Name: "namespace", Value: "default", IsEqual: true},
+		{Name: "severity", Value: "warning", IsEqual: true},
+	}
+	if fmt.Sprint(active[0].Matchers) != fmt.Sprint(exp) {
+		t.Errorf("expected matchers %v, got %v", exp, active[0].Matchers)
+	}
+	if active[0].Comment != "default/ooh: out of hours" {
+		t.Errorf("unexpected comment %q", active[0].Comment)
+	}
+
+	got, err := f.client.ConfigV1beta1().Silences("default").Get(context.Background(), "ooh", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting silence failed, %v", err)
+	}
+	if got.Status.SilenceID != active[0].ID || got.Status.EndsAt == nil || !got.Status.EndsAt.Time.Equal(testNow.Add(8*time.Hour)) {
+		t.Errorf("expected status to record the silence, got %+v", got.Status)
+	}
+	if cond := meta.FindStatusCondition(got.Status.Conditions, conf.ConditionActive); cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Errorf("expected silence to be active, got %v", cond)
+	}
+
+	// Unchanged silences are left in place.
+	if err := c.syncSilence("default/ooh"); err != nil {
+		t.Fatalf("sync failed, %v", err)
+	}
+	if silencer.puts != 1 {
+		t.Errorf("expected the silence to be left in place, got %d puts", silencer.puts)
+	}
+
+	// Changed silences are replaced.
+	ns := s.DeepCopy()
+	ns.Spec.Schedule.End = "09:00"
+	indexer.Update(ns)
+	if err := c.syncSilence("default/ooh"); err != nil {
+		t.Fatalf("sync failed, %v", err)
+	}
+	if active = silencer.active(); len(active) != 1 || active[0].ID == got.Status.SilenceID {
+		t.Errorf("expected the silence to be replaced, got %v", active)
+	}
+
+	// Silences of deleted resources are expired.
+	indexer.Delete(ns)
+	if err := c.syncSilenceHandler(); err != nil {
+		t.Fatalf("sync failed, %v", err)
+	}
+	if active = silencer.active(); len(active) != 0 {
+		t.Errorf("expected the silence to be expired, got %v", active)
+	}
+}
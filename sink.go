@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	yaml "gopkg.in/yaml.v2"
+	"k8s.io/client-go/tools/cache"
+)
+
+// A RulesSink is sent the rendered rule groups, given in key order, each
+// time the rules are rendered. Sinks are updated in addition to the rules
+// ConfigMap and files, and changes to them do not cause prometheus to be
+// reloaded.
+type RulesSink interface {
+	UpdateRules(ctx context.Context, keys []string, groups []rulefmt.RuleGroup) error
+}
+
+// renderSinksKey is the render workqueue key of the rules sinks. They are
+// updated separately from the rules ConfigMap and files, so that a failing
+// sink is retried without holding up prometheus.
+const renderSinksKey = "sinks"
+
+// updateRulesSinks sends the rule groups in the rules model to every sink.
+func (c *Controller) updateRulesSinks() error {
+	keys, groups := c.rules.sorted()
+	var errs []string
+	for _, sink := range c.RulesSinks {
+		if err := sink.UpdateRules(context.TODO(), keys, groups); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("updating rules sinks failed, %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// rulerSink pushes rule groups to the ruler API of Cortex, Mimir or Loki.
+// Each rule group is stored in the ruler namespace named after its kubernetes
+// namespace, with namespacePrefix prepended. The sink owns every rule group
+// of the tenant in namespaces starting with namespacePrefix, and deletes any
+// that it has not been given, so namespacePrefix must not be empty.
+type rulerSink struct {
+	client *http.Client
+	// url is the base URL of the ruler API, including the path of the
+	// rules endpoint, e.g. http://mimir/prometheus/config/v1/rules.
+	url             *url.URL
+	tenant          string
+	namespacePrefix string
+}
+
+// UpdateRules creates or updates the rule groups that have changed, and
+// deletes those that are no longer rendered.
+func (s *rulerSink) UpdateRules(ctx context.Context, keys []string, groups []rulefmt.RuleGroup) error {
+	current, err := s.list(ctx)
+	if err != nil {
+		return errors.Wrap(err, "listing ruler rule groups")
+	}
+
+	var errs []string
+	desired := map[string]map[string]rulefmt.RuleGroup{}
+	for i, g := range groups {
+		ns, _, err := cache.SplitMetaNamespaceKey(keys[i])
+		if err != nil {
+			return err
+		}
+		ns = s.namespacePrefix + ns
+		if desired[ns] == nil {
+			desired[ns] = map[string]rulefmt.RuleGroup{}
+		}
+		// The ruler identifies groups by name, so only the first of
+		// several with the same name is pushed.
+		if _, ok := desired[ns][g.Name]; ok {
+			errs = append(errs, fmt.Sprintf("rule group %s/%s of %s has the same name as an earlier group", ns, g.Name, keys[i]))
+			continue
+		}
+		desired[ns][g.Name] = g
+	}
+
+	for _, ns := range sortedNamespaces(desired) {
+		existing := map[string]rulefmt.RuleGroup{}
+		for _, g := range current[ns] {
+			existing[g.Name] = g
+		}
+		for _, name := range sortedGroupNames(desired[ns]) {
+			g := desired[ns][name]
+			if old, ok := existing[name]; ok && sameRuleGroup(old, g) {
+				continue
+			}
+			glog.Infof("ruler rule group %s/%s changed, updating", ns, name)
+			if err := s.set(ctx, ns, g); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+
+	for ns, gs := range current {
+		if !strings.HasPrefix(ns, s.namespacePrefix) {
+			continue
+		}
+		for _, g := range gs {
+			if _, ok := desired[ns][g.Name]; ok {
+				continue
+			}
+			glog.Infof("deleting stale ruler rule group %s/%s", ns, g.Name)
+			if err := s.delete(ctx, ns, g.Name); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("updating ruler failed, %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// list returns the rule groups of the tenant, by namespace.
+func (s *rulerSink) list(ctx context.Context) (map[string][]rulefmt.RuleGroup, error) {
+	res, err := s.do(ctx, http.MethodGet, s.url.Path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	// The ruler responds with not found when the tenant has no rules.
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err = checkResponse(res); err != nil {
+		return nil, err
+	}
+
+	groups := map[string][]rulefmt.RuleGroup{}
+	if err = yaml.NewDecoder(res.Body).Decode(&groups); err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "decoding rule groups")
+	}
+	return groups, nil
+}
+
+func (s *rulerSink) set(ctx context.Context, ns string, g rulefmt.RuleGroup) error {
+	bs, err := yaml.Marshal(g)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(ctx, http.MethodPost, path.Join(s.url.Path, url.PathEscape(ns)), bs)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return errors.Wrapf(checkResponse(res), "setting rule group %s/%s", ns, g.Name)
+}
+
+func (s *rulerSink) delete(ctx context.Context, ns, name string) error {
+	res, err := s.do(ctx, http.MethodDelete, path.Join(s.url.Path, url.PathEscape(ns), url.PathEscape(name)), nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return errors.Wrapf(checkResponse(res), "deleting rule group %s/%s", ns, name)
+}
+
+func (s *rulerSink) do(ctx context.Context, method, escapedPath string, body []byte) (*http.Response, error) {
+	u := *s.url
+	u.RawPath = escapedPath
+	u.Path, _ = url.PathUnescape(escapedPath)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/yaml")
+	}
+	if s.tenant != "" {
+		req.Header.Set("X-Scope-OrgID", s.tenant)
+	}
+	return s.client.Do(req.WithContext(ctx))
+}
+
+func checkResponse(res *http.Response) error {
+	if res.StatusCode/100 == 2 {
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("request to %s failed, %s: %s", res.Request.URL, res.Status, strings.TrimSpace(string(msg)))
+}
+
+func sameRuleGroup(a, b rulefmt.RuleGroup) bool {
+	abs, aerr := yaml.Marshal(a)
+	bbs, berr := yaml.Marshal(b)
+	return aerr == nil && berr == nil && bytes.Equal(abs, bbs)
+}
+
+func sortedNamespaces(m map[string]map[string]rulefmt.RuleGroup) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedGroupNames(m map[string]rulefmt.RuleGroup) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
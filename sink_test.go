@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// stubRuler implements the ruler API for a single tenant.
+type stubRuler struct {
+	sync.Mutex
+	tenant string
+	groups map[string]map[string]rulefmt.RuleGroup
+	writes []string
+}
+
+func (s *stubRuler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	if r.Header.Get("X-Scope-OrgID") != s.tenant {
+		http.Error(w, "no org id", http.StatusUnauthorized)
+		return
+	}
+
+	var parts []string
+	for _, p := range strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/api/v1/rules"), "/") {
+		if p == "" {
+			continue
+		}
+		up, err := url.PathUnescape(p)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		parts = append(parts, up)
+	}
+
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 0:
+		if len(s.groups) == 0 {
+			http.Error(w, "no rule groups found", http.StatusNotFound)
+			return
+		}
+		res := map[string][]rulefmt.RuleGroup{}
+		for ns, gs := range s.groups {
+			for _, g := range gs {
+				res[ns] = append(res[ns], g)
+			}
+		}
+		bs, _ := yaml.Marshal(res)
+		w.Write(bs)
+	case r.Method == http.MethodPost && len(parts) == 1:
+		bs, _ := ioutil.ReadAll(r.Body)
+		g := rulefmt.RuleGroup{}
+		if err := yaml.UnmarshalStrict(bs, &g); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if s.groups[parts[0]] == nil {
+			s.groups[parts[0]] = map[string]rulefmt.RuleGroup{}
+		}
+		s.groups[parts[0]][g.Name] = g
+		s.writes = append(s.writes, "set "+parts[0]+" "+g.Name)
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodDelete && len(parts) == 2:
+		delete(s.groups[parts[0]], parts[1])
+		if len(s.groups[parts[0]]) == 0 {
+			delete(s.groups, parts[0])
+		}
+		s.writes = append(s.writes, "delete "+parts[0]+" "+parts[1])
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func (s *stubRuler) takeWrites() []string {
+	s.Lock()
+	defer s.Unlock()
+	ws := s.writes
+	s.writes = nil
+	sort.Strings(ws)
+	return ws
+}
+
+func TestRulerSink(t *testing.T) {
+	ruler := &stubRuler{
+		tenant: "team",
+		groups: map[string]map[string]rulefmt.RuleGroup{
+			// Rule groups outside the prefix are left alone.
+			"other": {"other": {Name: "other", Rules: []rulefmt.Rule{{Record: "x", Expr: "1"}}}},
+		},
+	}
+	srv := httptest.NewServer(ruler)
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL + "/api/v1/rules")
+	sink := &rulerSink{client: srv.Client(), url: u, tenant: "team", namespacePrefix: "k8s-"}
+	ctx := context.Background()
+
+	keys, groups := testShardGroups()
+	if err := sink.UpdateRules(ctx, keys, groups); err != nil {
+		t.Fatalf("updating ruler failed, %v", err)
+	}
+	exp := []string{"set k8s-a a/one", "set k8s-a a/two", "set k8s-b b/one"}
+	if got := ruler.takeWrites(); !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected writes %v, got %v", exp, got)
+	}
+
+	if err := sink.UpdateRules(ctx, keys, groups); err != nil {
+		t.Fatalf("updating ruler failed, %v", err)
+	}
+	if got := ruler.takeWrites(); len(got) != 0 {
+		t.Errorf("expected no writes for unchanged rules, got %v", got)
+	}
+
+	groups[0].Rules[0].Expr = "2 + 2"
+	if err := sink.UpdateRules(ctx, keys[:1], groups[:1]); err != nil {
+		t.Fatalf("updating ruler failed, %v", err)
+	}
+	exp = []string{"delete k8s-a a/two", "delete k8s-b b/one", "set k8s-a a/one"}
+	if got := ruler.takeWrites(); !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected writes %v, got %v", exp, got)
+	}
+
+	if _, ok := ruler.groups["other"]["other"]; !ok {
+		t.Errorf("expected rule groups outside the prefix to be kept")
+	}
+}
+
+func TestRulerSinkDuplicateGroups(t *testing.T) {
+	ruler := &stubRuler{tenant: "team", groups: map[string]map[string]rulefmt.RuleGroup{}}
+	srv := httptest.NewServer(ruler)
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL + "/api/v1/rules")
+	sink := &rulerSink{client: srv.Client(), url: u, tenant: "team", namespacePrefix: "k8s-"}
+
+	keys, groups := testShardGroups()
+	keys = append(keys, "a/dup")
+	groups = append(groups, groups[0])
+	err := sink.UpdateRules(context.Background(), keys, groups)
+	if err == nil || !strings.Contains(err.Error(), "k8s-a/a/one of a/dup") {
+		t.Errorf("expected an error for the duplicate group, got %v", err)
+	}
+	exp := []string{"set k8s-a a/one", "set k8s-a a/two", "set k8s-b b/one"}
+	if got := ruler.takeWrites(); !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected writes %v, got %v", exp, got)
+	}
+}
+
+// failingSink is a RulesSink that always fails.
+type failingSink struct{}
+
+func (failingSink) UpdateRules(ctx context.Context, keys []string, groups []rulefmt.RuleGroup) error {
+	return errors.New("ruler unavailable")
+}
+
+func TestFailingSinkStillReloads(t *testing.T) {
+	f := newFixture(t)
+	rg := newRuleGroup("test", testGroup)
+	f.objects = append(f.objects, rg)
+	c, _, _ := f.newController()
+	c.RulesSinks = []RulesSink{failingSink{}}
+	c.reconcileRuleGroup("default/test", rg)
+
+	// The rules are written and prometheus reloaded despite the sink.
+	if err := c.render(renderRulesKey); err != nil {
+		t.Fatalf("render failed, %v", err)
+	}
+	if !c.Reloader.(*testReloader).state {
+		t.Errorf("expected prometheus to be reloaded")
+	}
+
+	// The sink is updated, and retried, on its own.
+	if l := c.renderWorkqueue.Len(); l != 1 {
+		t.Fatalf("expected one queued render, got %d", l)
+	}
+	key, _ := c.renderWorkqueue.Get()
+	c.renderWorkqueue.Done(key)
+	if key != renderSinksKey {
+		t.Fatalf("expected sinks to be queued, got %v", key)
+	}
+	if err := c.render(renderSinksKey); err == nil || !strings.Contains(err.Error(), "ruler unavailable") {
+		t.Errorf("expected sink error, got %v", err)
+	}
+}
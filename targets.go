@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Kinds of reload target.
+const (
+	// TargetEndpoints reloads the addresses of an Endpoints object.
+	TargetEndpoints = "endpoints"
+	// TargetEndpointSlices reloads the addresses of the EndpointSlices of
+	// a service.
+	TargetEndpointSlices = "endpointslices"
+	// TargetPods reloads the pods matching a label selector.
+	TargetPods = "pods"
+)
+
+// reloadTarget is a set of servers to reload, discovered from the
+// kubernetes API.
+type reloadTarget struct {
+	kind      string
+	namespace string
+	// name is the name of the Endpoints object or service.
+	name     string
+	selector labels.Selector
+	// port is a port number, or the name of a port of the endpoints or of
+	// a container of the pods.
+	port string
+	// notReady includes the addresses of servers that are not ready.
+	notReady bool
+}
+
+// parseReloadTarget parses a reload target given as
+// kind:namespace/name:port[:notready], where kind is endpoints,
+// endpointslices or pods. The name of a pods target is a label selector.
+func parseReloadTarget(s string) (reloadTarget, error) {
+	t := reloadTarget{}
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return t, fmt.Errorf("invalid reload target %q, expected kind:namespace/name:port[:notready]", s)
+	}
+	t.kind, s = parts[0], parts[1]
+
+	if strings.HasSuffix(s, ":notready") {
+		t.notReady = true
+		s = strings.TrimSuffix(s, ":notready")
+	}
+
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return t, fmt.Errorf("invalid reload target %q, no port given", s)
+	}
+	t.port, s = s[i+1:], s[:i]
+	if t.port == "" {
+		return t, fmt.Errorf("invalid reload target %q, no port given", s)
+	}
+
+	parts = strings.SplitN(s, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return t, fmt.Errorf("invalid reload target %q, expected namespace/name", s)
+	}
+	t.namespace = parts[0]
+
+	switch t.kind {
+	case TargetEndpoints, TargetEndpointSlices:
+		t.name = parts[1]
+	case TargetPods:
+		sel, err := labels.Parse(parts[1])
+		if err != nil {
+			return t, errors.Wrap(err, "invalid reload target selector")
+		}
+		t.selector = sel
+	default:
+		return t, fmt.Errorf("unknown reload target kind %q", t.kind)
+	}
+	return t, nil
+}
+
+func (t reloadTarget) String() string {
+	name := t.name
+	if t.selector != nil {
+		name = t.selector.String()
+	}
+	s := fmt.Sprintf("%s:%s/%s:%s", t.kind, t.namespace, name, t.port)
+	if t.notReady {
+		s += ":notready"
+	}
+	return s
+}
+
+// discover returns the host:port of each server of the target.
+func (t reloadTarget) discover(ctx context.Context, client kubernetes.Interface) ([]string, error) {
+	switch t.kind {
+	case TargetEndpoints:
+		return t.discoverEndpoints(ctx, client)
+	case TargetEndpointSlices:
+		return t.discoverEndpointSlices(ctx, client)
+	case TargetPods:
+		return t.discoverPods(ctx, client)
+	}
+	return nil, fmt.Errorf("unknown reload target kind %q", t.kind)
+}
+
+func (t reloadTarget) discoverEndpoints(ctx context.Context, client kubernetes.Interface) ([]string, error) {
+	eps, err := client.CoreV1().Endpoints(t.namespace).Get(ctx, t.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+	for _, ss := range eps.Subsets {
+		port, ok := t.resolvePort(func(name string) (int32, bool) {
+			for _, p := range ss.Ports {
+				if p.Name == name {
+					return p.Port, true
+				}
+			}
+			return 0, false
+		})
+		if !ok {
+			continue
+		}
+		addrs := ss.Addresses
+		if t.notReady {
+			addrs = append(addrs[:len(addrs):len(addrs)], ss.NotReadyAddresses...)
+		}
+		for _, addr := range addrs {
+			hosts = append(hosts, net.JoinHostPort(addr.IP, port))
+		}
+	}
+	return hosts, nil
+}
+
+func (t reloadTarget) discoverEndpointSlices(ctx context.Context, client kubernetes.Interface) ([]string, error) {
+	sel := labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: t.name})
+	slices, err := client.DiscoveryV1().EndpointSlices(t.namespace).List(ctx, metav1.ListOptions{LabelSelector: sel.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+	for _, slice := range slices.Items {
+		port, ok := t.resolvePort(func(name string) (int32, bool) {
+			for _, p := range slice.Ports {
+				if p.Name != nil && *p.Name == name && p.Port != nil {
+					return *p.Port, true
+				}
+			}
+			return 0, false
+		})
+		if !ok {
+			continue
+		}
+		for _, ep := range slice.Endpoints {
+			// A nil ready condition is to be taken as ready.
+			ready := ep.Conditions.Ready == nil || *ep.Conditions.Ready
+			if len(ep.Addresses) == 0 || (!ready && !t.notReady) {
+				continue
+			}
+			hosts = append(hosts, net.JoinHostPort(ep.Addresses[0], port))
+		}
+	}
+	return hosts, nil
+}
+
+func (t reloadTarget) discoverPods(ctx context.Context, client kubernetes.Interface) ([]string, error) {
+	pods, err := client.CoreV1().Pods(t.namespace).List(ctx, metav1.ListOptions{LabelSelector: t.selector.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+	for _, pod := range pods.Items {
+		if pod.Status.PodIP == "" || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		if !t.notReady && !podReady(&pod) {
+			continue
+		}
+		port, ok := t.resolvePort(func(name string) (int32, bool) {
+			for _, c := range pod.Spec.Containers {
+				for _, p := range c.Ports {
+					if p.Name == name {
+						return p.ContainerPort, true
+					}
+				}
+			}
+			return 0, false
+		})
+		if !ok {
+			continue
+		}
+		hosts = append(hosts, net.JoinHostPort(pod.Status.PodIP, port))
+	}
+	return hosts, nil
+}
+
+// resolvePort returns the port of the target, looking up named ports with
+// lookup.
+func (t reloadTarget) resolvePort(lookup func(name string) (int32, bool)) (string, bool) {
+	if _, err := strconv.Atoi(t.port); err == nil {
+		return t.port, true
+	}
+	p, ok := lookup(t.port)
+	if !ok {
+		return "", false
+	}
+	return strconv.Itoa(int(p)), true
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// reloadTargetsFlag is a flag that can be given several times, each time
+// adding a reload target.
+type reloadTargetsFlag []reloadTarget
+
+func (f *reloadTargetsFlag) String() string {
+	var ss []string
+	for _, t := range *f {
+		ss = append(ss, t.String())
+	}
+	return strings.Join(ss, ",")
+}
+
+func (f *reloadTargetsFlag) Set(s string) error {
+	t, err := parseReloadTarget(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, t)
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseReloadTarget(t *testing.T) {
+	tests := []struct {
+		in  string
+		exp string
+		err bool
+	}{
+		{in: "endpoints:infra/prometheus:9090", exp: "endpoints:infra/prometheus:9090"},
+		{in: "endpointslices:infra/prometheus:web:notready", exp: "endpointslices:infra/prometheus:web:notready"},
+		{in: "pods:infra/app.kubernetes.io/name=prometheus,shard in (a,b):web", exp: "pods:infra/app.kubernetes.io/name=prometheus,shard in (a,b):web"},
+		{in: "services:infra/prometheus:9090", err: true},
+		{in: "endpoints:prometheus:9090", err: true},
+		{in: "endpoints:infra/prometheus", err: true},
+		{in: "pods:infra/app in x:9090", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseReloadTarget(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: expected error %v, got %v", tt.in, tt.err, err)
+			continue
+		}
+		if err == nil && got.String() != tt.exp {
+			t.Errorf("%s: expected %s, got %s", tt.in, tt.exp, got)
+		}
+	}
+}
+
+func TestDiscoverReloadTargets(t *testing.T) {
+	ready, notReady := true, false
+	web, metrics := "web", "metrics"
+	webPort, metricsPort := int32(9090), int32(8080)
+
+	pod := func(name, ip string, isReady bool) *corev1.Pod {
+		status := corev1.ConditionFalse
+		if isReady {
+			status = corev1.ConditionTrue
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "infra", Labels: map[string]string{"app": "prometheus"}},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:  "prometheus",
+				Ports: []corev1.ContainerPort{{Name: "web", ContainerPort: 9090}},
+			}}},
+			Status: corev1.PodStatus{
+				Phase:      corev1.PodRunning,
+				PodIP:      ip,
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+			},
+		}
+	}
+
+	objs := []runtime.Object{
+		pod("prometheus-0", "10.0.0.1", true),
+		pod("prometheus-1", "10.0.0.2", false),
+		&corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "prometheus", Namespace: "infra"},
+			Subsets: []corev1.EndpointSubset{{
+				Addresses:         []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+				NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.2"}},
+				Ports:             []corev1.EndpointPort{{Name: "web", Port: 9090}},
+			}},
+		},
+		&discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "prometheus-abcde",
+				Namespace: "infra",
+				Labels:    map[string]string{discoveryv1.LabelServiceName: "prometheus"},
+			},
+			Ports: []discoveryv1.EndpointPort{{Name: &metrics, Port: &metricsPort}, {Name: &web, Port: &webPort}},
+			Endpoints: []discoveryv1.Endpoint{
+				{Addresses: []string{"10.0.0.1"}, Conditions: discoveryv1.EndpointConditions{Ready: &ready}},
+				{Addresses: []string{"10.0.0.2"}, Conditions: discoveryv1.EndpointConditions{Ready: &notReady}},
+			},
+		},
+		&discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "alertmanager-abcde",
+				Namespace: "infra",
+				Labels:    map[string]string{discoveryv1.LabelServiceName: "alertmanager"},
+			},
+			Ports:     []discoveryv1.EndpointPort{{Name: &web, Port: &webPort}},
+			Endpoints: []discoveryv1.Endpoint{{Addresses: []string{"10.0.1.1"}}},
+		},
+	}
+	client := k8sfake.NewSimpleClientset(objs...)
+
+	tests := []struct {
+		targets []string
+		exp     []string
+	}{
+		{
+			targets: []string{"endpoints:infra/prometheus:web"},
+			exp:     []string{"10.0.0.1:9090"},
+		},
+		{
+			targets: []string{"endpoints:infra/prometheus:9091:notready"},
+			exp:     []string{"10.0.0.1:9091", "10.0.0.2:9091"},
+		},
+		{
+			targets: []string{"endpointslices:infra/prometheus:web"},
+			exp:     []string{"10.0.0.1:9090"},
+		},
+		{
+			targets: []string{"endpointslices:infra/prometheus:web:notready", "endpointslices:infra/alertmanager:web"},
+			exp:     []string{"10.0.0.1:9090", "10.0.0.2:9090", "10.0.1.1:9090"},
+		},
+		{
+			targets: []string{"pods:infra/app=prometheus:web"},
+			exp:     []string{"10.0.0.1:9090"},
+		},
+		{
+			targets: []string{"pods:infra/app=prometheus:web:notready"},
+			exp:     []string{"10.0.0.1:9090", "10.0.0.2:9090"},
+		},
+		{
+			// Unknown port names, and missing objects, find nothing.
+			targets: []string{"pods:infra/app=prometheus:nope", "endpoints:infra/missing:9090"},
+		},
+	}
+
+	for _, tt := range tests {
+		r := &reloader{client: client}
+		for _, s := range tt.targets {
+			rt, err := parseReloadTarget(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.targets = append(r.targets, rt)
+		}
+		got := r.discoverTargets()
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.exp) {
+			t.Errorf("%v: expected %v, got %v", tt.targets, tt.exp, got)
+		}
+	}
+}
@@ -11,17 +11,29 @@ import (
 	"time"
 
 	configV1beta1 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta1"
+	configV1beta2 "github.com/QubitProducts/prom-config-controller/pkg/apis/config/v1beta2"
 	"github.com/golang/glog"
 	v1 "k8s.io/api/admission/v1"
 	regv1 "k8s.io/api/admissionregistration/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/kubernetes/scheme"
 )
 
 var codecs = serializer.NewCodecFactory(scheme.Scheme)
 
+// webhookTimeout is the TimeoutSeconds of the registered webhooks, the most
+// the API server allows. The checks made while admitting an object share
+// admissionTimeout, which is kept below it so that the webhook always
+// answers before the API server gives up on it.
+const (
+	webhookTimeout   = 30 * time.Second
+	admissionTimeout = webhookTimeout - 5*time.Second
+)
+
 type admitFunc func(v1.AdmissionReview) *v1.AdmissionResponse
 
 func toAdmissionResponse(err error) *v1.AdmissionResponse {
@@ -32,7 +44,7 @@ func toAdmissionResponse(err error) *v1.AdmissionResponse {
 	}
 }
 
-func serveValidate(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) serveValidate(w http.ResponseWriter, r *http.Request) {
 	glog.V(2).Info("Webhook called")
 	var body []byte
 	if r.Body != nil {
@@ -60,7 +72,7 @@ func serveValidate(w http.ResponseWriter, r *http.Request) {
 		glog.Error(err)
 		reviewResponse = toAdmissionResponse(err)
 	} else {
-		reviewResponse = admit(ar)
+		reviewResponse = c.admit(ar)
 	}
 
 	response := v1.AdmissionReview{
@@ -86,66 +98,122 @@ func serveValidate(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func admit(ar v1.AdmissionReview) *v1.AdmissionResponse {
+func (c *Controller) admit(ar v1.AdmissionReview) *v1.AdmissionResponse {
 	glog.V(2).Info("admitting prometheus resource")
-	if ar.Request.Resource.Group != configV1beta1.SchemeGroupVersion.Group ||
-		ar.Request.Resource.Version != configV1beta1.SchemeGroupVersion.Version {
+	if ar.Request.Resource.Group != configV1beta1.SchemeGroupVersion.Group {
 		err := errors.New("unexpected resource or version")
 		glog.Error(err)
 		return toAdmissionResponse(err)
 	}
 
-	switch ar.Request.Resource.Resource {
-	case "rulegroups":
-		return admitRuleGroups(ar)
-	case "scrapes":
-		return admitScrapes(ar)
+	res := schema.GroupVersionResource(ar.Request.Resource)
+	switch res {
+	case configV1beta1.SchemeGroupVersion.WithResource("rulegroups"):
+		return c.admitRuleGroups(ar)
+	case configV1beta1.SchemeGroupVersion.WithResource("scrapes"):
+		return c.admitScrapes(ar)
+	case configV1beta2.SchemeGroupVersion.WithResource("scrapes"):
+		return c.admitStructuredScrapes(ar)
+	case configV1beta1.SchemeGroupVersion.WithResource("alertroutes"):
+		return c.admitAlertRoutes(ar)
+	case configV1beta1.SchemeGroupVersion.WithResource("inhibitrules"):
+		return c.admitInhibitRules(ar)
+	case configV1beta1.SchemeGroupVersion.WithResource("silences"):
+		return c.admitSilences(ar)
 	default:
-		err := fmt.Errorf("unknown resource %s", ar.Request.Resource.Resource)
+		err := fmt.Errorf("unknown resource %s", res)
 		glog.Error(err)
 		return toAdmissionResponse(err)
 	}
 }
 
-func admitRuleGroups(ar v1.AdmissionReview) *v1.AdmissionResponse {
+func (c *Controller) admitRuleGroups(ar v1.AdmissionReview) *v1.AdmissionResponse {
 	glog.V(2).Info("admitting prometheus rule group")
 
 	raw := ar.Request.Object.Raw
+	if ar.Request.Operation == v1.Delete {
+		raw = ar.Request.OldObject.Raw
+	}
 	rulegroup := configV1beta1.RuleGroup{}
 	deserializer := codecs.UniversalDeserializer()
 	if _, _, err := deserializer.Decode(raw, nil, &rulegroup); err != nil {
 		glog.Error(err)
 		return toAdmissionResponse(err)
 	}
+	if rulegroup.Namespace == "" {
+		rulegroup.Namespace = ar.Request.Namespace
+	}
 	reviewResponse := v1.AdmissionResponse{
 		Allowed: true,
 	}
 
-	_, errs := convertRuleGroup(rulegroup.GetName(), &rulegroup)
-	if len(errs) == 0 {
-		return &reviewResponse
+	// Each check is also bounded by the deadline of the whole admission.
+	ctx, cancel := context.WithTimeout(context.Background(), admissionTimeout)
+	defer cancel()
+
+	var warnings []string
+	rg := &rulegroup
+	if ar.Request.Operation == v1.Delete {
+		rg = nil
+	} else {
+		_, errs := convertRuleGroup(rulegroup.GetName(), &rulegroup, c.ruleChecks(&rulegroup)...)
+		if len(errs) > 0 {
+			return validationDenied("rulegroup", errs...)
+		}
+
+		errs, warnings = c.lintRuleGroup(&rulegroup)
+		if len(errs) > 0 {
+			return validationDenied("rulegroup", errs...)
+		}
+
+		testCtx, cancelTests := context.WithTimeout(ctx, ruleTestTimeout)
+		errs = runRuleTests(testCtx, &rulegroup)
+		timedOut := testCtx.Err() == context.DeadlineExceeded
+		cancelTests()
+		if timedOut && len(errs) > 0 {
+			errs = append([]error{fmt.Errorf("rule tests did not finish within %s, simplify the tests or split them across rule groups", ruleTestTimeout)}, errs...)
+		}
+		if len(errs) > 0 {
+			return validationDenied("rulegroup", errs...)
+		}
 	}
-	var messages []string
-	causes := make([]metav1.StatusCause, len(errs))
-	for _, e := range errs {
-		causes = append(causes, metav1.StatusCause{
-			Message: e.Error(),
-		})
-		messages = append(messages, e.Error())
+
+	// The group is checked against the others it is rendered with, deleted
+	// groups only for the rules that depend on them.
+	if c.selectsRuleGroup(&rulegroup) {
+		if ctx.Err() != nil {
+			return validationDenied("rulegroup", fmt.Errorf("rule group checks did not finish within %s, try again", admissionTimeout))
+		}
+		errs, setWarnings, err := c.checkRuleSet(rulegroup.Namespace+"/"+rulegroup.Name, rg)
+		if err != nil {
+			glog.Errorf("checking rule group against the rule set failed, %v", err)
+		}
+		if len(errs) > 0 {
+			return validationDenied("rulegroup", errs...)
+		}
+		warnings = append(warnings, setWarnings...)
 	}
 
-	reviewResponse.Allowed = false
-	reviewResponse.Result = &metav1.Status{
-		Message: fmt.Sprintf("errors during rulegroup validation, %s", strings.Join(messages, ", ")),
-		Reason:  metav1.StatusReasonNotAcceptable,
-		Details: &metav1.StatusDetails{
-			Causes: causes,
-		},
+	// Metrics without series are only warned about, prometheus may not
+	// have scraped them yet.
+	if rg != nil && c.MetricChecker != nil {
+		metricCtx, cancelMetrics := context.WithTimeout(ctx, metricCheckTimeout)
+		missing, err := c.checkRuleMetrics(metricCtx, rg, c.recordedSeries())
+		if err != nil {
+			glog.Errorf("checking the metrics of rule group failed, %v", err)
+			if metricCtx.Err() == context.DeadlineExceeded {
+				warnings = append(warnings, "the metrics used by the rules were not checked, prometheus did not answer in time")
+			}
+		}
+		cancelMetrics()
+		warnings = append(warnings, missing...)
 	}
+
+	reviewResponse.Warnings = warnings
 	return &reviewResponse
 }
 
-func admitScrapes(ar v1.AdmissionReview) *v1.AdmissionResponse {
+func (c *Controller) admitScrapes(ar v1.AdmissionReview) *v1.AdmissionResponse {
 	glog.V(2).Info("admitting prometheus scrape")
 
 	raw := ar.Request.Object.Raw
@@ -159,18 +227,159 @@ func admitScrapes(ar v1.AdmissionReview) *v1.AdmissionResponse {
 		Allowed: true,
 	}
 
-	_, err := convertScrape(scrape.GetName(), &scrape)
-	if err == nil {
-		return &reviewResponse
+	// A v1beta1 spec is validated as the raw form of a structured spec.
+	spec := configV1beta2.ScrapeSpec{Raw: string(scrape.Spec)}
+	pcfg, ferrs := c.validateScrapeSpec(scrape.ObjectMeta, &spec, field.NewPath("spec"))
+	if len(ferrs) > 0 {
+		return scrapeDenied(fieldErrors(ferrs)...)
+	}
+	if c.NamespaceIsolation {
+		if errs := isolateScrape(scrape.Namespace, pcfg); len(errs) > 0 {
+			return scrapeDenied(errs...)
+		}
 	}
-	causes := []metav1.StatusCause{{
-		Message: err.Error(),
-	},
+	return &reviewResponse
+}
+
+func (c *Controller) admitStructuredScrapes(ar v1.AdmissionReview) *v1.AdmissionResponse {
+	glog.V(2).Info("admitting prometheus structured scrape")
+
+	raw := ar.Request.Object.Raw
+	scrape := configV1beta2.Scrape{}
+	deserializer := codecs.UniversalDeserializer()
+	if _, _, err := deserializer.Decode(raw, nil, &scrape); err != nil {
+		glog.Error(err)
+		return toAdmissionResponse(err)
+	}
+	reviewResponse := v1.AdmissionResponse{
+		Allowed: true,
+	}
+
+	pcfg, ferrs := c.validateScrapeSpec(scrape.ObjectMeta, &scrape.Spec, field.NewPath("spec", "raw"))
+	if len(ferrs) > 0 {
+		return scrapeDenied(fieldErrors(ferrs)...)
+	}
+	if c.NamespaceIsolation {
+		if errs := isolateScrape(scrape.Namespace, pcfg); len(errs) > 0 {
+			return scrapeDenied(errs...)
+		}
+	}
+	return &reviewResponse
+}
+
+func (c *Controller) admitAlertRoutes(ar v1.AdmissionReview) *v1.AdmissionResponse {
+	glog.V(2).Info("admitting alert route")
+
+	raw := ar.Request.Object.Raw
+	route := configV1beta1.AlertRoute{}
+	deserializer := codecs.UniversalDeserializer()
+	if _, _, err := deserializer.Decode(raw, nil, &route); err != nil {
+		glog.Error(err)
+		return toAdmissionResponse(err)
+	}
+	if route.Namespace == "" {
+		route.Namespace = ar.Request.Namespace
+	}
+	reviewResponse := v1.AdmissionResponse{
+		Allowed: true,
+	}
+
+	converted, receivers, errs := convertAlertRoute(&route)
+	if len(errs) > 0 {
+		return validationDenied("alert route", errs...)
+	}
+
+	// The route is checked in the full alertmanager config, unless that is
+	// already invalid without it.
+	if c.alerting() {
+		key := route.Namespace + "/" + route.Name
+		if _, err := c.alertmanagerConfig(key, converted, receivers); err != nil {
+			if _, berr := c.alertmanagerConfig("", nil, nil); berr == nil {
+				return validationDenied("alert route", err)
+			}
+			glog.Infof("not checking alert route %s against the invalid alertmanager config, %v", key, err)
+		}
+	}
+	return &reviewResponse
+}
+
+func (c *Controller) admitInhibitRules(ar v1.AdmissionReview) *v1.AdmissionResponse {
+	glog.V(2).Info("admitting inhibit rule")
+
+	raw := ar.Request.Object.Raw
+	rule := configV1beta1.InhibitRule{}
+	deserializer := codecs.UniversalDeserializer()
+	if _, _, err := deserializer.Decode(raw, nil, &rule); err != nil {
+		glog.Error(err)
+		return toAdmissionResponse(err)
+	}
+	if rule.Namespace == "" {
+		rule.Namespace = ar.Request.Namespace
+	}
+	reviewResponse := v1.AdmissionResponse{
+		Allowed: true,
+	}
+
+	if _, errs := convertInhibitRule(&rule); len(errs) > 0 {
+		return validationDenied("inhibit rule", errs...)
+	}
+	return &reviewResponse
+}
+
+func (c *Controller) admitSilences(ar v1.AdmissionReview) *v1.AdmissionResponse {
+	glog.V(2).Info("admitting silence")
+
+	raw := ar.Request.Object.Raw
+	silence := configV1beta1.Silence{}
+	deserializer := codecs.UniversalDeserializer()
+	if _, _, err := deserializer.Decode(raw, nil, &silence); err != nil {
+		glog.Error(err)
+		return toAdmissionResponse(err)
+	}
+	if silence.Namespace == "" {
+		silence.Namespace = ar.Request.Namespace
+	}
+	reviewResponse := v1.AdmissionResponse{
+		Allowed: true,
+	}
+
+	_, errs := silenceMatchers(&silence)
+	if _, _, _, err := silenceWindow(silence.Spec, time.Now()); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return validationDenied("silence", errs...)
+	}
+	return &reviewResponse
+}
+
+func scrapeDenied(errs ...error) *v1.AdmissionResponse {
+	return validationDenied("scrape", errs...)
+}
+
+// validationDenied rejects an object of the given kind for the errors found
+// validating it. Errors about a particular field are reported as causes with
+// the field path and type of the error.
+func validationDenied(kind string, errs ...error) *v1.AdmissionResponse {
+	reviewResponse := v1.AdmissionResponse{}
+	var messages []string
+	var causes []metav1.StatusCause
+	for _, e := range errs {
+		cause := metav1.StatusCause{
+			Message: e.Error(),
+		}
+		if fe, ok := e.(*field.Error); ok {
+			cause.Type = metav1.CauseType(fe.Type)
+			cause.Field = fe.Field
+			cause.Message = fe.ErrorBody()
+		}
+		causes = append(causes, cause)
+		messages = append(messages, e.Error())
 	}
 
 	reviewResponse.Allowed = false
 	reviewResponse.Result = &metav1.Status{
-		Message: fmt.Sprintf("errors during scrape validation, %s", err.Error()),
+		Message: fmt.Sprintf("errors during %s validation, %s", kind, strings.Join(messages, ", ")),
 		Reason:  metav1.StatusReasonNotAcceptable,
 		Details: &metav1.StatusDetails{
 			Causes: causes,
@@ -179,6 +388,15 @@ func admitScrapes(ar v1.AdmissionReview) *v1.AdmissionResponse {
 	return &reviewResponse
 }
 
+// fieldErrors returns the errors of a field error list.
+func fieldErrors(errs field.ErrorList) []error {
+	res := make([]error, len(errs))
+	for i, e := range errs {
+		res[i] = e
+	}
+	return res
+}
+
 // register this webhook admission controller with the kube-apiserver
 // by creating MutatingWebhookConfiguration.
 func (c *Controller) selfRegistration() error {
@@ -194,6 +412,16 @@ func (c *Controller) selfRegistration() error {
 		}
 	}
 	sideEffects := regv1.SideEffectClassNone
+	ignore := regv1.Ignore
+	timeoutSeconds := int32(webhookTimeout / time.Second)
+	clientConfig := regv1.WebhookClientConfig{
+		Service: &regv1.ServiceReference{
+			Namespace: c.ServiceNS,
+			Name:      c.ServiceName,
+			Path:      &path,
+		},
+		CABundle: c.CACert,
+	}
 	webhookConfig := &regv1.ValidatingWebhookConfiguration{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: webhookName,
@@ -204,22 +432,36 @@ func (c *Controller) selfRegistration() error {
 				Rules: []regv1.RuleWithOperations{
 					{
 						Operations: []regv1.OperationType{regv1.Create, regv1.Update},
+						Rule: regv1.Rule{
+							APIGroups:   []string{configV1beta1.SchemeGroupVersion.Group},
+							APIVersions: []string{configV1beta1.SchemeGroupVersion.Version, configV1beta2.SchemeGroupVersion.Version},
+							Resources:   []string{"rulegroups", "scrapes", "alertroutes", "inhibitrules", "silences"},
+						},
+					}},
+				ClientConfig:            clientConfig,
+				AdmissionReviewVersions: []string{"v1"},
+				SideEffects:             &sideEffects,
+				TimeoutSeconds:          &timeoutSeconds,
+			},
+			{
+				// Deleting a rule group can break the rules of others
+				// that depend on it, which is only warned about, so
+				// deletes are not blocked when the controller is down.
+				Name: "deletes." + configV1beta1.SchemeGroupVersion.Group,
+				Rules: []regv1.RuleWithOperations{
+					{
+						Operations: []regv1.OperationType{regv1.Delete},
 						Rule: regv1.Rule{
 							APIGroups:   []string{configV1beta1.SchemeGroupVersion.Group},
 							APIVersions: []string{configV1beta1.SchemeGroupVersion.Version},
-							Resources:   []string{"rulegroups", "scrapes"},
+							Resources:   []string{"rulegroups"},
 						},
 					}},
-				ClientConfig: regv1.WebhookClientConfig{
-					Service: &regv1.ServiceReference{
-						Namespace: c.ServiceNS,
-						Name:      c.ServiceName,
-						Path:      &path,
-					},
-					CABundle: c.CACert,
-				},
+				ClientConfig:            clientConfig,
 				AdmissionReviewVersions: []string{"v1"},
 				SideEffects:             &sideEffects,
+				FailurePolicy:           &ignore,
+				TimeoutSeconds:          &timeoutSeconds,
 			},
 		},
 	}